@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/yurttasutkan/alarmservice/internal/config"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+var auditOrganizationIDs []int64
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Audit log tools",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the audit log hash chains and report any break",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The chains are verified in a read-only transaction, the database
+		// is neither migrated nor sealed.
+		db, err := storage.Open(&config.C)
+		if err != nil {
+			return errors.Wrap(err, "open database error")
+		}
+		defer db.Close()
+
+		reports, err := storage.VerifyAuditLog(context.Background(), db, auditOrganizationIDs)
+		if err != nil {
+			return errors.Wrap(err, "verify audit log error")
+		}
+
+		broken := 0
+		for _, r := range reports {
+			if r.Valid() {
+				fmt.Printf("organization %d: ok, %d entries\n", r.OrganizationID, r.Entries)
+				continue
+			}
+			broken++
+			fmt.Printf("organization %d: %d breaks in %d entries\n", r.OrganizationID, len(r.Breaks), r.Entries)
+			for _, b := range r.Breaks {
+				fmt.Printf("  entry %d: %s\n", b.AuditID, b.Reason)
+			}
+		}
+
+		if broken != 0 {
+			return fmt.Errorf("audit log chain broken for %d organizations", broken)
+		}
+		return nil
+	},
+}
+
+func init() {
+	auditVerifyCmd.Flags().Int64SliceVar(&auditOrganizationIDs, "organization-id", nil, "organization to verify, can be repeated (default all)")
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
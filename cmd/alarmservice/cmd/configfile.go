@@ -18,6 +18,11 @@ const configTemplate = `[general]
   #
   # When set to true, log messages are being written to syslog.
   log_to_syslog={{ .General.LogToSyslog }}
+  # Log as JSON.
+  #
+  # When set to true, log messages are written as JSON objects, one per
+  # line, e.g. for log aggregation. Else they are written as text.
+  log_json={{ .General.LogJSON }}
   # gRPC default resolver scheme.
   #
   # Set this to "dns" for enabling dns round-robin load balancing.
@@ -70,12 +75,173 @@ const configTemplate = `[general]
   # Alarm server settings.
 [alarm_server]
 
+  # Alarm template sync interval.
+  #
+  # Templates linked to a zone or zone category are re-applied at this
+  # interval, so that devices added to a zone inherit the template alarm.
+  template_sync_interval="{{ .AlarmServer.TemplateSyncInterval }}"
+
+  # Deleted alarm retention.
+  #
+  # Deleted alarms can be restored during this period, after which they are
+  # purged together with their date windows (0 = never purge).
+  deleted_alarm_retention="{{ .AlarmServer.DeletedAlarmRetention }}"
+
+  # Idempotency key TTL.
+  #
+  # CreateAlarm calls carrying an idempotency-key metadata (Idempotency-Key
+  # header on the HTTP gateway) return the alarm created by the first call
+  # with the same key during this period (0 = keys never expire).
+  idempotency_key_ttl="{{ .AlarmServer.IdempotencyKeyTTL }}"
+
+  # Alarm cache max age.
+  #
+  # The active alarms of the devices, as checked by EvaluateAlarms, are cached
+  # in memory, by dev_eui. The entries are invalidated on change and reloaded
+  # at the latest after this duration, should a change notification be lost
+  # (0 = no cache).
+  alarm_cache_max_age="{{ .AlarmServer.AlarmCacheMaxAge }}"
+
+  # Unique alarms.
+  #
+  # When set, creating an alarm fails when the device already has an alarm
+  # for the same sensor and the same users.
+  unique_alarms={{ .AlarmServer.UniqueAlarms }}
+
+  # Shutdown timeout.
+  #
+  # On SIGTERM the API stops accepting calls and running calls and background
+  # workers get this long to finish before they are canceled.
+  shutdown_timeout="{{ .AlarmServer.ShutdownTimeout }}"
+
   # Alarm server API settings.
   [alarm_server.api]
 
     # IP:Port to bind the Alarm server API to.
     bind="{{ .AlarmServer.API.Bind }}"
-  `
+
+    # CA certificate used by the API server to verify client certificates
+    # (optional). When set, clients must present a certificate signed by it.
+    ca_cert="{{ .AlarmServer.API.CACert }}"
+
+    # TLS certificate used by the API server (optional).
+    #
+    # The certificate, key and CA files are reloaded when they change on disk.
+    tls_cert="{{ .AlarmServer.API.TLSCert }}"
+
+    # TLS key used by the API server (optional).
+    tls_key="{{ .AlarmServer.API.TLSKey }}"
+
+    # Enable gRPC server reflection.
+    #
+    # Lets tools such as grpcurl discover the API. Meant for debugging, the
+    # reflection service is not authenticated.
+    reflection={{ .AlarmServer.API.Reflection }}
+
+    # JWT secret.
+    #
+    # The secret used by ChirpStack to sign user tokens and API keys. Every
+    # call must carry such a token in the authorization metadata. The server
+    # does not start without it unless auth_disabled is set.
+    jwt_secret="{{ .AlarmServer.API.JWTSecret }}"
+
+    # Disable authentication.
+    #
+    # Accepts every call without a token, the user ids given in the requests
+    # are trusted. Only meant for development, or behind a proxy that
+    # authenticates the calls.
+    auth_disabled={{ .AlarmServer.API.AuthDisabled }}
+
+    # Trusted proxies.
+    #
+    # IP addresses or CIDR ranges of the proxies allowed to set the
+    # X-Forwarded-For metadata. The client address of calls from other peers
+    # is the peer address.
+    trusted_proxies=[{{ range $index, $proxy := .AlarmServer.API.TrustedProxies }}{{ if $index }}, {{ end }}"{{ $proxy }}"{{ end }}]
+
+    # Rate limits.
+    #
+    # Token buckets limiting the calls of each RPC per caller (user, API key
+    # or client address) and per organization, the organization being that
+    # of the API key, of the request or else the first organization of the
+    # user. A call takes one token, rate tokens are added per second up to
+    # burst. Calls over the limits fail with RESOURCE_EXHAUSTED and the delay
+    # to retry after. A rate of 0 disables the limit.
+    [alarm_server.api.rate_limit.caller]
+      rate={{ .AlarmServer.API.RateLimit.Caller.Rate }}
+      burst={{ .AlarmServer.API.RateLimit.Caller.Burst }}
+
+    [alarm_server.api.rate_limit.organization]
+      rate={{ .AlarmServer.API.RateLimit.Organization.Rate }}
+      burst={{ .AlarmServer.API.RateLimit.Organization.Burst }}
+
+    # Limits of given RPCs, replacing the limits above. Example:
+    #
+    # [alarm_server.api.rate_limit.rpc.GetOrganizationAlarmList.organization]
+    #   rate=1
+    #   burst=5
+{{ range $rpc, $limits := .AlarmServer.API.RateLimit.RPC }}
+    [alarm_server.api.rate_limit.rpc.{{ $rpc }}.caller]
+      rate={{ $limits.Caller.Rate }}
+      burst={{ $limits.Caller.Burst }}
+
+    [alarm_server.api.rate_limit.rpc.{{ $rpc }}.organization]
+      rate={{ $limits.Organization.Rate }}
+      burst={{ $limits.Organization.Burst }}
+{{ end }}
+  # REST/JSON gateway settings.
+  #
+  # The gateway exposes the API RPCs as REST/JSON, with the OpenAPI document
+  # at /api/openapi.json. It uses the authentication and the TLS settings of
+  # the API.
+  [alarm_server.http]
+
+    # IP:Port to bind the gateway to, the gateway is disabled when not set.
+    bind="{{ .AlarmServer.HTTP.Bind }}"
+
+# Metrics settings.
+[metrics]
+
+  # Prometheus metrics settings.
+  [metrics.prometheus]
+
+    # Enable the Prometheus metrics endpoint, served at /metrics.
+    endpoint_enabled={{ .Metrics.Prometheus.EndpointEnabled }}
+
+    # IP:Port to bind the Prometheus metrics endpoint to.
+    bind="{{ .Metrics.Prometheus.Bind }}"
+
+  # SMS credit check settings.
+  #
+  # The SMS credits remaining at the SMS provider are checked at this
+  # interval with the given account (0 = disabled).
+  [metrics.sms_credit]
+    check_interval="{{ .Metrics.SMSCredit.CheckInterval }}"
+    user_id={{ .Metrics.SMSCredit.UserID }}
+    username="{{ .Metrics.SMSCredit.Username }}"
+    password="{{ .Metrics.SMSCredit.Password }}"
+
+# Tracing settings.
+#
+# Spans of the API calls, the database queries and the notification provider
+# calls are exported over OTLP/HTTP (JSON encoding).
+[tracing]
+
+  # OTLP/HTTP traces endpoint, e.g. http://otel-collector:4318/v1/traces.
+  # Tracing is disabled when not set.
+  endpoint="{{ .Tracing.Endpoint }}"
+
+  # Sampling ratio of new traces, between 0 and 1. Traces sampled by the
+  # caller are always sampled.
+  sampling_ratio={{ .Tracing.SamplingRatio }}
+
+  # Timeout of an export request.
+  export_timeout="{{ .Tracing.ExportTimeout }}"
+
+  # Headers added to the export requests, e.g. for authentication.
+  [tracing.headers]
+{{ range $k, $v := .Tracing.Headers }}  {{ $k }}="{{ $v }}"
+{{ end }}  `
 
 var configCmd = &cobra.Command{
 	Use:   "configfile",
@@ -6,6 +6,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/yurttasutkan/alarmservice/internal/config"
@@ -38,6 +39,15 @@ func init() {
 	viper.SetDefault("postgresql.automigrate", true)
 	viper.SetDefault("postgresql.max_idle_connections", 2)
 	viper.SetDefault("alarm_server.api.bind", "172.22.0.18:9000")
+	viper.SetDefault("alarm_server.template_sync_interval", time.Minute)
+	viper.SetDefault("alarm_server.deleted_alarm_retention", time.Hour*24*30)
+	viper.SetDefault("alarm_server.idempotency_key_ttl", time.Hour*24)
+	viper.SetDefault("alarm_server.alarm_cache_max_age", time.Minute*5)
+	viper.SetDefault("alarm_server.shutdown_timeout", time.Second*30)
+	viper.SetDefault("metrics.prometheus.bind", "0.0.0.0:8001")
+	viper.SetDefault("metrics.sms_credit.check_interval", time.Hour)
+	viper.SetDefault("tracing.sampling_ratio", 1.0)
+	viper.SetDefault("tracing.export_timeout", time.Second*10)
 
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(configCmd)
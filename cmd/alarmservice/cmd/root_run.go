@@ -2,10 +2,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	// "github.com/jmoiron/sqlx"
 	// "github.com/pkg/errors"
@@ -16,44 +18,67 @@ import (
 
 	"github.com/yurttasutkan/alarmservice/internal/api"
 	"github.com/yurttasutkan/alarmservice/internal/config"
+	"github.com/yurttasutkan/alarmservice/internal/lifecycle"
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
 	"github.com/yurttasutkan/alarmservice/internal/storage"
+	"github.com/yurttasutkan/alarmservice/internal/tracing"
 )
 
+// services runs the API server and the background workers.
+var services *lifecycle.Manager
+
+// apiServer is the API server, set up by setupAPI.
+var apiServer *api.Server
+
 func run(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
+	services = lifecycle.New(ctx)
 
 	tasks := []func() error{
 		setLogLevel,
+		setLogFormat,
 		setSyslog,
-		setupStorage,
 		setGRPCResolver,
 		printStartMessage,
+		setupTracing,
+		setupMetrics,
+		setupAlarmCache,
+		setupNotifications,
 		setupAPI,
+		setupStorage,
+		setupTemplateSync,
+		setupDeletedAlarmPurge,
+		setupIdempotencyKeyPurge,
+		setupSMSCreditCheck,
 	}
 
 	for _, t := range tasks {
 		if err := t(); err != nil {
+			// A signal received while waiting for the database stops the
+			// service without starting the remaining tasks.
+			if errors.Is(err, context.Canceled) {
+				break
+			}
 			log.Fatal(err)
 		}
 	}
 
-	sigChan := make(chan os.Signal)
-	exitChan := make(chan struct{})
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	log.WithField("signal", <-sigChan).Info("signal received")
-	go func() {
-		log.Warning("stopping alarmservice")
-		// todo: handle graceful shutdown?
-		exitChan <- struct{}{}
-	}()
-	select {
-	case <-exitChan:
-	case s := <-sigChan:
-		log.WithField("signal", s).Info("signal received, stopping immediately")
+	// Stop listening to signals, a second signal kills the process.
+	<-services.Context().Done()
+	cancel()
+
+	// In-flight calls are drained by the graceful stop of the API server,
+	// then the notifications being sent are waited for.
+	err := services.Wait(config.C.AlarmServer.ShutdownTimeout)
+	if err := storage.Close(); err != nil {
+		log.WithError(err).Error("close database error")
+	}
+	if err != nil {
+		return err
 	}
 
+	log.Info("alarmservice stopped")
 	return nil
 }
 
@@ -62,6 +87,13 @@ func setLogLevel() error {
 	return nil
 }
 
+func setLogFormat() error {
+	if config.C.General.LogJSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	return nil
+}
+
 func setGRPCResolver() error {
 	resolver.SetDefaultScheme(config.C.General.GRPCDefaultResolverScheme)
 	return nil
@@ -75,16 +107,189 @@ func printStartMessage() error {
 	return nil
 }
 
+func setupTracing() error {
+	shutdown, err := tracing.Setup(&config.C, version)
+	if err != nil {
+		return fmt.Errorf("setup tracing error: %w", err)
+	}
+
+	// Registered first so that it runs last, flushing the spans of the
+	// calls drained by the API server.
+	services.OnStop("tracing", shutdown)
+	return nil
+}
+
+func setupMetrics() error {
+	server, err := metrics.Setup(&config.C)
+	if err != nil {
+		return fmt.Errorf("setup metrics error: %w", err)
+	}
+	if server == nil {
+		return nil
+	}
+
+	services.Go("metrics", func(ctx context.Context) error {
+		return server.Serve()
+	})
+	services.OnStop("metrics", server.Stop)
+	return nil
+}
+
 func setupAPI() error {
-	if err := api.Setup(&config.C); err != nil {
+	server, err := api.Setup(&config.C)
+	if err != nil {
 		return fmt.Errorf("setup api error: %w", err)
 	}
+	apiServer = server
+
+	// The API is started first so that health checks are answered while
+	// the database is being set up, other calls are rejected until then.
+	services.Go("api", func(ctx context.Context) error {
+		return server.Serve()
+	})
+	services.Go("http gateway", func(ctx context.Context) error {
+		return server.ServeGateway()
+	})
+	services.Go("api health", server.MonitorHealth)
+	services.Go("alarm events", server.RunAlarmEvents)
+	services.OnStop("api", server.Stop)
 	return nil
 }
 
 func setupStorage() error {
-	if err := storage.Setup(&config.C); err != nil {
+	if err := storage.Setup(services.Context(), &config.C); err != nil {
 		return fmt.Errorf("setup storage error: %w", err)
 	}
+	return metrics.RegisterDBStats(storage.DB().DB)
+}
+
+// setupNotifications waits on shutdown for the notifications being sent.
+// It is registered before the API so that it runs once the calls that send
+// notifications are drained.
+func setupNotifications() error {
+	services.OnStop("notifications", storage.WaitNotifications)
+	return nil
+}
+
+// setupAlarmCache enables the alarm cache before the API and the storage
+// are set up, it follows the change feed once the database is ready.
+func setupAlarmCache() error {
+	maxAge := config.C.AlarmServer.AlarmCacheMaxAge
+	if maxAge <= 0 {
+		return nil
+	}
+
+	cache := storage.SetupAlarmCache(maxAge)
+	services.Go("alarm cache", func(ctx context.Context) error {
+		return cache.Run(ctx, config.C.PostgreSQL.DSN)
+	})
+	return nil
+}
+
+func setupTemplateSync() error {
+	interval := config.C.AlarmServer.TemplateSyncInterval
+	if interval <= 0 {
+		return nil
+	}
+
+	services.Go("template sync", func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			if err := apiServer.SyncAlarmTemplates(ctx); err != nil && ctx.Err() == nil {
+				log.WithError(err).Error("sync alarm templates error")
+			}
+		}
+	})
+	return nil
+}
+
+func setupDeletedAlarmPurge() error {
+	retention := config.C.AlarmServer.DeletedAlarmRetention
+	if retention <= 0 {
+		return nil
+	}
+
+	services.Go("deleted alarm purge", func(ctx context.Context) error {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			count, err := storage.PurgeDeletedAlarms(storage.DB(), time.Now().Add(-retention))
+			if err != nil {
+				log.WithError(err).Error("purge deleted alarms error")
+				continue
+			}
+			if count != 0 {
+				log.WithField("count", count).Info("deleted alarms purged")
+			}
+		}
+	})
+	return nil
+}
+
+func setupIdempotencyKeyPurge() error {
+	ttl := config.C.AlarmServer.IdempotencyKeyTTL
+	if ttl <= 0 {
+		return nil
+	}
+
+	services.Go("idempotency key purge", func(ctx context.Context) error {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			count, err := storage.PurgeIdempotencyKeys(storage.DB(), time.Now().Add(-ttl))
+			if err != nil {
+				log.WithError(err).Error("purge idempotency keys error")
+				continue
+			}
+			if count != 0 {
+				log.WithField("count", count).Info("idempotency keys purged")
+			}
+		}
+	})
+	return nil
+}
+
+func setupSMSCreditCheck() error {
+	conf := config.C.Metrics.SMSCredit
+	if conf.CheckInterval <= 0 || conf.Username == "" {
+		return nil
+	}
+	user := storage.UserInfo{
+		UserID:   conf.UserID,
+		Username: conf.Username,
+		Password: conf.Password,
+	}
+
+	services.Go("sms credit check", func(ctx context.Context) error {
+		ticker := time.NewTicker(conf.CheckInterval)
+		defer ticker.Stop()
+		for {
+			// GetUser records the remaining credits.
+			if _, err := user.GetUser(); err != nil {
+				log.WithError(err).Warning("check sms credits error")
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
 	return nil
 }
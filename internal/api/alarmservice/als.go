@@ -1,10 +1,51 @@
 package alarmservice
 
+import (
+	"context"
+	"time"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/auth"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/config"
+)
+
 //AlarmServerAPI implements the Alarm server API.
 type AlarmServerAPI struct {
+	idempotencyKeyTTL time.Duration
+	uniqueAlarms      bool
+	// authEnabled is set when the calls are authenticated, the streams
+	// without a principal are then rejected.
+	authEnabled bool
+	events      *eventHub
 }
 
 //Creates a new AlarmServerAPI
-func NewAlarmServerAPI() *AlarmServerAPI {
-	return &AlarmServerAPI{}
+func NewAlarmServerAPI(conf *config.Config) *AlarmServerAPI {
+	return &AlarmServerAPI{
+		idempotencyKeyTTL: conf.AlarmServer.IdempotencyKeyTTL,
+		uniqueAlarms:      conf.AlarmServer.UniqueAlarms,
+		authEnabled:       !conf.AlarmServer.API.AuthDisabled,
+		events:            newEventHub(conf.PostgreSQL.DSN),
+	}
+}
+
+// caller returns the identity of the caller of ctx. The user id given in the
+// request is only used when the call is not authenticated.
+func caller(ctx context.Context, userID int64) identity.Identity {
+	c := identity.FromContext(ctx)
+	if !c.Authenticated {
+		c.UserID = userID
+	}
+	return c
+}
+
+// zoneUserID returns the user whose zones limit the alarms the caller can
+// see, 0 when the caller is not limited to zones: admins, API keys and
+// unauthenticated calls.
+func zoneUserID(ctx context.Context) int64 {
+	p, ok := auth.FromContext(ctx)
+	if !ok || p.IsAdmin {
+		return 0
+	}
+	return p.UserID
 }
@@ -0,0 +1,27 @@
+package alarmservice
+
+import (
+	"context"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// VerifyAuditLog walks the audit log hash chains and reports every break.
+func (a *AlarmServerAPI) VerifyAuditLog(ctx context.Context, req *alsext.VerifyAuditLogRequest) (*alsext.VerifyAuditLogResponse, error) {
+	reports, err := s.VerifyAuditLog(ctx, s.DB(), req.OrganizationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := alsext.VerifyAuditLogResponse{
+		Valid:   true,
+		Reports: reports,
+	}
+	for _, r := range reports {
+		if !r.Valid() {
+			resp.Valid = false
+		}
+	}
+	return &resp, nil
+}
@@ -0,0 +1,83 @@
+package alarmservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+const (
+	defaultAuditLogLimit = 50
+	maxAuditLogLimit     = 1000
+)
+
+// SearchAuditLogs searches alarm_audit_log, newest entries first. Users only
+// see the entries of the devices in their zones.
+func (a *AlarmServerAPI) SearchAuditLogs(ctx context.Context, req *alsext.SearchAuditLogsRequest) (*alsext.SearchAuditLogsResponse, error) {
+	db := s.DBContext(ctx)
+
+	filters := s.AuditLogFilters{
+		AlarmID:    req.AlarmID,
+		DevEui:     req.DevEui,
+		ChangedBy:  req.UserID,
+		ChangeType: req.ChangeType,
+		From:       req.From,
+		To:         req.To,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+
+		OrganizationID: req.OrganizationID,
+		ZoneUserID:     zoneUserID(ctx),
+	}
+	if filters.Limit <= 0 {
+		filters.Limit = defaultAuditLogLimit
+	}
+	if filters.Limit > maxAuditLogLimit {
+		filters.Limit = maxAuditLogLimit
+	}
+	if filters.Offset < 0 {
+		filters.Offset = 0
+	}
+
+	count, err := s.GetAuditLogCount(db, filters)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.GetAuditLogs(db, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := alsext.SearchAuditLogsResponse{
+		TotalCount: count,
+		Result:     make([]alsext.AuditLogItem, 0, len(entries)),
+	}
+	for _, e := range entries {
+		item := alsext.AuditLogItem{
+			ID:         e.ID,
+			AlarmID:    e.AlarmID,
+			DevEui:     e.DevEui,
+			ChangeType: e.ChangeType,
+			UserID:     e.ChangedBy,
+			Actor:      e.Actor,
+			ChangedAt:  e.ChangedAt,
+			TableName:  e.TableName,
+			IPAddress:  e.IPAddress,
+			Reason:     e.Reason,
+		}
+		if item.Before, err = e.Before(); err != nil {
+			return nil, fmt.Errorf("decode audit entry %d error: %v", e.ID, err)
+		}
+		if item.After, err = e.After(); err != nil {
+			return nil, fmt.Errorf("decode audit entry %d error: %v", e.ID, err)
+		}
+		if item.After != nil {
+			item.Changes = s.DiffAlarmSnapshots(item.Before, item.After)
+		}
+		resp.Result = append(resp.Result, item)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,113 @@
+package alarmservice
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	"github.com/yurttasutkan/alarmservice/internal/api/apierror"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/logging"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// BulkAlarms applies the given create, update and delete operations in a
+// single transaction. Each operation runs in its own savepoint so that a
+// failing item is reported without hiding the result of the others, but the
+// transaction is only committed when every item succeeded.
+func (a *AlarmServerAPI) BulkAlarms(ctx context.Context, req *alsext.BulkAlarmRequest) (*alsext.BulkAlarmResponse, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	resp := alsext.BulkAlarmResponse{
+		Results: make([]alsext.BulkAlarmResult, 0, len(req.Operations)),
+	}
+	failed := false
+
+	for i, op := range req.Operations {
+		if _, err := tx.Exec("savepoint bulk_alarm_item"); err != nil {
+			return nil, s.HandlePSQLError(s.Insert, err, "savepoint error")
+		}
+
+		result, err := a.applyBulkOperation(tx, op, caller(ctx, req.UserID))
+		result.Index = i
+
+		if err != nil {
+			failed = true
+			setBulkError(ctx, &result, err)
+			if _, err := tx.Exec("rollback to savepoint bulk_alarm_item"); err != nil {
+				return nil, s.HandlePSQLError(s.Insert, err, "rollback savepoint error")
+			}
+		} else if _, err := tx.Exec("release savepoint bulk_alarm_item"); err != nil {
+			return nil, s.HandlePSQLError(s.Insert, err, "release savepoint error")
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	if failed || req.DryRun {
+		return &resp, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	resp.Committed = true
+
+	return &resp, nil
+}
+
+// applyBulkOperation runs a single bulk operation inside tx.
+func (a *AlarmServerAPI) applyBulkOperation(tx *s.TracedTx, op alsext.BulkAlarmOperation, c identity.Identity) (alsext.BulkAlarmResult, error) {
+	result := alsext.BulkAlarmResult{
+		Action:  op.Action,
+		AlarmID: op.AlarmID,
+	}
+
+	var err error
+	switch op.Action {
+	case alsext.BulkCreate:
+		if op.Alarm == nil {
+			return result, s.ErrAlarmRequired
+		}
+		result.Alarm, err = a.createAlarm(tx, op.Alarm, c, nil)
+		if err == nil {
+			result.AlarmID = result.Alarm.Id
+		}
+	case alsext.BulkUpdate:
+		if op.Alarm == nil {
+			return result, s.ErrAlarmRequired
+		}
+		err = updateAlarm(tx, op.AlarmID, op.Alarm, c)
+	case alsext.BulkDelete:
+		err = deleteAlarm(tx, op.AlarmID, c)
+	default:
+		err = s.ErrBulkUnknownAction.With("action", strconv.Itoa(int(op.Action)))
+	}
+	return result, err
+}
+
+// setBulkError sets the error of a failed operation as the call would have
+// returned it: the errors outside of the storage error catalog are logged
+// and reported as an internal error.
+func setBulkError(ctx context.Context, result *alsext.BulkAlarmResult, err error) {
+	if apierror.IsInternal(err) {
+		logging.FromContext(ctx).WithError(err).WithField("index", result.Index).Error("api: bulk alarm operation internal error")
+	}
+	st := status.Convert(apierror.Status(err))
+	result.Code = st.Code().String()
+	result.Error = st.Message()
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			result.Reason = info.Reason
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package alarmservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+func TestApplyBulkOperationInvalid(t *testing.T) {
+	a := &AlarmServerAPI{}
+
+	tests := []struct {
+		name string
+		op   alsext.BulkAlarmOperation
+		want error
+	}{
+		{"create without alarm", alsext.BulkAlarmOperation{Action: alsext.BulkCreate}, s.ErrAlarmRequired},
+		{"update without alarm", alsext.BulkAlarmOperation{Action: alsext.BulkUpdate, AlarmID: 1}, s.ErrAlarmRequired},
+		{"unknown action", alsext.BulkAlarmOperation{Action: 9, AlarmID: 1}, s.ErrBulkUnknownAction},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := a.applyBulkOperation(nil, tc.op, caller(context.Background(), 1))
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+			if result.Action != tc.op.Action || result.AlarmID != tc.op.AlarmID {
+				t.Errorf("got result %+v", result)
+			}
+		})
+	}
+}
+
+func TestSetBulkError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantReason string
+		wantError  string
+	}{
+		{"catalog error", s.ErrAlarmNotFound.With("alarm_id", "3"), "NotFound", "ALARM_NOT_FOUND", "alarm does not exist (alarm_id=3)"},
+		{"unknown action", s.ErrBulkUnknownAction.With("action", "9"), "InvalidArgument", "BULK_UNKNOWN_ACTION", "unknown bulk action (action=9)"},
+		{"internal error hides its detail", errors.New(`pq: column "min_treshold" does not exist`), "Internal", "INTERNAL", "internal error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var result alsext.BulkAlarmResult
+			setBulkError(context.Background(), &result, tc.err)
+			if result.Code != tc.wantCode || result.Reason != tc.wantReason || result.Error != tc.wantError {
+				t.Errorf("got (%s, %s, %q), want (%s, %s, %q)", result.Code, result.Reason, result.Error, tc.wantCode, tc.wantReason, tc.wantError)
+			}
+		})
+	}
+}
@@ -3,52 +3,121 @@ package alarmservice
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
 	s "github.com/yurttasutkan/alarmservice/internal/storage"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // Implements the RPC method CreateAlarm.
-// Inserts into alarm_refactor2 and logs the change in the audit logs.
-func (a *AlarmServerAPI) CreateAlarm(context context.Context, req *als.CreateAlarmRequest) (*als.CreateAlarmResponse, error) {
-	db := s.DB()
+// Inserts into alarm_refactor2 and logs the change in the audit logs. A call
+// with an idempotency key already used by the caller returns the alarm
+// created by the first call, even if it was deleted since.
+func (a *AlarmServerAPI) CreateAlarm(ctx context.Context, req *als.CreateAlarmRequest) (*als.CreateAlarmResponse, error) {
+	db := s.DBContext(ctx)
 	tx, err := db.Beginx()
 	if err != nil {
 		return nil, fmt.Errorf("could not start transaction: %v", err)
 	}
 	defer tx.Rollback()
 
+	key := idempotencyKey(ctx)
+	scope := idempotencyScope(ctx, req.UserId)
+	if key != "" {
+		hash, err := requestHash(req.Alarm)
+		if err != nil {
+			return nil, err
+		}
+		previous, claimed, err := s.ClaimIdempotencyKey(tx, scope, key, hash, a.idempotencyKeyTTL)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			if previous.AlarmID == nil {
+				return nil, fmt.Errorf("idempotency key %s has no alarm", key)
+			}
+			// The alarm is returned as it is stored now, also when it was
+			// deleted since the first call.
+			snap, err := s.GetAlarmSnapshot(tx, *previous.AlarmID)
+			if err != nil {
+				return nil, err
+			}
+			return &als.CreateAlarmResponse{Alarm: toAlsAlarm(snap.Alarm, snap.AlarmDateTime)}, nil
+		}
+	}
+
+	created, err := a.createAlarm(tx, req.Alarm, caller(ctx, req.UserId), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		if err := s.SetIdempotencyKeyAlarm(tx, scope, key, created.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+
+	return &als.CreateAlarmResponse{Alarm: created}, nil
+}
+
+// createAlarm inserts the given alarm and its date windows inside tx and
+// writes the INSERT audit entry. It returns the alarm as it was stored. With
+// unique alarms, it fails when the device has an alarm for the same sensor
+// and users. The alarm is linked to the given template when it is not nil.
+func (a *AlarmServerAPI) createAlarm(tx *s.TracedTx, al *als.Alarm, c identity.Identity, template *s.AlarmTemplate) (*als.Alarm, error) {
+	if err := validateCreate(tx, al); err != nil {
+		return nil, err
+	}
+
+	sensors := s.AlarmSensors{
+		Temperature: al.Temperature,
+		Humadity:    al.Humadity,
+		Ec:          al.Ec,
+		Door:        al.Door,
+		WaterLeak:   al.WLeak,
+		Distance:    al.Distance,
+		Pressure:    al.Pressure,
+	}
+	if err := a.checkDuplicate(tx, 0, al.DevEui, sensors, al.UserID); err != nil {
+		return nil, err
+	}
+
 	var returnID int64
 	var alarmDates []s.AlarmDateFilter
-	al := req.Alarm
+	var templateID *int64
+	var reason string
+	if template != nil {
+		templateID = &template.ID
+		reason = "created from alarm template"
+	}
 
 	// Insert alarm into alarm_refactor2
 	pqInt64Array := pq.Int64Array(al.UserID)
-	err = tx.QueryRowx(`
+	err := tx.QueryRowx(`
 		insert into alarm_refactor2 (
 			dev_eui, min_treshold, max_treshold, sms, email, temperature, humadity, ec, door, w_leak,
 			user_id, is_time_limit_active, alarm_start_time, alarm_stop_time, zone_category, notification,
-			notification_sound, distance, pressure
-		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+			notification_sound, distance, pressure, template_id
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
 		returning id`,
 		al.DevEui, al.MinTreshold, al.MaxTreshold, al.Sms, al.Email, al.Temperature, al.Humadity, al.Ec,
 		al.Door, al.WLeak, pqInt64Array, al.IsTimeLimitActive, al.AlarmStartTime, al.AlarmStopTime,
-		al.ZoneCategoryID, al.Notification, al.NotificationSound, al.Distance, al.Pressure,
+		al.ZoneCategoryID, al.Notification, al.NotificationSound, al.Distance, al.Pressure, templateID,
 	).Scan(&returnID)
 	if err != nil {
 		return nil, s.HandlePSQLError(s.Insert, err, "insert error")
 	}
 
-	// Log the creation in the audit log
-	// Creating a struct for previous values (which is nil here as it's a new record)
-	var previousValue interface{} = nil
-
 	// New value contains the values of the alarm being created
 	newAlarm := als.Alarm{
 		Id:                returnID,
@@ -70,27 +139,19 @@ func (a *AlarmServerAPI) CreateAlarm(context context.Context, req *als.CreateAla
 		AlarmStopTime:     al.AlarmStopTime,
 		ZoneCategoryID:    al.ZoneCategoryID,
 		IsActive:          al.IsActive,
-		AlarmDateTime:     nil, // You can append dates later
+		AlarmDateTime:     nil, // Appended once the dates are created
 		NotificationSound: al.NotificationSound,
 		Distance:          al.Distance,
 		DefrostTime:       al.DefrostTime,
 		Pressure:          al.Pressure,
 	}
 
-	// Log the creation in the audit log
-	if err := s.LogAudit(db, newAlarm.Id, newAlarm.DevEui, req.UserId, "INSERT", previousValue, newAlarm); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("could not log audit: %v", err)
-	}
-
 	// Handle specific logic for ZoneCategoryID = 1
 	if al.ZoneCategoryID == 1 {
 		if err := s.CreateColdRoomRestrictions(al, returnID, tx); err != nil {
-			tx.Rollback()
 			return nil, err
 		}
 		if err := s.CreateUtku(al, returnID, tx); err != nil {
-			tx.Rollback()
 			return nil, err
 		}
 	}
@@ -109,64 +170,98 @@ func (a *AlarmServerAPI) CreateAlarm(context context.Context, req *als.CreateAla
 	// Create alarm dates
 	dates, err := s.CreateAlarmDates(tx, alarmDates)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
-	// Construct response
-	resp := als.CreateAlarmResponse{
-		Alarm: &als.Alarm{
-			Id:                returnID,
-			DevEui:            al.DevEui,
-			MinTreshold:       al.MinTreshold,
-			MaxTreshold:       al.MaxTreshold,
-			Sms:               al.Sms,
-			Email:             al.Email,
-			Notification:      al.Notification,
-			Temperature:       al.Temperature,
-			Humadity:          al.Humadity,
-			Ec:                al.Ec,
-			Door:              al.Door,
-			WLeak:             al.WLeak,
-			UserID:            al.UserID,
-			IpAddress:         al.IpAddress,
-			IsTimeLimitActive: al.IsTimeLimitActive,
-			AlarmStartTime:    al.AlarmStartTime,
-			AlarmStopTime:     al.AlarmStopTime,
-			ZoneCategoryID:    al.ZoneCategoryID,
-			IsActive:          al.IsActive,
-			AlarmDateTime:     dates,
-			NotificationSound: al.NotificationSound,
-			Distance:          al.Distance,
-			DefrostTime:       al.DefrostTime,
-			Pressure:          al.Pressure,
-		},
+	// Log the creation in the audit log, previous values are nil as it's a new record
+	created, err := s.GetAlarmSnapshot(tx, returnID)
+	if err != nil {
+		return nil, err
 	}
-
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    returnID,
+		DevEui:     al.DevEui,
+		ChangeType: "INSERT",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		Reason:     reason,
+		New:        created,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not log audit: %v", err)
 	}
 
-	return &resp, nil
+	newAlarm.AlarmDateTime = dates
+	return &newAlarm, nil
 }
 
 // Implements the RPC method UpdateAlarm.
 // Updates alarm_refactor table with the parameters given by request.
 func (a *AlarmServerAPI) UpdateAlarm(ctx context.Context, req *als.UpdateAlarmRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := updateAlarm(tx, req.AlarmID, req.Alarm, caller(ctx, req.UserId)); err != nil {
+		return &empty.Empty{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// checkDuplicate fails with ErrAlarmAlreadyExists when alarms are unique and
+// the device has an alarm other than alarmID with the same sensor and users.
+// The alarms of the device stay locked until the end of tx.
+func (a *AlarmServerAPI) checkDuplicate(tx *s.TracedTx, alarmID int64, devEui string, sensors s.AlarmSensors, userIDs []int64) error {
+	if !a.uniqueAlarms {
+		return nil
+	}
+	if err := s.LockDeviceAlarms(tx, devEui); err != nil {
+		return err
+	}
+	return s.CheckDuplicateAlarm(tx, alarmID, devEui, sensors, userIDs)
+}
+
+// updateAlarm updates the alarm with the given id inside tx, replaces its
+// date windows and writes the UPDATE audit entry.
+func updateAlarm(tx *s.TracedTx, alarmID int64, alarm *als.Alarm, c identity.Identity) error {
 	var alarmDates []s.AlarmDateFilter
 
 	var currentAlarm s.Alarm
 	// Get the previous values of the alarm
-	err := sqlx.Get(db, &currentAlarm, "select * from alarm_refactor2 where id = $1", req.AlarmID)
+	err := sqlx.Get(tx, &currentAlarm, "select * from alarm_refactor2 where id = $1 and deleted_at is null", alarmID)
 	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
+		return s.HandlePSQLError(s.Select, err, "select error")
+	}
+	if err := validateUpdate(currentAlarm, alarm); err != nil {
+		return err
+	}
+	previous, err := s.GetAlarmSnapshot(tx, alarmID)
+	if err != nil {
+		return err
+	}
+
+	// Fields changed on a templated alarm are kept when the template changes.
+	if currentAlarm.TemplateID != nil {
+		fields, err := changedTemplateFields(tx, currentAlarm, alarm)
+		if err != nil {
+			return err
+		}
+		if err := s.MarkAlarmFieldsOverridden(tx, alarmID, fields); err != nil {
+			return err
+		}
 	}
 
-	alarm := req.Alarm
 	pqInt64Array := pq.Int64Array(alarm.UserID)
-	res, err := db.Exec(`update alarm_refactor2 
+	res, err := tx.Exec(`update alarm_refactor2 
 	set   min_treshold = $1,
 	max_treshold = $2,
 	sms    = $3,
@@ -184,50 +279,59 @@ func (a *AlarmServerAPI) UpdateAlarm(ctx context.Context, req *als.UpdateAlarmRe
 		alarm.Email,
 		alarm.Notification,
 		alarm.IsTimeLimitActive,
-		req.AlarmID,
+		alarmID,
 		alarm.NotificationSound,
 		pqInt64Array,
 		alarm.IsActive,
 		alarm.DefrostTime,
 	)
 	if err != nil {
-		log.Println(err)
+		return s.HandlePSQLError(s.Update, err, "update error")
 	}
-	_, err = db.Exec("delete from alarm_date_time where alarm_id = $1", req.Alarm.Id)
+	_, err = tx.Exec("delete from alarm_date_time where alarm_id = $1", alarmID)
 	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
+		return s.HandlePSQLError(s.Delete, err, "delete error")
 	}
-	for _, alarmDateTime := range req.Alarm.AlarmDateTime {
+	for _, alarmDateTime := range alarm.AlarmDateTime {
 		dt := s.AlarmDateFilter{
-			AlarmId:        alarmDateTime.AlarmId,
+			AlarmId:        alarmID,
 			AlarmDay:       alarmDateTime.AlarmDay,
 			AlarmStartTime: alarmDateTime.AlarmStartTime,
 			AlarmEndTime:   alarmDateTime.AlarmEndTime,
 		}
 		alarmDates = append(alarmDates, dt)
 	}
-	_, err = s.CreateAlarmDates(db, alarmDates)
+	_, err = s.CreateAlarmDates(tx, alarmDates)
 	if err != nil {
-		return &emptypb.Empty{}, s.HandlePSQLError(s.Update, err, "update error")
+		return s.HandlePSQLError(s.Update, err, "update error")
 	}
 	ra, err := res.RowsAffected()
 	if err != nil {
-		return &emptypb.Empty{}, errors.Wrap(err, "get rows affected error")
+		return errors.Wrap(err, "get rows affected error")
 	}
 	if ra == 0 {
-		return &emptypb.Empty{}, nil
+		return nil
 	}
 
 	// Fetch the updated alarm from the database
-	var updatedAlarm s.Alarm
-	err = sqlx.Get(db, &updatedAlarm, "select * from alarm_refactor2 where id = $1", req.AlarmID)
+	updated, err := s.GetAlarmSnapshot(tx, alarmID)
 	if err != nil {
-		return nil, s.HandlePSQLError(s.Select, err, "fetch updated alarm error")
+		return err
 	}
-	// Log the creation in the audit log
-	if err := s.LogAudit(db, alarm.Id, alarm.DevEui, req.UserId, "UPDATE", currentAlarm, updatedAlarm); err != nil {
-		return nil, fmt.Errorf("could not log audit: %v", err)
+	// Log the update in the audit log
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    currentAlarm.ID,
+		DevEui:     currentAlarm.DevEui,
+		ChangeType: "UPDATE",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		Old:        previous,
+		New:        updated,
+	})
+	if err != nil {
+		return fmt.Errorf("could not log audit: %v", err)
 	}
 
-	return &emptypb.Empty{}, nil
+	return nil
 }
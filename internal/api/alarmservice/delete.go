@@ -3,143 +3,204 @@ package alarmservice
 import (
 	"context"
 	"fmt"
-	"log"
+	"strconv"
+	"strings"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/logging"
 	s "github.com/yurttasutkan/alarmservice/internal/storage"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func (a *AlarmServerAPI) DeleteAlarm(ctx context.Context, req *als.DeleteAlarmRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteAlarm(tx, req.AlarmID, caller(ctx, req.UserID)); err != nil {
+		return &empty.Empty{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
+	}
 
-	var currentAlarm s.Alarm
+	return &empty.Empty{}, nil
+}
+
+// deleteAlarm soft-deletes the alarm with the given id inside tx, deactivates
+// its automation rules and writes the DELETE audit entry.
+func deleteAlarm(tx *s.TracedTx, alarmID int64, c identity.Identity) error {
 	// Get the previous values of the alarm
-	err := sqlx.Get(db, &currentAlarm, "select * from alarm_refactor2 where id = $1", req.AlarmID)
+	previous, err := s.GetAlarmSnapshot(tx, alarmID)
 	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
+		return err
+	}
+	if previous.DeletedAt != nil {
+		return s.ErrAlarmNotFound.With("alarm_id", strconv.FormatInt(alarmID, 10))
 	}
 
 	// Log the delete action
-	err = s.LogAudit(db, currentAlarm.ID, currentAlarm.DevEui, req.UserID, "DELETE", currentAlarm, nil)
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    previous.ID,
+		DevEui:     previous.DevEui,
+		ChangeType: "DELETE",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		Old:        previous,
+	})
 	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Insert, err, "insert error")
+		return err
 	}
 
-	// Delete from `alarm_refactor2`
-	res, err := db.Exec("DELETE FROM alarm_refactor2 WHERE id = $1", req.AlarmID)
+	// Soft delete from `alarm_refactor2`, this also deactivates the automation rules
+	ra, err := s.SoftDeleteAlarms(tx, []int64{alarmID})
 	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
+		return err
 	}
 
 	// Check if the alarm was actually deleted
-	ra, err := res.RowsAffected()
-	if err != nil {
-		return &empty.Empty{}, errors.Wrap(err, "get rows affected error")
-	}
 	if ra == 0 {
-		return &empty.Empty{}, errors.New("no rows deleted: alarm may not exist")
-	}
-
-	// Log the alarm deletion event
-	reqAlarm := &als.Alarm{
-		Id:                currentAlarm.ID,
-		DevEui:            currentAlarm.DevEui,
-		MinTreshold:       currentAlarm.MinTreshold,
-		MaxTreshold:       currentAlarm.MaxTreshold,
-		Sms:               currentAlarm.Sms,
-		Email:             currentAlarm.Email,
-		Notification:      currentAlarm.Notification,
-		Temperature:       currentAlarm.Temperature,
-		Humadity:          currentAlarm.Humadity,
-		Ec:                currentAlarm.Ec,
-		Door:              currentAlarm.Door,
-		WLeak:             currentAlarm.WaterLeak,
-		UserID:            currentAlarm.UserId,
-		IpAddress:         currentAlarm.IpAddress,
-		IsTimeLimitActive: currentAlarm.IsTimeLimitActive,
-		AlarmStartTime:    currentAlarm.AlarmStartTime,
-		AlarmStopTime:     currentAlarm.AlarmStopTime,
-		ZoneCategoryID:    currentAlarm.ZoneCategoryId,
-		IsActive:          currentAlarm.IsActive,
-	}
-	s.CreateAlarmLog(ctx, db, reqAlarm, currentAlarm.UserId, currentAlarm.IpAddress, 1)
-
-	// Deactivate automation rules related to this alarm
-	_, err = db.Exec("UPDATE alarm_automation_rules SET is_active = false WHERE alarm_id = $1", req.AlarmID)
-	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Update, err, "update error")
+		return s.ErrAlarmNotFound.With("alarm_id", strconv.FormatInt(alarmID, 10))
 	}
 
-	// Delete related records in `alarm_date_time`
-	_, err = db.Exec("DELETE FROM alarm_date_time WHERE alarm_id = $1", req.AlarmID)
-	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
-	}
-
-	return &empty.Empty{}, nil
+	return nil
 }
 
 // Implements the RPC method DeleteAlarmDates.
-// Deletes the AlarmDateTime according to the AlarmID given by the request.
+// Deletes the AlarmDateTime according to the AlarmID given by the request and
+// logs the change of the alarm in the audit logs.
 func (a *AlarmServerAPI) DeleteAlarmDates(ctx context.Context, req *als.DeleteAlarmDatesRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, 0)
+
+	previous, err := s.GetAlarmSnapshot(tx, req.AlarmId)
+	if err != nil {
+		return &empty.Empty{}, err
+	}
 
-	_, err := db.Exec("delete from alarm_date_time where alarm_id = $1", req.AlarmId)
+	_, err = tx.Exec("delete from alarm_date_time where alarm_id = $1", req.AlarmId)
 	if err != nil {
 		return &empty.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
 	}
 
+	updated := previous
+	updated.AlarmDateTime = nil
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    previous.ID,
+		DevEui:     previous.DevEui,
+		ChangeType: "UPDATE",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		Old:        previous,
+		New:        updated,
+	})
+	if err != nil {
+		return &empty.Empty{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
+	}
+
 	return &empty.Empty{}, nil
 }
 
 // Implements the RPC method DeleteUserAlarm.
 // Deletes the Alarm according to the UserID given by the request.
 func (a *AlarmServerAPI) DeleteUserAlarm(ctx context.Context, req *als.DeleteUserAlarmRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, req.UserSentId)
 
 	for _, i := range req.UserIds {
 		query := `
-		WITH updated_rows AS (
-			UPDATE public.alarm_refactor2
-			SET user_id = array_remove(user_id, $1::bigint)
-			WHERE $1 = ANY(user_id)
-			RETURNING *
+		WITH previous_rows AS (
+			SELECT * FROM public.alarm_refactor2
+			WHERE $1 = ANY(user_id) AND deleted_at IS NULL
+			FOR UPDATE
 		)
-		SELECT * FROM updated_rows;
+		SELECT * FROM previous_rows;
 		`
 
-		// Fetch updated alarm records before deleting
+		// Fetch alarm records before removing the user
 		var alarms []s.Alarm
-		err := sqlx.Select(db, &alarms, query, i)
+		err := sqlx.Select(tx, &alarms, query, i)
+		if err != nil {
+			return &empty.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
+		}
+
+		_, err = tx.Exec(`UPDATE public.alarm_refactor2
+			SET user_id = array_remove(user_id, $1::bigint)
+			WHERE id = ANY($2)`, i, pq.Array(getAlarmIDs(alarms)))
+		if err != nil {
+			return &empty.Empty{}, s.HandlePSQLError(s.Update, err, "update error")
+		}
+
+		snapshots, err := s.WithAlarmDates(tx, alarms)
 		if err != nil {
-			fmt.Println("Update error:", err)
-			return nil, err
+			return &empty.Empty{}, err
 		}
 
-		// Log the delete action before actually deleting
-		for _, al := range alarms {
-			if len(al.UserId) == 1 { // If it's the last user, it will be deleted
-				err = s.LogAudit(db, al.ID, al.DevEui, req.UserSentId, "DELETE", al, nil)
-				if err != nil {
-					return &empty.Empty{}, s.HandlePSQLError(s.Insert, err, "insert error")
-				}
+		// Log the change before actually deleting
+		var emptied []s.Alarm
+		for _, al := range snapshots {
+			updated := al
+			updated.UserId = removeInt64(al.UserId, i)
+
+			changeType := "UPDATE"
+			var newValue interface{} = updated
+			if len(updated.UserId) == 0 { // The last user was removed, it will be deleted
+				changeType = "DELETE"
+				newValue = nil
+				emptied = append(emptied, al.Alarm)
+			}
+
+			err = s.LogAudit(tx, s.AuditLog{
+				AlarmID:    al.ID,
+				DevEui:     al.DevEui,
+				ChangeType: changeType,
+				UserID:     c.UserID,
+				IPAddress:  c.IPAddress,
+				Actor:      c.Actor,
+				Old:        al,
+				New:        newValue,
+			})
+			if err != nil {
+				return &empty.Empty{}, err
 			}
 		}
 
-		// Delete alarms where `user_id` is now empty
-		_, err = db.Exec(`DELETE FROM public.alarm_refactor2
-			WHERE id = ANY($1) AND cardinality(user_id) = 0`, pq.Array(getAlarmIDs(alarms)))
+		// Soft delete alarms where `user_id` is now empty
+		_, err = s.SoftDeleteAlarms(tx, getAlarmIDs(emptied))
 		if err != nil {
-			fmt.Println("Delete error:", err)
-			return nil, err
+			return &empty.Empty{}, err
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return &empty.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
+	}
+
 	return &empty.Empty{}, nil
 }
 
@@ -152,116 +213,151 @@ func getAlarmIDs(alarms []s.Alarm) []int64 {
 	return ids
 }
 
+// Helper function to remove a value from an int64 slice, like array_remove
+func removeInt64(values []int64, v int64) []int64 {
+	out := []int64{}
+	for _, value := range values {
+		if value != v {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// Helper function to join int64 values for error messages
+func joinInt64s(values []int64) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = strconv.FormatInt(v, 10)
+	}
+	return strings.Join(strs, ",")
+}
+
 func (a *AlarmServerAPI) DeleteSensorAlarm(ctx context.Context, req *als.DeleteSensorAlarmRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &emptypb.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, req.UserId)
 
 	// Fetch all alarms that match the given DevEUIs
 	var alarms []s.Alarm
-	err := db.Select(&alarms, "SELECT * FROM alarm_refactor2 WHERE dev_eui = ANY($1)", pq.Array(req.DevEuis))
+	err = tx.Select(&alarms, "SELECT * FROM alarm_refactor2 WHERE dev_eui = ANY($1) AND deleted_at IS NULL FOR UPDATE", pq.Array(req.DevEuis))
 	if err != nil {
 		return &emptypb.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
 	}
 
 	// If no alarms found, return early
 	if len(alarms) == 0 {
-		return &emptypb.Empty{}, errors.New("no alarms found for given DevEUIs")
+		return &emptypb.Empty{}, s.ErrAlarmNotFound.With("dev_eui", strings.Join(req.DevEuis, ","))
 	}
 
-	// Extract alarm IDs for later deletions
-	var alarmIds []int64
-	for _, al := range alarms {
-		alarmIds = append(alarmIds, al.ID)
+	snapshots, err := s.WithAlarmDates(tx, alarms)
+	if err != nil {
+		return &emptypb.Empty{}, err
 	}
 
 	// Log the delete action before actual deletion
-	for _, al := range alarms {
-		err = s.LogAudit(db, al.ID, al.DevEui, req.UserId, "DELETE", al, nil)
+	for _, al := range snapshots {
+		err = s.LogAudit(tx, s.AuditLog{
+			AlarmID:    al.ID,
+			DevEui:     al.DevEui,
+			ChangeType: "DELETE",
+			UserID:     c.UserID,
+			IPAddress:  c.IPAddress,
+			Actor:      c.Actor,
+			Old:        al,
+		})
 		if err != nil {
-			return &empty.Empty{}, s.HandlePSQLError(s.Insert, err, "insert error")
+			return &empty.Empty{}, err
 		}
 	}
 
-	// Delete alarms from `alarm_refactor2`
-	res, err := db.Exec("DELETE FROM alarm_refactor2 WHERE dev_eui = ANY($1)", pq.Array(req.DevEuis))
+	// Soft delete alarms from `alarm_refactor2`, their date windows are kept for a restore
+	ra, err := s.SoftDeleteAlarms(tx, getAlarmIDs(alarms))
 	if err != nil {
-		return &emptypb.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
+		return &emptypb.Empty{}, err
 	}
 
 	// Check if alarms were deleted
-	ra, err := res.RowsAffected()
-	if err != nil {
-		return &emptypb.Empty{}, errors.Wrap(err, "get rows affected error")
-	}
 	if ra == 0 {
-		return &emptypb.Empty{}, errors.New("no rows deleted: alarms may not exist")
+		return &emptypb.Empty{}, s.ErrAlarmNotFound.With("dev_eui", strings.Join(req.DevEuis, ","))
 	}
 
-	// Delete related records from `alarm_date_time`
-	_, err = db.Exec("DELETE FROM alarm_date_time WHERE alarm_id = ANY($1)", pq.Array(alarmIds))
-	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
+	if err := tx.Commit(); err != nil {
+		return &emptypb.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
 	}
-	// _, err = db.Exec(`INSERT INTO public.alarm_change_logs(
-	// 	dev_eui, min_treshold, max_treshold, user_id, ip_address, is_deleted, sms, temperature, humadity, ec, door, w_leak)
-	//    select dev_eui,  min_treshold, max_treshold, user_id, '', 1, sms,temperature, humadity, ec, door, w_leak
-	//    from alarm_refactor2 where dev_eui = any($1) and is_active = true`, pq.Array(req.DevEuis))
-	// if err != nil {
-	// 	return &emptypb.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
-	// }
-	// ra, err := res.RowsAffected()
-	// if err != nil {
-	// 	return &emptypb.Empty{}, errors.Wrap(err, "get rows affected error")
-	// }
-	// if ra == 0 {
-	// 	return &emptypb.Empty{}, nil
-	// }
+
 	return &emptypb.Empty{}, nil
 }
 
 // Implements the RPC method DeleteZoneAlarm.
 // Deletes alarms that are in the given zone by the request.
 func (a *AlarmServerAPI) DeleteZoneAlarm(ctx context.Context, req *als.DeleteZoneAlarmRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &emptypb.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, req.UserId)
 
-	log.Println("Zones received:", req.Zones)
+	logger := logging.FromContext(ctx)
+	logger.WithField("zones", req.Zones).Debug("alarmservice: deleting zone alarms")
 
 	// Get device EUIs from the given zones
 	var devEuis []string
-	err := db.Select(&devEuis, `SELECT devices FROM zone WHERE zone_id = ANY($1)`, pq.Array(req.Zones))
+	err = tx.Select(&devEuis, `SELECT devices FROM zone WHERE zone_id = ANY($1)`, pq.Array(req.Zones))
 	if err != nil {
 		return &emptypb.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
 	}
 
 	if len(devEuis) == 0 {
-		return &emptypb.Empty{}, errors.New("no devices found in given zones")
+		return &emptypb.Empty{}, s.ErrZoneDevicesNotFound.With("zone_id", joinInt64s(req.Zones))
 	}
 
-	log.Println("Device EUIs from zones:", devEuis)
+	logger.WithField("dev_euis", devEuis).Debug("alarmservice: devices of zones")
 
 	// Fetch alarms that will be updated
 	var alarms []s.Alarm
-	err = db.Select(&alarms, `SELECT * FROM alarm_refactor2 WHERE ('\\x' || dev_eui) = ANY($1)`, pq.Array(devEuis))
+	err = tx.Select(&alarms, `SELECT * FROM alarm_refactor2 WHERE ('\\x' || dev_eui) = ANY($1) AND deleted_at IS NULL FOR UPDATE`, pq.Array(devEuis))
 	if err != nil {
 		return &emptypb.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
 	}
 
 	if len(alarms) == 0 {
-		return &emptypb.Empty{}, errors.New("no alarms found for the devices in given zones")
+		return &emptypb.Empty{}, s.ErrAlarmNotFound.With("zone_id", joinInt64s(req.Zones))
+	}
+
+	snapshots, err := s.WithAlarmDates(tx, alarms)
+	if err != nil {
+		return &emptypb.Empty{}, err
 	}
 
 	// Log the update action before modifying alarms
-	for _, al := range alarms {
+	for _, al := range snapshots {
 		updatedAlarm := al
 		updatedAlarm.IsActive = false // Simulating the update
 
-		err = s.LogAudit(db, al.ID, al.DevEui, req.UserId, "UPDATE", al, updatedAlarm)
+		err = s.LogAudit(tx, s.AuditLog{
+			AlarmID:    al.ID,
+			DevEui:     al.DevEui,
+			ChangeType: "UPDATE",
+			UserID:     c.UserID,
+			IPAddress:  c.IPAddress,
+			Actor:      c.Actor,
+			Old:        al,
+			New:        updatedAlarm,
+		})
 		if err != nil {
-			return &emptypb.Empty{}, s.HandlePSQLError(s.Insert, err, "insert error")
+			return &emptypb.Empty{}, err
 		}
 	}
 
 	// Update alarms to set `is_active = false`
-	res, err := db.Exec(`UPDATE alarm_refactor2 SET is_active = false WHERE ('\\x' || dev_eui) = ANY($1)`, pq.Array(devEuis))
+	res, err := tx.Exec(`UPDATE alarm_refactor2 SET is_active = false WHERE id = ANY($1)`, pq.Array(getAlarmIDs(alarms)))
 	if err != nil {
 		return &emptypb.Empty{}, s.HandlePSQLError(s.Update, err, "update error")
 	}
@@ -271,10 +367,10 @@ func (a *AlarmServerAPI) DeleteZoneAlarm(ctx context.Context, req *als.DeleteZon
 	if err != nil {
 		return &emptypb.Empty{}, errors.Wrap(err, "get rows affected error")
 	}
-	log.Println("Rows updated:", ra)
+	logger.WithField("rows_affected", ra).Info("alarmservice: zone alarms deactivated")
 
-	if ra == 0 {
-		return &emptypb.Empty{}, nil
+	if err := tx.Commit(); err != nil {
+		return &emptypb.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
 	}
 
 	return &emptypb.Empty{}, nil
@@ -283,34 +379,53 @@ func (a *AlarmServerAPI) DeleteZoneAlarm(ctx context.Context, req *als.DeleteZon
 // Implements the RPC method DeleteAlarmDevEui.
 // Deletes the alarm corresponding to the DevEui and UserID given in the request.
 func (a *AlarmServerAPI) DeleteAlarmDevEui(ctx context.Context, req *als.DeleteAlarmDevEuiRequest) (*empty.Empty, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return &emptypb.Empty{}, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, req.UserId)
 
 	// Fetch the alarm before deletion
 	var alarm s.Alarm
-	err := db.Get(&alarm, "SELECT * FROM alarm_refactor2 WHERE dev_eui = $1 AND user_id = $2", req.Deveui, req.UserId)
+	err = tx.Get(&alarm, "SELECT * FROM alarm_refactor2 WHERE dev_eui = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", req.Deveui, req.UserId)
 	if err != nil {
 		return &emptypb.Empty{}, s.HandlePSQLError(s.Select, err, "select error")
 	}
 
-	// Log the delete action before deleting the record
-	err = s.LogAudit(db, alarm.ID, alarm.DevEui, req.UserId, "DELETE", alarm, nil)
+	previous, err := s.GetAlarmSnapshot(tx, alarm.ID)
 	if err != nil {
-		return &empty.Empty{}, s.HandlePSQLError(s.Insert, err, "insert error")
+		return &emptypb.Empty{}, err
 	}
 
-	// Delete the alarm
-	res, err := db.Exec("DELETE FROM alarm_refactor2 WHERE dev_eui = $1 AND user_id = $2", req.Deveui, req.UserId)
+	// Log the delete action before deleting the record
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    alarm.ID,
+		DevEui:     alarm.DevEui,
+		ChangeType: "DELETE",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		Old:        previous,
+	})
 	if err != nil {
-		return &emptypb.Empty{}, s.HandlePSQLError(s.Delete, err, "delete error")
+		return &empty.Empty{}, err
 	}
 
-	// Check if the alarm was actually deleted
-	ra, err := res.RowsAffected()
+	// Soft delete the alarm
+	ra, err := s.SoftDeleteAlarms(tx, []int64{alarm.ID})
 	if err != nil {
-		return &emptypb.Empty{}, errors.Wrap(err, "get rows affected error")
+		return &emptypb.Empty{}, err
 	}
+
+	// Check if the alarm was actually deleted
 	if ra == 0 {
-		return &emptypb.Empty{}, errors.New("no alarm deleted: alarm may not exist")
+		return &emptypb.Empty{}, s.ErrAlarmNotFound.With("alarm_id", strconv.FormatInt(alarm.ID, 10))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &emptypb.Empty{}, fmt.Errorf("could not commit transaction: %v", err)
 	}
 
 	return &emptypb.Empty{}, nil
@@ -0,0 +1,142 @@
+package alarmservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+// EvaluateAlarms checks the measurements of a device against its active
+// alarms and records the alarms whose state changed in one transaction. The
+// raised and cleared alarms are published to the watches, and the raised
+// ones counted, on commit.
+func (a *AlarmServerAPI) EvaluateAlarms(ctx context.Context, req *alsext.EvaluateAlarmsRequest) (*alsext.EvaluateAlarmsResponse, error) {
+	if req.DevEui == "" {
+		return nil, s.ErrDevEUIRequired
+	}
+	at := time.Now()
+	if req.Time != nil {
+		at = *req.Time
+	}
+
+	db := s.DBContext(ctx)
+	alarms, err := s.GetDeviceAlarms(db, req.DevEui)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	resp := &alsext.EvaluateAlarmsResponse{Raised: []int64{}, Cleared: []int64{}}
+	var events []changefeed.Event
+	for _, al := range alarms {
+		raised, value, ok := alarmRaised(al, req.Values, at)
+		if !ok {
+			continue
+		}
+		e, err := s.SetAlarmState(tx, al.ID, raised, value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case e == nil:
+		case raised:
+			resp.Raised = append(resp.Raised, al.ID)
+			events = append(events, *e)
+		default:
+			resp.Cleared = append(resp.Cleared, al.ID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	for _, e := range events {
+		metrics.AlarmRaised(e.OrganizationID)
+	}
+	return resp, nil
+}
+
+// alarmRaised returns whether the given measurements raise the alarm and the
+// value checked last, the one out of range when raised. ok is false when the
+// alarm is not evaluated: none of its measurements were given, or its time
+// limit is active and at is outside of its windows. Thresholds are
+// inclusive, door and water leak alarms are raised by a non-zero value.
+func alarmRaised(al s.AlarmSnapshot, values map[string]float64, at time.Time) (raised bool, value float64, ok bool) {
+	if al.IsTimeLimitActive && !inAlarmWindow(al, at) {
+		return false, 0, false
+	}
+
+	thresholds := []struct {
+		enabled bool
+		name    string
+	}{
+		{al.Temperature, alsext.MeasurementTemperature},
+		{al.Humadity, alsext.MeasurementHumidity},
+		{al.Ec, alsext.MeasurementEC},
+		{al.Pressure, alsext.MeasurementPressure},
+		{al.Distance, alsext.MeasurementDistance},
+	}
+	for _, m := range thresholds {
+		v, found := values[m.name]
+		if !m.enabled || !found {
+			continue
+		}
+		value, ok = v, true
+		if v < float64(al.MinTreshold) || v > float64(al.MaxTreshold) {
+			return true, v, true
+		}
+	}
+
+	states := []struct {
+		enabled bool
+		name    string
+	}{
+		{al.Door, alsext.MeasurementDoor},
+		{al.WaterLeak, alsext.MeasurementWaterLeak},
+	}
+	for _, m := range states {
+		v, found := values[m.name]
+		if !m.enabled || !found {
+			continue
+		}
+		value, ok = v, true
+		if v != 0 {
+			return true, v, true
+		}
+	}
+	return false, value, ok
+}
+
+// inAlarmWindow returns whether at is within one of the date windows of the
+// alarm, or within its daily start and stop time when it has none. Days are
+// weekdays from 0 for Sunday, times are hours of the day. A window ending
+// before it starts spans midnight.
+func inAlarmWindow(al s.AlarmSnapshot, at time.Time) bool {
+	hour := float32(at.Hour()) + float32(at.Minute())/60 + float32(at.Second())/3600
+	if len(al.AlarmDateTime) == 0 {
+		return inHours(hour, al.AlarmStartTime, al.AlarmStopTime)
+	}
+	for _, d := range al.AlarmDateTime {
+		if d.AlarmDay == int64(at.Weekday()) && inHours(hour, d.AlarmStartTime, d.AlarmEndTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func inHours(hour, start, end float32) bool {
+	if start <= end {
+		return hour >= start && hour <= end
+	}
+	return hour >= start || hour <= end
+}
@@ -0,0 +1,94 @@
+package alarmservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+func TestAlarmRaised(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	monday := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	temperature := s.AlarmSnapshot{Alarm: s.Alarm{ID: 1, Temperature: true, MinTreshold: 2, MaxTreshold: 8}}
+	window := temperature
+	window.IsTimeLimitActive = true
+	window.AlarmDateTime = []s.AlarmDateFilter{{AlarmDay: 1, AlarmStartTime: 9, AlarmEndTime: 17}}
+	overnight := temperature
+	overnight.IsTimeLimitActive = true
+	overnight.AlarmStartTime = 22
+	overnight.AlarmStopTime = 6
+
+	tests := []struct {
+		name       string
+		alarm      s.AlarmSnapshot
+		values     map[string]float64
+		at         time.Time
+		wantRaised bool
+		wantValue  float64
+		wantOK     bool
+	}{
+		{"in range", temperature, map[string]float64{"temperature": 5}, monday, false, 5, true},
+		{"on threshold", temperature, map[string]float64{"temperature": 8}, monday, false, 8, true},
+		{"above max", temperature, map[string]float64{"temperature": 9.5}, monday, true, 9.5, true},
+		{"below min", temperature, map[string]float64{"temperature": -1}, monday, true, -1, true},
+		{"other measurement", temperature, map[string]float64{"humidity": 90}, monday, false, 0, false},
+		{"door open", s.AlarmSnapshot{Alarm: s.Alarm{Door: true}}, map[string]float64{"door": 1}, monday, true, 1, true},
+		{"door closed", s.AlarmSnapshot{Alarm: s.Alarm{Door: true}}, map[string]float64{"door": 0}, monday, false, 0, true},
+		{"in window", window, map[string]float64{"temperature": 9}, monday, true, 9, true},
+		{"outside window hours", window, map[string]float64{"temperature": 9}, monday.Add(8 * time.Hour), false, 0, false},
+		{"outside window day", window, map[string]float64{"temperature": 9}, monday.AddDate(0, 0, 1), false, 0, false},
+		{"overnight before midnight", overnight, map[string]float64{"temperature": 9}, monday.Add(12 * time.Hour), true, 9, true},
+		{"overnight after midnight", overnight, map[string]float64{"temperature": 9}, monday.Add(-6 * time.Hour), true, 9, true},
+		{"overnight daytime", overnight, map[string]float64{"temperature": 9}, monday, false, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			raised, value, ok := alarmRaised(tc.alarm, tc.values, tc.at)
+			if raised != tc.wantRaised || value != tc.wantValue || ok != tc.wantOK {
+				t.Errorf("got (%t, %g, %t), want (%t, %g, %t)", raised, value, ok, tc.wantRaised, tc.wantValue, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestRaisedAlarmReachesWatch(t *testing.T) {
+	a := &AlarmServerAPI{events: newEventHub("")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &testWatchStream{ctx: ctx, events: make(chan *changefeed.Event, 1)}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.WatchAlarms(&alsext.WatchAlarmsRequest{OrganizationID: 1}, stream)
+	}()
+	waitWatches(a.events, 1)
+
+	alarm := s.AlarmSnapshot{Alarm: s.Alarm{ID: 7, DevEui: "0102030405060708", Temperature: true, MaxTreshold: 8}}
+	raised, _, ok := alarmRaised(alarm, map[string]float64{"temperature": 12}, time.Now())
+	if !raised || !ok {
+		t.Fatal("alarm not raised")
+	}
+	// The event SetAlarmState publishes, as received from the change feed.
+	a.events.dispatch(s.AlarmStateEvent(2, alarm.DevEui, 2, true, time.Now()))
+	a.events.dispatch(s.AlarmStateEvent(alarm.ID, alarm.DevEui, 1, raised, time.Now()))
+
+	select {
+	case e := <-stream.events:
+		if e.Type != changefeed.EventRaised || e.AlarmID != alarm.ID || e.DevEui != alarm.DevEui {
+			t.Errorf("got event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package alarmservice
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
@@ -14,14 +13,12 @@ import (
 // Implements the RPC method GetAlarm.
 // Request takes alarmID as field and returns Alarm as response.
 func (a *AlarmServerAPI) GetAlarm(ctx context.Context, alReq *als.GetAlarmRequest) (*als.GetAlarmResponse, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
 	var resp als.GetAlarmResponse
 	var respAlarm s.Alarm
-	var alarmDates []*als.AlarmDateTime
 
-	err := sqlx.Get(db, &respAlarm, "select * from alarm_refactor2 where id = $1", alReq.AlarmID)
+	err := sqlx.Get(db, &respAlarm, "select * from alarm_refactor2 where id = $1 and deleted_at is null", alReq.AlarmID)
 	if err != nil {
-		fmt.Println(err)
 		return &resp, s.HandlePSQLError(s.Select, err, "select error")
 	}
 	var dates []s.AlarmDateFilter
@@ -30,6 +27,13 @@ func (a *AlarmServerAPI) GetAlarm(ctx context.Context, alReq *als.GetAlarmReques
 		return &resp, s.HandlePSQLError(s.Select, err, "select error")
 	}
 
+	resp.Alarm = toAlsAlarm(respAlarm, dates)
+	return &resp, nil
+}
+
+// toAlsAlarm returns the API message of the given alarm and date windows.
+func toAlsAlarm(respAlarm s.Alarm, dates []s.AlarmDateFilter) *als.Alarm {
+	var alarmDates []*als.AlarmDateTime
 	for _, date := range dates {
 		dt := &als.AlarmDateTime{
 			Id:             date.ID,
@@ -40,7 +44,7 @@ func (a *AlarmServerAPI) GetAlarm(ctx context.Context, alReq *als.GetAlarmReques
 		}
 		alarmDates = append(alarmDates, dt)
 	}
-	al := als.Alarm{
+	return &als.Alarm{
 		Id:                respAlarm.ID,
 		DevEui:            respAlarm.DevEui,
 		MinTreshold:       respAlarm.MinTreshold,
@@ -66,33 +70,17 @@ func (a *AlarmServerAPI) GetAlarm(ctx context.Context, alReq *als.GetAlarmReques
 		Pressure:          respAlarm.Pressure,
 		DefrostTime:       respAlarm.DefrostTime,
 	}
-	fmt.Println("GEL ALARM SONU")
-
-	resp.Alarm = &al
-	return &resp, nil
 }
 
 // Implements the RPC method GetAlarmLogs.
 // Request takes DevEUI as field and returns []AlarmLogs as response.
 func (a *AlarmServerAPI) GetAlarmLogs(ctx context.Context, req *als.GetAlarmLogsRequest) (*als.GetAlarmLogsResponse, error) {
-	db := s.DB()
-	var logs []s.AlarmLogs
+	db := s.DBContext(ctx)
 	var result []*als.AlarmLogs
 
-	err := sqlx.Select(db, &logs, `select dev_eui,min_treshold,
-	max_treshold,
-	user_id,
-	ip_address,
-	submission_date,
-	is_deleted,
-	sms,
-	temperature,
-	humadity,
-	ec,
-	door,
-	w_leak from alarm_change_logs where dev_eui = $1`, req.DevEui)
+	logs, err := s.GetAlarmLogs(db, req.DevEui)
 	if err != nil {
-		return &als.GetAlarmLogsResponse{RespLog: result}, s.HandlePSQLError(s.Select, err, "select error")
+		return &als.GetAlarmLogsResponse{RespLog: result}, err
 	}
 
 	for _, log := range logs {
@@ -123,8 +111,7 @@ func (a *AlarmServerAPI) GetAlarmLogs(ctx context.Context, req *als.GetAlarmLogs
 // Implements the RPC method GetAlarmDates.
 // Request takes alarmID as field and returns []AlarmDateTime as response.
 func (a *AlarmServerAPI) GetAlarmDates(ctx context.Context, req *als.GetAlarmDatesRequest) (*als.GetAlarmDatesResponse, error) {
-	db := s.DB()
-	fmt.Println("ALS = ALARM GET ALARM DATES")
+	db := s.DBContext(ctx)
 
 	var returnDates []*als.AlarmDateTime
 	var alarmDates []s.AlarmDateFilter
@@ -149,12 +136,14 @@ func (a *AlarmServerAPI) GetAlarmDates(ctx context.Context, req *als.GetAlarmDat
 // Implements the RPC method GetAlarmList.
 // Request takes AlarmFilter as field and returns []Alarm as response.
 func (a *AlarmServerAPI) GetAlarmList(ctx context.Context, req *als.GetAlarmListRequest) (*als.GetAlarmListResponse, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
 
 	filters := s.AlarmFilters{
 		Limit:  int(req.Filter.Limit),
 		DevEui: req.Filter.DevEui,
 		UserID: req.Filter.UserID,
+
+		ZoneUserID: zoneUserID(ctx),
 	}
 	var returnAlarms []*als.Alarm
 	var alarms []s.Alarm
@@ -228,27 +217,29 @@ func (a *AlarmServerAPI) GetAlarmList(ctx context.Context, req *als.GetAlarmList
 // Implements the RPC method GetOrganizationAlarmList.
 // Request takes organizationID as field and returns []OrganizationAlarm as response.
 func (a *AlarmServerAPI) GetOrganizationAlarmList(ctx context.Context, req *als.GetOrganizationAlarmListRequest) (*als.GetOrganizationAlarmListResponse, error) {
-	db := s.DB()
+	db := s.DBContext(ctx)
 
 	var returnAlarms []*als.OrganizationAlarm
 	var alarms []s.OrganizationAlarm
 	var doorAlarms []s.DoorAlarm
+	zoneUser := zoneUserID(ctx)
 	err := sqlx.Select(db, &alarms, `select z.zone_name, d.name as device_name, 0 AS time, ar.*
 	from alarm_refactor2 as ar
 		inner join device as d on d.dev_eui::text = '\x' || ar.dev_eui
 		inner join zone as z on  d.dev_eui::text = any(z.devices)
-		where d.organization_id = $1`, req.OrganizationID)
+		where d.organization_id = $1 and ar.deleted_at is null
+		and ($2 = 0 or `+s.UserZoneSQL("ar.dev_eui", "$2")+`)`, req.OrganizationID, zoneUser)
 	if err != nil {
 		return &als.GetOrganizationAlarmListResponse{RespList: returnAlarms}, s.HandlePSQLError(s.Select, err, "select error")
 	}
 
 	err = sqlx.Select(db, &doorAlarms, `select z.zone_name, d.name as device_name, dta.* from door_time_alarm as dta
 	inner join device as d on d.dev_eui::text = '\x' || dta.dev_eui
-		inner join zone as z on  d.dev_eui::text = any(z.devices) where  dta.organization_id = $1`, req.OrganizationID)
+		inner join zone as z on  d.dev_eui::text = any(z.devices) where  dta.organization_id = $1
+		and ($2 = 0 or `+s.UserZoneSQL("dta.dev_eui", "$2")+`)`, req.OrganizationID, zoneUser)
 	if err != nil {
 		return &als.GetOrganizationAlarmListResponse{RespList: returnAlarms}, s.HandlePSQLError(s.Select, err, "select error")
 	}
-	fmt.Println("1")
 	for _, alarm := range alarms {
 		var alarmDates []*als.AlarmDateTime
 		var dates []s.AlarmDateFilter
@@ -295,7 +286,6 @@ func (a *AlarmServerAPI) GetOrganizationAlarmList(ctx context.Context, req *als.
 		}
 		returnAlarms = append(returnAlarms, &al)
 	}
-	fmt.Println("3")
 	for _, door := range doorAlarms {
 		var alarmDates []*als.AlarmDateTime
 		var dates []s.AlarmDateFilter
@@ -338,6 +328,5 @@ func (a *AlarmServerAPI) GetOrganizationAlarmList(ctx context.Context, req *als.
 		}
 		returnAlarms = append(returnAlarms, &al)
 	}
-	fmt.Println("4")
 	return &als.GetOrganizationAlarmListResponse{RespList: returnAlarms}, nil
 }
@@ -0,0 +1,90 @@
+package alarmservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// GetAlarmHistory returns the ordered versions of an alarm from the audit
+// log, each with a field-level diff against the previous version.
+func (a *AlarmServerAPI) GetAlarmHistory(ctx context.Context, req *alsext.GetAlarmHistoryRequest) (*alsext.GetAlarmHistoryResponse, error) {
+	versions, err := s.GetAlarmHistory(s.DBContext(ctx), req.AlarmID)
+	if err != nil {
+		return nil, err
+	}
+	return &alsext.GetAlarmHistoryResponse{Versions: versions}, nil
+}
+
+// RevertAlarm restores the alarm row and its date windows to an earlier
+// version and logs the revert in the audit log. The version is validated
+// and, with unique alarms, checked against the other alarms of the device
+// as an update.
+func (a *AlarmServerAPI) RevertAlarm(ctx context.Context, req *alsext.RevertAlarmRequest) (*als.GetAlarmResponse, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, req.UserID)
+
+	target, err := s.GetAlarmVersion(tx, req.AlarmID, req.AuditID)
+	if err != nil {
+		return nil, err
+	}
+	// The version is checked as an update, its sensor included.
+	if err := validateUpdate(target.Alarm, versionAlarm(target)); err != nil {
+		return nil, err
+	}
+	if err := a.checkDuplicate(tx, target.ID, target.DevEui, target.Sensors(), target.UserId); err != nil {
+		return nil, err
+	}
+
+	previous, reverted, err := s.RevertAlarm(tx, req.AlarmID, target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    reverted.ID,
+		DevEui:     reverted.DevEui,
+		ChangeType: "REVERT",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		Old:        previous,
+		New:        reverted,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not log audit: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+
+	return a.GetAlarm(ctx, &als.GetAlarmRequest{AlarmID: req.AlarmID})
+}
+
+// versionAlarm returns the values of an alarm version that validateUpdate
+// checks.
+func versionAlarm(v s.AlarmSnapshot) *als.Alarm {
+	al := &als.Alarm{
+		MinTreshold: v.MinTreshold,
+		MaxTreshold: v.MaxTreshold,
+		UserID:      v.UserId,
+	}
+	for _, d := range v.AlarmDateTime {
+		al.AlarmDateTime = append(al.AlarmDateTime, &als.AlarmDateTime{
+			AlarmDay:       d.AlarmDay,
+			AlarmStartTime: d.AlarmStartTime,
+			AlarmEndTime:   d.AlarmEndTime,
+		})
+	}
+	return al
+}
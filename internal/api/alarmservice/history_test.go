@@ -0,0 +1,52 @@
+package alarmservice
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+func TestValidateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version s.AlarmSnapshot
+		want    []string
+	}{
+		{
+			name: "valid",
+			version: s.AlarmSnapshot{
+				Alarm:         s.Alarm{Temperature: true, MinTreshold: 2, MaxTreshold: 8, UserId: pq.Int64Array{1}},
+				AlarmDateTime: []s.AlarmDateFilter{{AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18}},
+			},
+		},
+		{
+			name:    "without date windows",
+			version: s.AlarmSnapshot{Alarm: s.Alarm{Door: true, UserId: pq.Int64Array{1}}},
+		},
+		{
+			name:    "inverted thresholds",
+			version: s.AlarmSnapshot{Alarm: s.Alarm{Temperature: true, MinTreshold: 8, MaxTreshold: 2, UserId: pq.Int64Array{1}}},
+			want:    []string{"alarm.min_treshold ALARM_INVALID_THRESHOLD"},
+		},
+		{
+			name: "backfilled version without users",
+			version: s.AlarmSnapshot{
+				Alarm:         s.Alarm{Temperature: true, MinTreshold: 2, MaxTreshold: 8},
+				AlarmDateTime: []s.AlarmDateFilter{{AlarmDay: 7, AlarmStartTime: 8, AlarmEndTime: 18}},
+			},
+			want: []string{"alarm.user_id ALARM_USER_REQUIRED", "alarm.alarm_date_time.alarm_day SCHEDULE_INVALID_DAY"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := violations(t, validateUpdate(tc.version.Alarm, versionAlarm(tc.version)))
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package alarmservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/auth"
+)
+
+// idempotencyKeyHeader is the metadata key of the idempotency key, the
+// gateway forwards the Idempotency-Key header under it.
+const idempotencyKeyHeader = "idempotency-key"
+
+// idempotencyKey returns the idempotency key of the call, "" when none was
+// given.
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(idempotencyKeyHeader); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// idempotencyScope returns the scope of the idempotency keys of the caller,
+// so that two callers never share a key. The user id given in the request
+// is only used when the call is not authenticated.
+func idempotencyScope(ctx context.Context, userID int64) string {
+	p, ok := auth.FromContext(ctx)
+	switch {
+	case ok && p.APIKeyID != "":
+		return "api_key:" + p.APIKeyID
+	case ok:
+		return "user:" + strconv.FormatInt(p.UserID, 10)
+	default:
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+}
+
+// requestHash returns the hash of the alarm of a create request, used to
+// detect a key reused for another alarm. The alarm is encoded
+// deterministically so that equal alarms always have the same hash.
+func requestHash(al *als.Alarm) ([]byte, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(al)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal alarm: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
@@ -0,0 +1,62 @@
+package alarmservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// RestoreAlarm brings back a soft-deleted alarm with its date windows and the
+// automation rules that were deactivated by its delete, and logs the restore
+// in the audit log. With unique alarms, it fails when the device has another
+// alarm for the same sensor and users.
+func (a *AlarmServerAPI) RestoreAlarm(ctx context.Context, req *alsext.RestoreAlarmRequest) (*als.GetAlarmResponse, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+	c := caller(ctx, req.UserID)
+
+	// An alarm created since the delete may now have the same settings.
+	deleted, err := s.GetAlarmSnapshot(tx, req.AlarmID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkDuplicate(tx, deleted.ID, deleted.DevEui, deleted.Sensors(), deleted.UserId); err != nil {
+		return nil, err
+	}
+
+	restored, err := s.RestoreAlarm(tx, req.AlarmID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := s.GetAlarmSnapshot(tx, req.AlarmID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.LogAudit(tx, s.AuditLog{
+		AlarmID:    restored.ID,
+		DevEui:     restored.DevEui,
+		ChangeType: "RESTORE",
+		UserID:     c.UserID,
+		IPAddress:  c.IPAddress,
+		Actor:      c.Actor,
+		New:        snapshot,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not log audit: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+
+	return a.GetAlarm(ctx, &als.GetAlarmRequest{AlarmID: req.AlarmID})
+}
@@ -0,0 +1,324 @@
+package alarmservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// CreateAlarmTemplate creates a reusable alarm template, validated as the
+// alarms created from it.
+func (a *AlarmServerAPI) CreateAlarmTemplate(ctx context.Context, req *alsext.CreateAlarmTemplateRequest) (*alsext.CreateAlarmTemplateResponse, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	t := req.Template
+	if err := validateTemplate(tx, t); err != nil {
+		return nil, err
+	}
+	if err := s.CreateAlarmTemplate(tx, &t); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return &alsext.CreateAlarmTemplateResponse{Template: t}, nil
+}
+
+// GetAlarmTemplate returns the template with the given id.
+func (a *AlarmServerAPI) GetAlarmTemplate(ctx context.Context, req *alsext.GetAlarmTemplateRequest) (*alsext.GetAlarmTemplateResponse, error) {
+	t, err := s.GetAlarmTemplate(s.DBContext(ctx), req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	return &alsext.GetAlarmTemplateResponse{Template: t}, nil
+}
+
+// GetAlarmTemplates returns the templates of the given organization.
+func (a *AlarmServerAPI) GetAlarmTemplates(ctx context.Context, req *alsext.GetAlarmTemplatesRequest) (*alsext.GetAlarmTemplatesResponse, error) {
+	templates, err := s.GetAlarmTemplates(s.DBContext(ctx), req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	return &alsext.GetAlarmTemplatesResponse{Templates: templates}, nil
+}
+
+// UpdateAlarmTemplate updates a template and propagates the change to its
+// linked alarms. Fields overridden on an alarm are preserved.
+func (a *AlarmServerAPI) UpdateAlarmTemplate(ctx context.Context, req *alsext.UpdateAlarmTemplateRequest) (*emptypb.Empty, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	t := req.Template
+	t.ID = req.TemplateID
+	if err := validateTemplate(tx, t); err != nil {
+		return nil, err
+	}
+	if err := s.UpdateAlarmTemplate(tx, &t); err != nil {
+		return nil, err
+	}
+	if err := a.syncAlarmTemplate(tx, t.ID, caller(ctx, req.UserID)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// DeleteAlarmTemplate deletes a template. Its alarms are kept as regular
+// alarms and their detach is written to the audit log.
+func (a *AlarmServerAPI) DeleteAlarmTemplate(ctx context.Context, req *alsext.DeleteAlarmTemplateRequest) (*emptypb.Empty, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	c := caller(ctx, req.UserID)
+	err = s.DeleteAlarmTemplate(tx, req.TemplateID, s.AuditAuthor{
+		UserID:    c.UserID,
+		IPAddress: c.IPAddress,
+		Actor:     c.Actor,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ApplyAlarmTemplate links a template to a zone or zone category and creates
+// the matching alarm for every device that is currently in it. Devices added
+// later are picked up by the periodic template sync.
+func (a *AlarmServerAPI) ApplyAlarmTemplate(ctx context.Context, req *alsext.ApplyAlarmTemplateRequest) (*alsext.ApplyAlarmTemplateResponse, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	link := s.AlarmTemplateLink{
+		TemplateID:   req.TemplateID,
+		ZoneID:       req.ZoneID,
+		ZoneCategory: req.ZoneCategory,
+	}
+	if err := s.CreateAlarmTemplateLink(tx, &link); err != nil {
+		return nil, err
+	}
+	if err := a.syncAlarmTemplate(tx, link.TemplateID, caller(ctx, req.UserID)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return &alsext.ApplyAlarmTemplateResponse{Link: link}, nil
+}
+
+// RemoveAlarmTemplateLink unlinks a template from a zone or zone category.
+// Alarms of devices that are no longer covered are detached from the template.
+func (a *AlarmServerAPI) RemoveAlarmTemplateLink(ctx context.Context, req *alsext.RemoveAlarmTemplateLinkRequest) (*emptypb.Empty, error) {
+	db := s.DBContext(ctx)
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	link, err := s.GetAlarmTemplateLink(tx, req.LinkID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DeleteAlarmTemplateLink(tx, link.ID); err != nil {
+		return nil, err
+	}
+	if err := a.syncAlarmTemplate(tx, link.TemplateID, caller(ctx, req.UserID)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// SyncAlarmTemplates reconciles every linked template, each in its own
+// transaction, so that devices added to a linked zone inherit the template.
+// The changes are audited as made by the template sync.
+func (a *AlarmServerAPI) SyncAlarmTemplates(ctx context.Context) error {
+	db := s.DBContext(ctx)
+	ids, err := s.GetAlarmTemplateIDs(db)
+	if err != nil {
+		return err
+	}
+
+	c := identity.Identity{Actor: s.ActorTemplateSync}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tx, err := db.Beginx()
+		if err != nil {
+			return fmt.Errorf("could not start transaction: %w", err)
+		}
+		if err := a.syncAlarmTemplate(tx, id, c); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sync alarm template %d error: %w", id, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit transaction: %w", err)
+		}
+	}
+	return nil
+}
+
+// syncAlarmTemplate creates the alarms of the covered devices that have none
+// yet with createAlarm, then reconciles the linked alarms with the template.
+// A device whose alarm can not be created, e.g. because it already has an
+// alarm for the same sensor, is skipped and picked up again by the next sync.
+func (a *AlarmServerAPI) syncAlarmTemplate(tx *s.TracedTx, templateID int64, c identity.Identity) error {
+	t, err := s.GetAlarmTemplate(tx, templateID)
+	if err != nil {
+		return err
+	}
+	devEuis, err := s.GetAlarmTemplateUncoveredDevices(tx, templateID)
+	if err != nil {
+		return err
+	}
+
+	for _, devEui := range devEuis {
+		if _, err := tx.Exec("savepoint template_alarm"); err != nil {
+			return s.HandlePSQLError(s.Insert, err, "savepoint error")
+		}
+
+		_, err := a.createAlarm(tx, templateAlarm(t, devEui), c, &t)
+		if err != nil {
+			var serr *s.Error
+			var verr *s.ValidationError
+			if !errors.As(err, &serr) && !errors.As(err, &verr) {
+				return err
+			}
+			log.WithError(err).WithFields(log.Fields{
+				"template_id": templateID,
+				"dev_eui":     devEui,
+			}).Warn("create alarm from template error")
+			if _, err := tx.Exec("rollback to savepoint template_alarm"); err != nil {
+				return s.HandlePSQLError(s.Insert, err, "rollback savepoint error")
+			}
+		} else if _, err := tx.Exec("release savepoint template_alarm"); err != nil {
+			return s.HandlePSQLError(s.Insert, err, "release savepoint error")
+		}
+	}
+
+	return s.SyncAlarmTemplate(tx, templateID, s.AuditAuthor{
+		UserID:    c.UserID,
+		IPAddress: c.IPAddress,
+		Actor:     c.Actor,
+	})
+}
+
+// templateAlarm returns the alarm of the given device defined by a template.
+func templateAlarm(t s.AlarmTemplate, devEui string) *als.Alarm {
+	al := &als.Alarm{
+		DevEui:            devEui,
+		MinTreshold:       t.MinTreshold,
+		MaxTreshold:       t.MaxTreshold,
+		Sms:               t.Sms,
+		Email:             t.Email,
+		Notification:      t.Notification,
+		Temperature:       t.Temperature,
+		Humadity:          t.Humadity,
+		Ec:                t.Ec,
+		Door:              t.Door,
+		WLeak:             t.WaterLeak,
+		UserID:            t.UserId,
+		IsTimeLimitActive: t.IsTimeLimitActive,
+		ZoneCategoryID:    t.ZoneCategoryId,
+		NotificationSound: t.NotificationSound,
+		Distance:          t.Distance,
+		DefrostTime:       t.DefrostTime,
+		Pressure:          t.Pressure,
+	}
+	for _, d := range t.Dates {
+		al.AlarmDateTime = append(al.AlarmDateTime, &als.AlarmDateTime{
+			AlarmDay:       d.AlarmDay,
+			AlarmStartTime: d.StartTime,
+			AlarmEndTime:   d.EndTime,
+		})
+	}
+	return al
+}
+
+// changedTemplateFields returns the template fields that the given update
+// changes on a templated alarm, including its date windows.
+func changedTemplateFields(db sqlx.Queryer, current s.Alarm, alarm *als.Alarm) ([]string, error) {
+	var fields []string
+	check := func(field string, changed bool) {
+		if changed {
+			fields = append(fields, field)
+		}
+	}
+
+	check("min_treshold", current.MinTreshold != alarm.MinTreshold)
+	check("max_treshold", current.MaxTreshold != alarm.MaxTreshold)
+	check("sms", current.Sms != alarm.Sms)
+	check("email", current.Email != alarm.Email)
+	check("notification", current.Notification != alarm.Notification)
+	check("is_time_limit_active", current.IsTimeLimitActive != alarm.IsTimeLimitActive)
+	check("notification_sound", current.NotificationSound != alarm.NotificationSound)
+	check("user_id", !equalInt64s(current.UserId, alarm.UserID))
+	check("defrost_time", current.DefrostTime != alarm.DefrostTime)
+
+	var dates []s.AlarmDateFilter
+	err := sqlx.Select(db, &dates, "select * from alarm_date_time where alarm_id = $1 order by id", current.ID)
+	if err != nil {
+		return nil, s.HandlePSQLError(s.Select, err, "select error")
+	}
+	datesChanged := len(dates) != len(alarm.AlarmDateTime)
+	for i := 0; !datesChanged && i < len(dates); i++ {
+		d := alarm.AlarmDateTime[i]
+		datesChanged = dates[i].AlarmDay != d.AlarmDay ||
+			dates[i].AlarmStartTime != d.AlarmStartTime ||
+			dates[i].AlarmEndTime != d.AlarmEndTime
+	}
+	check(s.AlarmDateTimeField, datesChanged)
+
+	return fields, nil
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package alarmservice
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/brocaar/lorawan"
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"github.com/jmoiron/sqlx"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// sensors are the sensor flags of an alarm, an alarm watches exactly one.
+// Door and water leak alarms have no thresholds.
+type sensors struct {
+	temperature, humidity, ec, pressure, distance bool
+	door, waterLeak                               bool
+}
+
+func (f sensors) count() int {
+	n := 0
+	for _, set := range []bool{f.temperature, f.humidity, f.ec, f.pressure, f.distance, f.door, f.waterLeak} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+func (f sensors) hasThresholds() bool {
+	return !f.door && !f.waterLeak
+}
+
+func alarmSensors(al *als.Alarm) sensors {
+	return sensors{
+		temperature: al.Temperature,
+		humidity:    al.Humadity,
+		ec:          al.Ec,
+		pressure:    al.Pressure,
+		distance:    al.Distance,
+		door:        al.Door,
+		waterLeak:   al.WLeak,
+	}
+}
+
+// validateCreate validates an alarm before it is created. The violations
+// are returned together as a *s.ValidationError.
+func validateCreate(db sqlx.Queryer, al *als.Alarm) error {
+	v := &s.ValidationError{}
+	if al == nil {
+		v.Add("alarm", s.ErrAlarmRequired)
+		return v.Err()
+	}
+
+	if err := validateDevEUI(db, v, al.DevEui); err != nil {
+		return err
+	}
+	if err := validateDefinition(db, v, al); err != nil {
+		return err
+	}
+	return v.Err()
+}
+
+// validateTemplate validates an alarm template as the alarms created from
+// it, but for their device.
+func validateTemplate(db sqlx.Queryer, t s.AlarmTemplate) error {
+	v := &s.ValidationError{}
+	if err := validateDefinition(db, v, templateAlarm(t, "")); err != nil {
+		return err
+	}
+	return v.Err()
+}
+
+// validateDefinition adds the violations of the values of an alarm to be
+// created, the device aside, to v.
+func validateDefinition(db sqlx.Queryer, v *s.ValidationError, al *als.Alarm) error {
+	f := alarmSensors(al)
+	switch f.count() {
+	case 0:
+		v.Add("alarm", s.ErrAlarmNoSensor)
+	case 1:
+	default:
+		v.Add("alarm", s.ErrAlarmMultipleSensors)
+	}
+	validateThresholds(v, f, al)
+	validateUsers(v, al.UserID)
+	validateDates(v, al.AlarmDateTime)
+	return validateZoneCategory(db, v, al.ZoneCategoryID)
+}
+
+// validateUpdate validates the new values of the given alarm. The sensor
+// flags, the device and the zone category can not be updated, those of the
+// current alarm are used.
+func validateUpdate(current s.Alarm, al *als.Alarm) error {
+	v := &s.ValidationError{}
+	if al == nil {
+		v.Add("alarm", s.ErrAlarmRequired)
+		return v.Err()
+	}
+
+	f := sensors{
+		temperature: current.Temperature,
+		humidity:    current.Humadity,
+		ec:          current.Ec,
+		pressure:    current.Pressure,
+		distance:    current.Distance,
+		door:        current.Door,
+		waterLeak:   current.WaterLeak,
+	}
+	validateThresholds(v, f, al)
+	validateUsers(v, al.UserID)
+	validateDates(v, al.AlarmDateTime)
+	return v.Err()
+}
+
+func validateDevEUI(db sqlx.Queryer, v *s.ValidationError, devEui string) error {
+	if devEui == "" {
+		v.Add("alarm.dev_eui", s.ErrDevEUIRequired)
+		return nil
+	}
+	var eui lorawan.EUI64
+	if err := eui.UnmarshalText([]byte(devEui)); err != nil {
+		v.Add("alarm.dev_eui", s.ErrDeviceInvalidDevEUI.With("dev_eui", devEui))
+		return nil
+	}
+
+	_, err := s.GetDeviceOrganizationIDs(db, []string{eui.String()})
+	if errors.Is(err, s.ErrDeviceNotFound) {
+		v.Add("alarm.dev_eui", s.ErrDeviceNotFound.With("dev_eui", devEui))
+		return nil
+	}
+	return err
+}
+
+func validateThresholds(v *s.ValidationError, f sensors, al *als.Alarm) {
+	if f.hasThresholds() && al.MinTreshold > al.MaxTreshold {
+		v.Add("alarm.min_treshold", s.ErrAlarmInvalidThreshold)
+	}
+}
+
+func validateUsers(v *s.ValidationError, userIDs []int64) {
+	if len(userIDs) == 0 {
+		v.Add("alarm.user_id", s.ErrAlarmUserRequired)
+		return
+	}
+	for _, id := range userIDs {
+		if id <= 0 {
+			v.Add("alarm.user_id", s.ErrAlarmInvalidUser.With("user_id", strconv.FormatInt(id, 10)))
+		}
+	}
+}
+
+// validateDates checks the date windows: days are weekdays from 0 for
+// Sunday, times are hours of the day.
+func validateDates(v *s.ValidationError, dates []*als.AlarmDateTime) {
+	for _, d := range dates {
+		if d == nil {
+			continue
+		}
+		if d.AlarmDay < 0 || d.AlarmDay > 6 {
+			v.Add("alarm.alarm_date_time.alarm_day", s.ErrScheduleInvalidDay.With("alarm_day", strconv.FormatInt(d.AlarmDay, 10)))
+		}
+		switch {
+		case !validHour(d.AlarmStartTime):
+			v.Add("alarm.alarm_date_time.alarm_start_time", s.ErrScheduleInvalidTime)
+		case !validHour(d.AlarmEndTime):
+			v.Add("alarm.alarm_date_time.alarm_end_time", s.ErrScheduleInvalidTime)
+		case d.AlarmStartTime >= d.AlarmEndTime:
+			v.Add("alarm.alarm_date_time.alarm_start_time", s.ErrScheduleInvalidTimeRange)
+		}
+	}
+}
+
+func validHour(h float32) bool {
+	return h >= 0 && h <= 24
+}
+
+// validateZoneCategory checks the zone category when one is given, 0 means
+// no zone category.
+func validateZoneCategory(db sqlx.Queryer, v *s.ValidationError, zoneCategory int64) error {
+	if zoneCategory == 0 {
+		return nil
+	}
+	ok, err := s.ZoneCategoryExists(db, zoneCategory)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		v.Add("alarm.zone_category_id", s.ErrZoneCategoryNotFound.With("zone_category", strconv.FormatInt(zoneCategory, 10)))
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package alarmservice
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// violations returns the field and code of the violations of err.
+func violations(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var v *s.ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	if !errors.Is(err, s.ErrInvalidArgument) {
+		t.Errorf("error does not match ErrInvalidArgument")
+	}
+	var got []string
+	for _, fv := range v.Violations {
+		got = append(got, fv.Field+" "+fv.Err.Code)
+	}
+	return got
+}
+
+func TestValidateCreate(t *testing.T) {
+	// The dev_euis are missing or invalid and no zone category is given,
+	// the database is not queried.
+	tests := []struct {
+		name  string
+		alarm *als.Alarm
+		want  []string
+	}{
+		{
+			name: "no alarm",
+			want: []string{"alarm ALARM_REQUIRED"},
+		},
+		{
+			name:  "missing dev_eui",
+			alarm: &als.Alarm{Temperature: true, UserID: []int64{1}},
+			want:  []string{"alarm.dev_eui DEVICE_DEV_EUI_REQUIRED"},
+		},
+		{
+			name:  "invalid dev_eui",
+			alarm: &als.Alarm{DevEui: "0102", Temperature: true, UserID: []int64{1}},
+			want:  []string{"alarm.dev_eui DEVICE_INVALID_DEV_EUI"},
+		},
+		{
+			name:  "no sensor",
+			alarm: &als.Alarm{UserID: []int64{1}},
+			want:  []string{"alarm.dev_eui DEVICE_DEV_EUI_REQUIRED", "alarm ALARM_NO_SENSOR"},
+		},
+		{
+			name:  "multiple sensors",
+			alarm: &als.Alarm{Temperature: true, Humadity: true, UserID: []int64{1}},
+			want:  []string{"alarm.dev_eui DEVICE_DEV_EUI_REQUIRED", "alarm ALARM_MULTIPLE_SENSORS"},
+		},
+		{
+			name:  "all violations together",
+			alarm: &als.Alarm{Ec: true, MinTreshold: 5, MaxTreshold: 1, UserID: []int64{0, 2, -3}},
+			want: []string{
+				"alarm.dev_eui DEVICE_DEV_EUI_REQUIRED",
+				"alarm.min_treshold ALARM_INVALID_THRESHOLD",
+				"alarm.user_id ALARM_INVALID_USER",
+				"alarm.user_id ALARM_INVALID_USER",
+			},
+		},
+		{
+			name:  "no user",
+			alarm: &als.Alarm{Door: true},
+			want:  []string{"alarm.dev_eui DEVICE_DEV_EUI_REQUIRED", "alarm.user_id ALARM_USER_REQUIRED"},
+		},
+		{
+			name: "invalid date windows",
+			alarm: &als.Alarm{Door: true, UserID: []int64{1}, AlarmDateTime: []*als.AlarmDateTime{
+				{AlarmDay: 0, AlarmStartTime: 0, AlarmEndTime: 24},
+				{AlarmDay: 7, AlarmStartTime: 8, AlarmEndTime: 17},
+				{AlarmDay: 1, AlarmStartTime: -1, AlarmEndTime: 17},
+				{AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 25},
+				{AlarmDay: 1, AlarmStartTime: 17, AlarmEndTime: 8},
+			}},
+			want: []string{
+				"alarm.dev_eui DEVICE_DEV_EUI_REQUIRED",
+				"alarm.alarm_date_time.alarm_day SCHEDULE_INVALID_DAY",
+				"alarm.alarm_date_time.alarm_start_time SCHEDULE_INVALID_TIME",
+				"alarm.alarm_date_time.alarm_end_time SCHEDULE_INVALID_TIME",
+				"alarm.alarm_date_time.alarm_start_time SCHEDULE_INVALID_TIME_RANGE",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := violations(t, validateCreate(nil, tc.alarm))
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		current s.Alarm
+		alarm   *als.Alarm
+		want    []string
+	}{
+		{
+			name: "no alarm",
+			want: []string{"alarm ALARM_REQUIRED"},
+		},
+		{
+			name:    "valid",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{MinTreshold: 1, MaxTreshold: 5, UserID: []int64{1}},
+		},
+		{
+			name:    "equal thresholds",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{MinTreshold: 5, MaxTreshold: 5, UserID: []int64{1}},
+		},
+		{
+			name:    "inverted thresholds",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{MinTreshold: 5, MaxTreshold: 1, UserID: []int64{1}},
+			want:    []string{"alarm.min_treshold ALARM_INVALID_THRESHOLD"},
+		},
+		{
+			name:    "door alarms have no thresholds",
+			current: s.Alarm{Door: true},
+			alarm:   &als.Alarm{MinTreshold: 5, MaxTreshold: 1, UserID: []int64{1}},
+		},
+		{
+			name:    "water leak alarms have no thresholds",
+			current: s.Alarm{WaterLeak: true},
+			alarm:   &als.Alarm{MinTreshold: 5, MaxTreshold: 1, UserID: []int64{1}},
+		},
+		{
+			name:    "sensor flags of the request are ignored",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{Door: true, MinTreshold: 5, MaxTreshold: 1, UserID: []int64{1}},
+			want:    []string{"alarm.min_treshold ALARM_INVALID_THRESHOLD"},
+		},
+		{
+			name:    "no user",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{},
+			want:    []string{"alarm.user_id ALARM_USER_REQUIRED"},
+		},
+		{
+			name:    "invalid user",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{UserID: []int64{1, -1}},
+			want:    []string{"alarm.user_id ALARM_INVALID_USER"},
+		},
+		{
+			name:    "invalid date window",
+			current: s.Alarm{Temperature: true},
+			alarm:   &als.Alarm{UserID: []int64{1}, AlarmDateTime: []*als.AlarmDateTime{{AlarmDay: 3, AlarmStartTime: 12, AlarmEndTime: 12}}},
+			want:    []string{"alarm.alarm_date_time.alarm_start_time SCHEDULE_INVALID_TIME_RANGE"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := violations(t, validateUpdate(tc.current, tc.alarm))
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	// No zone category is given, the database is not queried.
+	tests := []struct {
+		name     string
+		template s.AlarmTemplate
+		want     []string
+	}{
+		{
+			name:     "valid",
+			template: s.AlarmTemplate{Temperature: true, MinTreshold: 2, MaxTreshold: 8, UserId: []int64{1}},
+		},
+		{
+			name:     "no sensor",
+			template: s.AlarmTemplate{UserId: []int64{1}},
+			want:     []string{"alarm ALARM_NO_SENSOR"},
+		},
+		{
+			name:     "inverted thresholds",
+			template: s.AlarmTemplate{Temperature: true, MinTreshold: 8, MaxTreshold: 2, UserId: []int64{1}},
+			want:     []string{"alarm.min_treshold ALARM_INVALID_THRESHOLD"},
+		},
+		{
+			name: "invalid date window",
+			template: s.AlarmTemplate{Door: true, UserId: []int64{1}, Dates: []s.AlarmTemplateDate{
+				{AlarmDay: 9, StartTime: 8, EndTime: 17},
+			}},
+			want: []string{"alarm.alarm_date_time.alarm_day SCHEDULE_INVALID_DAY"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := violations(t, validateTemplate(nil, tc.template))
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
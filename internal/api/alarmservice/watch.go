@@ -0,0 +1,206 @@
+package alarmservice
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	"github.com/yurttasutkan/alarmservice/internal/api/auth"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+const (
+	// watchBufferSize is the number of events buffered per watch, a watch
+	// falling further behind is ended with ErrWatchLagging.
+	watchBufferSize = 256
+	// replayPageSize is the number of events replayed per query.
+	replayPageSize = 500
+)
+
+// WatchAlarms sends the alarm definition changes and the alarms raised or
+// cleared for an organization or a zone until the stream is done. The zone
+// devices, and those of the zones of a user watching an organization, are
+// those of the zones when the watch starts.
+func (a *AlarmServerAPI) WatchAlarms(req *alsext.WatchAlarmsRequest, stream alsext.AlarmServerExtService_WatchAlarmsServer) error {
+	ctx := stream.Context()
+	db := s.DBContext(ctx)
+
+	// The stream interceptor authenticates the caller, the request is only
+	// known here.
+	p, ok := auth.FromContext(ctx)
+	if !ok && a.authEnabled {
+		return status.Error(codes.Unauthenticated, "authorization token is missing")
+	}
+
+	filter := changefeed.Filter{OrganizationID: req.OrganizationID}
+	switch {
+	case req.OrganizationID != 0:
+	case req.ZoneID != 0:
+		devEuis, err := s.GetZoneDevEuis(db, req.ZoneID)
+		if err != nil {
+			return err
+		}
+		filter.DevEuis = devEuis
+	default:
+		return s.ErrWatchTargetRequired
+	}
+	if ok {
+		if err := auth.AuthorizeWatch(db, p, filter.OrganizationID, filter.DevEuis); err != nil {
+			return err
+		}
+	}
+	// Users only see the alarms of the devices of their zones.
+	if userID := zoneUserID(ctx); userID != 0 && filter.OrganizationID != 0 {
+		devEuis, err := s.GetUserZoneDevEuis(db, userID, filter.OrganizationID)
+		if err != nil {
+			return err
+		}
+		filter.DevEuis = devEuis
+	}
+
+	// Subscribe before replaying, the events committed meanwhile are both
+	// replayed and received and are skipped by their id. An event received
+	// with an id below the last one sent committed late and is sent. Once an
+	// event above the last replayed one is received, the replayed ones were
+	// all received.
+	w := a.events.subscribe(filter)
+	defer a.events.unsubscribe(w)
+
+	replayed := make(map[int64]bool)
+	var lastReplayed int64
+	cursor := req.Cursor
+	for cursor != 0 {
+		events, err := changefeed.Replay(db, cursor, filter, replayPageSize)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			if err := stream.Send(&events[i]); err != nil {
+				return err
+			}
+			replayed[events[i].ID] = true
+			cursor = events[i].ID
+			lastReplayed = cursor
+		}
+		if len(events) < replayPageSize {
+			break
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-a.events.done:
+			return s.ErrWatchClosed
+		case <-w.lagging:
+			return s.ErrWatchLagging
+		case e := <-w.events:
+			if replayed[e.ID] {
+				continue
+			}
+			if replayed != nil && e.ID > lastReplayed {
+				replayed = nil
+			}
+			if err := stream.Send(&e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RunEvents receives the alarm events of all the service replicas and
+// dispatches them to the watches until ctx is done.
+func (a *AlarmServerAPI) RunEvents(ctx context.Context) error {
+	return a.events.run(ctx)
+}
+
+// CloseWatches ends the running watches with ErrWatchClosed and the ones
+// started later right away, their clients resume on another server.
+func (a *AlarmServerAPI) CloseWatches() {
+	a.events.close()
+}
+
+// watch is a WatchAlarms call receiving events.
+type watch struct {
+	filter changefeed.Filter
+	events chan changefeed.Event
+	// lagging is closed when the events buffer overflowed.
+	lagging chan struct{}
+}
+
+// eventHub follows the change feed and dispatches the events to the
+// watches.
+type eventHub struct {
+	dsn string
+
+	mu      sync.Mutex
+	watches map[*watch]struct{}
+
+	// done is closed when the watches are closed.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newEventHub(dsn string) *eventHub {
+	return &eventHub{dsn: dsn, watches: make(map[*watch]struct{}), done: make(chan struct{})}
+}
+
+func (h *eventHub) close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+func (h *eventHub) subscribe(filter changefeed.Filter) *watch {
+	w := &watch{
+		filter:  filter,
+		events:  make(chan changefeed.Event, watchBufferSize),
+		lagging: make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.watches[w] = struct{}{}
+	h.mu.Unlock()
+	return w
+}
+
+func (h *eventHub) unsubscribe(w *watch) {
+	h.mu.Lock()
+	delete(h.watches, w)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) dispatch(e changefeed.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watches {
+		if !w.filter.Match(e) {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			close(w.lagging)
+			delete(h.watches, w)
+		}
+	}
+}
+
+// run follows the change feed, the events missed while the connection was
+// lost are replayed to the watches.
+func (h *eventHub) run(ctx context.Context) error {
+	// The feed blocks until it is connected, wait for the database first.
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-s.Ready():
+	}
+
+	sub := changefeed.NewSubscriber(h.dsn, s.DB(), changefeed.Filter{}, 0)
+	return sub.Run(ctx, func(e changefeed.Event) error {
+		h.dispatch(e)
+		return nil
+	})
+}
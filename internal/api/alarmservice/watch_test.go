@@ -0,0 +1,70 @@
+package alarmservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	s "github.com/yurttasutkan/alarmservice/internal/storage"
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+// testWatchStream is a WatchAlarms stream sending the events to a channel.
+type testWatchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *changefeed.Event
+}
+
+func (ts *testWatchStream) Context() context.Context { return ts.ctx }
+
+func (ts *testWatchStream) Send(e *changefeed.Event) error {
+	ts.events <- e
+	return nil
+}
+
+// waitWatches waits until n watches are subscribed to h.
+func waitWatches(h *eventHub, n int) {
+	for {
+		h.mu.Lock()
+		subscribed := len(h.watches)
+		h.mu.Unlock()
+		if subscribed == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCloseWatches(t *testing.T) {
+	a := &AlarmServerAPI{events: newEventHub("")}
+	stream := &testWatchStream{ctx: context.Background(), events: make(chan *changefeed.Event, 1)}
+	req := &alsext.WatchAlarmsRequest{OrganizationID: 1}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.WatchAlarms(req, stream)
+	}()
+	waitWatches(a.events, 1)
+
+	a.CloseWatches()
+	select {
+	case err := <-done:
+		if !errors.Is(err, s.ErrWatchClosed) {
+			t.Errorf("got error %v, want %v", err, s.ErrWatchClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch not closed")
+	}
+	waitWatches(a.events, 0)
+
+	// Closing twice is fine, the watches started later end right away.
+	a.CloseWatches()
+	if err := a.WatchAlarms(req, stream); !errors.Is(err, s.ErrWatchClosed) {
+		t.Errorf("got error %v, want %v", err, s.ErrWatchClosed)
+	}
+}
@@ -0,0 +1,42 @@
+// Package alsext declares the AlarmServerExtService, the RPCs of the alarm
+// service that the als proto of the ChirpStack API module does not declare.
+// Its messages are Go structs encoded as JSON: clients call the service
+// with the json content-subtype, i.e. the application/grpc+json content
+// type, e.g. with grpc.CallContentSubtype(alsext.CodecName).
+package alsext
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// CodecName is the content-subtype of the JSON codec.
+const CodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// codec encodes the messages as JSON, proto messages with protojson.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return CodecName
+}
@@ -0,0 +1,19 @@
+package alsext
+
+import (
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// VerifyAuditLogRequest selects the organizations whose audit chain is
+// verified. All organizations are verified when OrganizationIDs is empty,
+// which is reserved to global admins.
+type VerifyAuditLogRequest struct {
+	OrganizationIDs []int64 `json:"organization_ids"`
+}
+
+// VerifyAuditLogResponse holds a report per organization. Valid is false
+// when any of the chains is broken.
+type VerifyAuditLogResponse struct {
+	Valid   bool                       `json:"valid"`
+	Reports []storage.AuditChainReport `json:"reports"`
+}
@@ -0,0 +1,44 @@
+package alsext
+
+import (
+	"time"
+
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// SearchAuditLogsRequest filters the audit trail, zero values are ignored.
+// OrganizationID is required unless the caller is a global admin.
+type SearchAuditLogsRequest struct {
+	OrganizationID int64     `json:"organization_id"`
+	AlarmID        int64     `json:"alarm_id"`
+	DevEui         string    `json:"dev_eui"`
+	UserID         int64     `json:"user_id"`
+	ChangeType     string    `json:"change_type"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	Limit          int       `json:"limit"`
+	Offset         int       `json:"offset"`
+}
+
+// AuditLogItem is an audit entry with its decoded before and after values.
+type AuditLogItem struct {
+	ID         int64                      `json:"id"`
+	AlarmID    int64                      `json:"alarm_id"`
+	DevEui     string                     `json:"dev_eui"`
+	ChangeType string                     `json:"change_type"`
+	UserID     int64                      `json:"user_id"`
+	Actor      string                     `json:"actor,omitempty"`
+	ChangedAt  time.Time                  `json:"changed_at"`
+	TableName  string                     `json:"table_name"`
+	IPAddress  string                     `json:"ip_address"`
+	Reason     string                     `json:"reason"`
+	Before     *storage.AlarmSnapshot     `json:"before"`
+	After      *storage.AlarmSnapshot     `json:"after"`
+	Changes    []storage.AlarmFieldChange `json:"changes"`
+}
+
+// SearchAuditLogsResponse holds a page of audit entries and the total count.
+type SearchAuditLogsResponse struct {
+	TotalCount int            `json:"total_count"`
+	Result     []AuditLogItem `json:"result"`
+}
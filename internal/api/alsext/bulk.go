@@ -0,0 +1,52 @@
+package alsext
+
+import (
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+)
+
+// BulkAction defines the operation applied to a single item of a bulk request.
+type BulkAction int
+
+// Possible bulk actions
+const (
+	BulkCreate BulkAction = iota
+	BulkUpdate
+	BulkDelete
+)
+
+// BulkAlarmOperation is a single create, update or delete in a bulk request.
+// AlarmID is used by update and delete, Alarm by create and update.
+type BulkAlarmOperation struct {
+	Action  BulkAction `json:"action"`
+	AlarmID int64      `json:"alarm_id"`
+	Alarm   *als.Alarm `json:"alarm,omitempty"`
+}
+
+// BulkAlarmRequest holds the operations to apply in one transaction.
+// When DryRun is set, every operation is executed and reported but the
+// transaction is rolled back.
+type BulkAlarmRequest struct {
+	Operations []BulkAlarmOperation `json:"operations"`
+	UserID     int64                `json:"user_id"`
+	DryRun     bool                 `json:"dry_run"`
+}
+
+// BulkAlarmResult is the outcome of a single operation, in request order.
+// A failed operation has the status code, e.g. NotFound, the error reason,
+// e.g. ALARM_NOT_FOUND, and the message the call would have failed with.
+type BulkAlarmResult struct {
+	Index   int        `json:"index"`
+	Action  BulkAction `json:"action"`
+	AlarmID int64      `json:"alarm_id"`
+	Alarm   *als.Alarm `json:"alarm,omitempty"`
+	Code    string     `json:"code,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// BulkAlarmResponse holds the per-item results of a bulk request.
+// Committed is false when the request was a dry-run or any item failed.
+type BulkAlarmResponse struct {
+	Results   []BulkAlarmResult `json:"results"`
+	Committed bool              `json:"committed"`
+}
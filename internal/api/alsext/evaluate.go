@@ -0,0 +1,30 @@
+package alsext
+
+import "time"
+
+// The measurement names of EvaluateAlarmsRequest.Values.
+const (
+	MeasurementTemperature = "temperature"
+	MeasurementHumidity    = "humidity"
+	MeasurementEC          = "ec"
+	MeasurementPressure    = "pressure"
+	MeasurementDistance    = "distance"
+	MeasurementDoor        = "door"
+	MeasurementWaterLeak   = "water_leak"
+)
+
+// EvaluateAlarmsRequest holds the measurements of a device, by measurement
+// name. Door and water_leak are 1 when open or leaking, 0 otherwise. Time
+// is when they were measured, now when unset.
+type EvaluateAlarmsRequest struct {
+	DevEui string             `json:"dev_eui"`
+	Values map[string]float64 `json:"values"`
+	Time   *time.Time         `json:"time,omitempty"`
+}
+
+// EvaluateAlarmsResponse holds the ids of the alarms the measurements raised
+// and cleared.
+type EvaluateAlarmsResponse struct {
+	Raised  []int64 `json:"raised"`
+	Cleared []int64 `json:"cleared"`
+}
@@ -0,0 +1,23 @@
+package alsext
+
+import (
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// GetAlarmHistoryRequest identifies the alarm whose versions are returned.
+type GetAlarmHistoryRequest struct {
+	AlarmID int64 `json:"alarm_id"`
+}
+
+// GetAlarmHistoryResponse holds the versions of the alarm, oldest first.
+type GetAlarmHistoryResponse struct {
+	Versions []storage.AlarmVersion `json:"versions"`
+}
+
+// RevertAlarmRequest identifies the alarm and the audit log entry of the
+// version to go back to.
+type RevertAlarmRequest struct {
+	AlarmID int64 `json:"alarm_id"`
+	AuditID int64 `json:"audit_id"`
+	UserID  int64 `json:"user_id"`
+}
@@ -0,0 +1,7 @@
+package alsext
+
+// RestoreAlarmRequest identifies the soft-deleted alarm to bring back.
+type RestoreAlarmRequest struct {
+	AlarmID int64 `json:"alarm_id"`
+	UserID  int64 `json:"user_id"`
+}
@@ -0,0 +1,401 @@
+package alsext
+
+import (
+	"context"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+// ServiceName is the full name of the AlarmServerExtService.
+const ServiceName = "als.AlarmServerExtService"
+
+// AlarmServerExtServiceServer is the server API of the AlarmServerExtService.
+type AlarmServerExtServiceServer interface {
+	// BulkAlarms creates, updates and deletes alarms in one transaction.
+	BulkAlarms(context.Context, *BulkAlarmRequest) (*BulkAlarmResponse, error)
+	// CreateAlarmTemplate creates a reusable alarm template.
+	CreateAlarmTemplate(context.Context, *CreateAlarmTemplateRequest) (*CreateAlarmTemplateResponse, error)
+	// GetAlarmTemplate returns an alarm template.
+	GetAlarmTemplate(context.Context, *GetAlarmTemplateRequest) (*GetAlarmTemplateResponse, error)
+	// GetAlarmTemplates returns the alarm templates of an organization.
+	GetAlarmTemplates(context.Context, *GetAlarmTemplatesRequest) (*GetAlarmTemplatesResponse, error)
+	// UpdateAlarmTemplate updates an alarm template and its linked alarms.
+	UpdateAlarmTemplate(context.Context, *UpdateAlarmTemplateRequest) (*emptypb.Empty, error)
+	// DeleteAlarmTemplate deletes an alarm template, its alarms are kept.
+	DeleteAlarmTemplate(context.Context, *DeleteAlarmTemplateRequest) (*emptypb.Empty, error)
+	// ApplyAlarmTemplate links an alarm template to a zone or zone category.
+	ApplyAlarmTemplate(context.Context, *ApplyAlarmTemplateRequest) (*ApplyAlarmTemplateResponse, error)
+	// RemoveAlarmTemplateLink unlinks an alarm template from a zone or zone category.
+	RemoveAlarmTemplateLink(context.Context, *RemoveAlarmTemplateLinkRequest) (*emptypb.Empty, error)
+	// RestoreAlarm brings back a soft-deleted alarm.
+	RestoreAlarm(context.Context, *RestoreAlarmRequest) (*als.GetAlarmResponse, error)
+	// GetAlarmHistory returns the versions of an alarm from the audit log.
+	GetAlarmHistory(context.Context, *GetAlarmHistoryRequest) (*GetAlarmHistoryResponse, error)
+	// RevertAlarm sets an alarm back to an earlier version.
+	RevertAlarm(context.Context, *RevertAlarmRequest) (*als.GetAlarmResponse, error)
+	// SearchAuditLogs searches the audit log, newest entries first.
+	SearchAuditLogs(context.Context, *SearchAuditLogsRequest) (*SearchAuditLogsResponse, error)
+	// VerifyAuditLog verifies the audit log hash chains.
+	VerifyAuditLog(context.Context, *VerifyAuditLogRequest) (*VerifyAuditLogResponse, error)
+	// EvaluateAlarms checks the measurements of a device against its alarms.
+	EvaluateAlarms(context.Context, *EvaluateAlarmsRequest) (*EvaluateAlarmsResponse, error)
+	// WatchAlarms streams the alarm events of an organization or a zone.
+	WatchAlarms(*WatchAlarmsRequest, AlarmServerExtService_WatchAlarmsServer) error
+}
+
+// RegisterAlarmServerExtServiceServer registers srv on s.
+func RegisterAlarmServerExtServiceServer(s grpc.ServiceRegistrar, srv AlarmServerExtServiceServer) {
+	s.RegisterService(&AlarmServerExtService_ServiceDesc, srv)
+}
+
+func _AlarmServerExtService_BulkAlarms_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BulkAlarmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).BulkAlarms(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/BulkAlarms",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).BulkAlarms(ctx, req.(*BulkAlarmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_CreateAlarmTemplate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAlarmTemplateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).CreateAlarmTemplate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/CreateAlarmTemplate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).CreateAlarmTemplate(ctx, req.(*CreateAlarmTemplateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_GetAlarmTemplate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAlarmTemplateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).GetAlarmTemplate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetAlarmTemplate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).GetAlarmTemplate(ctx, req.(*GetAlarmTemplateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_GetAlarmTemplates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAlarmTemplatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).GetAlarmTemplates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetAlarmTemplates",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).GetAlarmTemplates(ctx, req.(*GetAlarmTemplatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_UpdateAlarmTemplate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateAlarmTemplateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).UpdateAlarmTemplate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/UpdateAlarmTemplate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).UpdateAlarmTemplate(ctx, req.(*UpdateAlarmTemplateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_DeleteAlarmTemplate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAlarmTemplateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).DeleteAlarmTemplate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/DeleteAlarmTemplate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).DeleteAlarmTemplate(ctx, req.(*DeleteAlarmTemplateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_ApplyAlarmTemplate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApplyAlarmTemplateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).ApplyAlarmTemplate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/ApplyAlarmTemplate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).ApplyAlarmTemplate(ctx, req.(*ApplyAlarmTemplateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_RemoveAlarmTemplateLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveAlarmTemplateLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).RemoveAlarmTemplateLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/RemoveAlarmTemplateLink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).RemoveAlarmTemplateLink(ctx, req.(*RemoveAlarmTemplateLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_RestoreAlarm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreAlarmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).RestoreAlarm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/RestoreAlarm",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).RestoreAlarm(ctx, req.(*RestoreAlarmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_GetAlarmHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAlarmHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).GetAlarmHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/GetAlarmHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).GetAlarmHistory(ctx, req.(*GetAlarmHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_RevertAlarm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevertAlarmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).RevertAlarm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/RevertAlarm",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).RevertAlarm(ctx, req.(*RevertAlarmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_SearchAuditLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchAuditLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).SearchAuditLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/SearchAuditLogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).SearchAuditLogs(ctx, req.(*SearchAuditLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_VerifyAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyAuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).VerifyAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/VerifyAuditLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).VerifyAuditLog(ctx, req.(*VerifyAuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_EvaluateAlarms_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvaluateAlarmsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlarmServerExtServiceServer).EvaluateAlarms(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/EvaluateAlarms",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlarmServerExtServiceServer).EvaluateAlarms(ctx, req.(*EvaluateAlarmsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlarmServerExtService_WatchAlarms_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAlarmsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AlarmServerExtServiceServer).WatchAlarms(m, &alarmServerExtServiceWatchAlarmsServer{stream})
+}
+
+// AlarmServerExtService_WatchAlarmsServer is the server stream of
+// WatchAlarms.
+type AlarmServerExtService_WatchAlarmsServer interface {
+	Send(*changefeed.Event) error
+	grpc.ServerStream
+}
+
+type alarmServerExtServiceWatchAlarmsServer struct {
+	grpc.ServerStream
+}
+
+func (x *alarmServerExtServiceWatchAlarmsServer) Send(m *changefeed.Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// AlarmServerExtService_ServiceDesc is the grpc.ServiceDesc of the
+// AlarmServerExtService.
+var AlarmServerExtService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AlarmServerExtServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BulkAlarms",
+			Handler:    _AlarmServerExtService_BulkAlarms_Handler,
+		},
+		{
+			MethodName: "CreateAlarmTemplate",
+			Handler:    _AlarmServerExtService_CreateAlarmTemplate_Handler,
+		},
+		{
+			MethodName: "GetAlarmTemplate",
+			Handler:    _AlarmServerExtService_GetAlarmTemplate_Handler,
+		},
+		{
+			MethodName: "GetAlarmTemplates",
+			Handler:    _AlarmServerExtService_GetAlarmTemplates_Handler,
+		},
+		{
+			MethodName: "UpdateAlarmTemplate",
+			Handler:    _AlarmServerExtService_UpdateAlarmTemplate_Handler,
+		},
+		{
+			MethodName: "DeleteAlarmTemplate",
+			Handler:    _AlarmServerExtService_DeleteAlarmTemplate_Handler,
+		},
+		{
+			MethodName: "ApplyAlarmTemplate",
+			Handler:    _AlarmServerExtService_ApplyAlarmTemplate_Handler,
+		},
+		{
+			MethodName: "RemoveAlarmTemplateLink",
+			Handler:    _AlarmServerExtService_RemoveAlarmTemplateLink_Handler,
+		},
+		{
+			MethodName: "RestoreAlarm",
+			Handler:    _AlarmServerExtService_RestoreAlarm_Handler,
+		},
+		{
+			MethodName: "GetAlarmHistory",
+			Handler:    _AlarmServerExtService_GetAlarmHistory_Handler,
+		},
+		{
+			MethodName: "RevertAlarm",
+			Handler:    _AlarmServerExtService_RevertAlarm_Handler,
+		},
+		{
+			MethodName: "SearchAuditLogs",
+			Handler:    _AlarmServerExtService_SearchAuditLogs_Handler,
+		},
+		{
+			MethodName: "VerifyAuditLog",
+			Handler:    _AlarmServerExtService_VerifyAuditLog_Handler,
+		},
+		{
+			MethodName: "EvaluateAlarms",
+			Handler:    _AlarmServerExtService_EvaluateAlarms_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAlarms",
+			Handler:       _AlarmServerExtService_WatchAlarms_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "alsext",
+}
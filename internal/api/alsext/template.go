@@ -0,0 +1,70 @@
+package alsext
+
+import (
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// CreateAlarmTemplateRequest holds the template to create.
+type CreateAlarmTemplateRequest struct {
+	Template storage.AlarmTemplate `json:"template"`
+}
+
+// CreateAlarmTemplateResponse holds the created template.
+type CreateAlarmTemplateResponse struct {
+	Template storage.AlarmTemplate `json:"template"`
+}
+
+// GetAlarmTemplateRequest identifies the template to return.
+type GetAlarmTemplateRequest struct {
+	TemplateID int64 `json:"template_id"`
+}
+
+// GetAlarmTemplateResponse holds the requested template.
+type GetAlarmTemplateResponse struct {
+	Template storage.AlarmTemplate `json:"template"`
+}
+
+// GetAlarmTemplatesRequest identifies the organization whose templates are
+// returned.
+type GetAlarmTemplatesRequest struct {
+	OrganizationID int64 `json:"organization_id"`
+}
+
+// GetAlarmTemplatesResponse holds the templates of the organization.
+type GetAlarmTemplatesResponse struct {
+	Templates []storage.AlarmTemplate `json:"templates"`
+}
+
+// UpdateAlarmTemplateRequest holds the new values of the template with the
+// given id. The organization of a template can not be changed.
+type UpdateAlarmTemplateRequest struct {
+	TemplateID int64                 `json:"template_id"`
+	Template   storage.AlarmTemplate `json:"template"`
+	UserID     int64                 `json:"user_id"`
+}
+
+// DeleteAlarmTemplateRequest identifies the template to delete.
+type DeleteAlarmTemplateRequest struct {
+	TemplateID int64 `json:"template_id"`
+	UserID     int64 `json:"user_id"`
+}
+
+// ApplyAlarmTemplateRequest links the template to a zone or to a zone
+// category. Exactly one of ZoneID and ZoneCategory is set.
+type ApplyAlarmTemplateRequest struct {
+	TemplateID   int64  `json:"template_id"`
+	ZoneID       *int64 `json:"zone_id,omitempty"`
+	ZoneCategory *int64 `json:"zone_category,omitempty"`
+	UserID       int64  `json:"user_id"`
+}
+
+// ApplyAlarmTemplateResponse holds the created link.
+type ApplyAlarmTemplateResponse struct {
+	Link storage.AlarmTemplateLink `json:"link"`
+}
+
+// RemoveAlarmTemplateLinkRequest identifies the template link to remove.
+type RemoveAlarmTemplateLinkRequest struct {
+	LinkID int64 `json:"link_id"`
+	UserID int64 `json:"user_id"`
+}
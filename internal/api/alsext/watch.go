@@ -0,0 +1,11 @@
+package alsext
+
+// WatchAlarmsRequest selects the alarms to watch, those of an organization
+// or of the devices of a zone. Cursor is the id of the last event received,
+// the events after it are replayed first. With no cursor only the new
+// events are sent.
+type WatchAlarmsRequest struct {
+	OrganizationID int64 `json:"organization_id"`
+	ZoneID         int64 `json:"zone_id"`
+	Cursor         int64 `json:"cursor"`
+}
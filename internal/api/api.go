@@ -1,17 +1,45 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"time"
 
-	"github.com/caarlos0/log"
 	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	log "github.com/sirupsen/logrus"
 	alarm "github.com/yurttasutkan/alarmservice/internal/api/alarmservice"
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	"github.com/yurttasutkan/alarmservice/internal/api/auth"
+	"github.com/yurttasutkan/alarmservice/internal/api/gateway"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/api/ratelimit"
 	"github.com/yurttasutkan/alarmservice/internal/config"
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
-//Sets up the AlarmServer.
-func Setup(conf *config.Config) error {
+// Server is the AlarmServer gRPC API.
+type Server struct {
+	grpcServer *grpc.Server
+	listener   net.Listener
+	health     *healthMonitor
+	alarms     *alarm.AlarmServerAPI
+
+	// httpServer serves the REST/JSON gateway, nil when it is disabled.
+	httpServer   *http.Server
+	httpListener net.Listener
+}
+
+//Sets up the AlarmServer. The server is started by Serve.
+func Setup(conf *config.Config) (*Server, error) {
 
 	//apiConf defines the address which AlarmServer will be listening to.
 	apiConf := conf.AlarmServer.API
@@ -20,19 +48,211 @@ func Setup(conf *config.Config) error {
 		"bind": apiConf.Bind,
 	}).Info("api: starting alarm-server api server")
 
+	//Authentication is only disabled on request, not by a missing secret.
+	if apiConf.JWTSecret == "" && !apiConf.AuthDisabled {
+		return nil, errors.New("api: jwt_secret is not set, set auth_disabled to run without authentication")
+	}
+
+	trustedProxies, err := identity.ParseTrustedProxies(apiConf.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	//Calls are rejected until the database is ready, the health service is
+	//always served. The caller identity is captured first so that auth can
+	//complete it.
+	healthMon := newHealthMonitor()
+	healthMon.AddCheck("database", databaseCheck)
+	for name, check := range providerChecks {
+		healthMon.AddProviderCheck(name, check)
+	}
+	interceptors := []grpc.UnaryServerInterceptor{
+		metrics.UnaryServerInterceptor(),
+		otelgrpc.UnaryServerInterceptor(),
+		identity.UnaryServerInterceptor(trustedProxies),
+		unlessHealthMethod(loggingInterceptor()),
+		errorInterceptor(),
+		unlessHealthMethod(readinessInterceptor(healthMon)),
+	}
+	//The streams go through the same steps, WatchAlarms authorizes its
+	//request itself.
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		otelgrpc.StreamServerInterceptor(),
+		identity.StreamServerInterceptor(trustedProxies),
+		errorStreamInterceptor(),
+		unlessHealthStream(readinessStreamInterceptor(healthMon)),
+	}
+	if !apiConf.AuthDisabled {
+		validator := auth.NewValidator(apiConf.JWTSecret)
+		interceptors = append(interceptors, unlessHealthMethod(validator.UnaryServerInterceptor()))
+		streamInterceptors = append(streamInterceptors, unlessHealthStream(validator.StreamServerInterceptor()))
+	} else {
+		log.Warn("api: auth_disabled is set, authentication is disabled")
+	}
+
+	//Rate limits apply to the authenticated caller.
+	limiter := ratelimit.NewLimiter(apiConf.RateLimit.RateLimits, apiConf.RateLimit.RPC)
+	if limiter.Enabled() {
+		interceptors = append(interceptors, unlessHealthMethod(limiter.UnaryServerInterceptor()))
+		streamInterceptors = append(streamInterceptors, unlessHealthStream(limiter.StreamServerInterceptor()))
+	}
+
+	//The gateway calls the RPCs through the same interceptors.
+	interceptor := chainUnaryInterceptors(interceptors...)
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(interceptor),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+
+	//Serve TLS when a certificate is configured, mutual TLS with a client CA.
+	var tlsConfig *tls.Config
+	if apiConf.TLSCert != "" || apiConf.TLSKey != "" {
+		reloader, err := newCertReloader(apiConf.TLSCert, apiConf.TLSKey, apiConf.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = reloader.TLSConfig()
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		log.WithFields(log.Fields{
+			"tls_cert": apiConf.TLSCert,
+			"mtls":     apiConf.CACert != "",
+		}).Info("api: tls enabled")
+	} else if apiConf.CACert != "" {
+		return nil, errors.New("api: ca_cert requires tls_cert and tls_key")
+	}
+
 	//Initialize the gRPC server.
-	grpcServer := grpc.NewServer()
-	alsAPI := alarm.NewAlarmServerAPI()
+	grpcServer := grpc.NewServer(opts...)
+	alsAPI := alarm.NewAlarmServerAPI(conf)
 	als.RegisterAlarmServerServiceServer(grpcServer, alsAPI)
+	alsext.RegisterAlarmServerExtServiceServer(grpcServer, alsAPI)
+	for name := range grpcServer.GetServiceInfo() {
+		healthMon.AddService(name)
+	}
+	healthpb.RegisterHealthServer(grpcServer, healthMon.server)
+
+	//Reflection lets tools such as grpcurl list and call the services.
+	if apiConf.Reflection {
+		reflection.Register(grpcServer)
+		log.Warn("api: grpc reflection is enabled")
+	}
 
 	//Listen on the given address.
 	lis, err := net.Listen("tcp", apiConf.Bind)
 	if err != nil {
-		log.Fatalf("Start api listener error: %v", err)
+		return nil, fmt.Errorf("start api listener error: %w", err)
 	}
 
-	//Starts the connection.
-	grpcServer.Serve(lis)
+	server := Server{grpcServer: grpcServer, listener: lis, health: healthMon, alarms: alsAPI}
+	if conf.AlarmServer.HTTP.Bind != "" {
+		if err := server.setupGateway(conf.AlarmServer.HTTP.Bind, gateway.Servers{ALS: alsAPI, Ext: alsAPI}, interceptor, tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	return &server, nil
+}
+
+// setupGateway sets up the REST/JSON gateway, served by ServeGateway.
+func (s *Server) setupGateway(bind string, srv gateway.Servers, interceptor grpc.UnaryServerInterceptor, tlsConfig *tls.Config) error {
+	log.WithFields(log.Fields{
+		"bind": bind,
+	}).Info("api: starting rest/json gateway")
+
+	handler, err := gateway.NewHandler(srv, interceptor)
+	if err != nil {
+		return err
+	}
 
+	lis, err := net.Listen("tcp", bind)
+	if err != nil {
+		return fmt.Errorf("start gateway listener error: %w", err)
+	}
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+	}
+
+	s.httpServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.httpListener = lis
+	return nil
+}
+
+// Serve serves the API until Stop is called.
+func (s *Server) Serve() error {
+	return s.grpcServer.Serve(s.listener)
+}
+
+// ServeGateway serves the REST/JSON gateway until Stop is called. It returns
+// right away when the gateway is disabled.
+func (s *Server) ServeGateway() error {
+	if s.httpServer == nil {
+		return nil
+	}
+	if err := s.httpServer.Serve(s.httpListener); err != http.ErrServerClosed {
+		return err
+	}
 	return nil
 }
+
+// MonitorHealth runs the health checks until ctx is done. Calls other than
+// health checks are rejected until the checks passed.
+func (s *Server) MonitorHealth(ctx context.Context) error {
+	return s.health.Run(ctx)
+}
+
+// RunAlarmEvents dispatches the alarm events of all the service replicas to
+// the WatchAlarms calls until ctx is done.
+func (s *Server) RunAlarmEvents(ctx context.Context) error {
+	return s.alarms.RunEvents(ctx)
+}
+
+// SyncAlarmTemplates reconciles the alarms of every linked alarm template.
+func (s *Server) SyncAlarmTemplates(ctx context.Context) error {
+	return s.alarms.SyncAlarmTemplates(ctx)
+}
+
+// Stop reports NOT_SERVING, stops the gateway, closes the watches and waits
+// for the other running calls to finish. When ctx is done first, the
+// remaining calls are canceled.
+func (s *Server) Stop(ctx context.Context) error {
+	s.health.Shutdown()
+	// The watches run until their client leaves, GracefulStop would wait
+	// for them.
+	s.alarms.CloseWatches()
+
+	var gatewayErr error
+	if s.httpServer != nil {
+		gatewayErr = s.httpServer.Shutdown(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return gatewayErr
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// chainUnaryInterceptors chains the interceptors into one, the first is the
+// outermost.
+func chainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/yurttasutkan/alarmservice/internal/config"
+)
+
+func TestSetupRequiresJWTSecret(t *testing.T) {
+	var conf config.Config
+	if _, err := Setup(&conf); err == nil {
+		t.Fatal("expected an error without jwt_secret")
+	}
+}
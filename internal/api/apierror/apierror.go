@@ -0,0 +1,168 @@
+// Package apierror translates the errors of the handlers into gRPC status
+// errors, with details for the clients.
+package apierror
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/ratelimit"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// errorDomain is the domain of the ErrorInfo details.
+const errorDomain = "alarmservice"
+
+// reasonInternal is the ErrorInfo reason of the errors outside of the
+// storage error catalog.
+const reasonInternal = "INTERNAL"
+
+// errInternal is returned to the clients in place of the errors outside of
+// the storage error catalog, whose text may hold database details.
+var errInternal = errors.New("internal error")
+
+// foreignKeyViolation is the type of the PreconditionFailure violations
+// returned for foreign key violations.
+const foreignKeyViolation = "FOREIGN_KEY"
+
+// Locales of the LocalizedMessage details.
+var locales = map[string]string{
+	storage.LangEN: "en-US",
+	storage.LangTR: "tr-TR",
+}
+
+// localizer is implemented by the errors of the storage error catalog.
+type localizer interface {
+	LocalizedMessage(lang string) string
+}
+
+// IsInternal returns true for the errors that Status returns as
+// errInternal. They are to be logged.
+func IsInternal(err error) bool {
+	if _, ok := status.FromError(err); ok {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var catalogErr *storage.Error
+	return !errors.As(err, &catalogErr)
+}
+
+// Status returns the status error of err. The errors of the storage
+// catalog get an ErrorInfo with their code and metadata, and their English
+// and Turkish messages as LocalizedMessage details. Rate limited calls get
+// a RetryInfo. Other errors become errInternal.
+func Status(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	var catalogErr *storage.Error
+	if !errors.As(err, &catalogErr) {
+		return statusWithDetails(codes.Internal, errInternal, &errdetails.ErrorInfo{
+			Reason: reasonInternal,
+			Domain: errorDomain,
+		})
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason:   catalogErr.Code,
+		Domain:   errorDomain,
+		Metadata: catalogErr.Metadata,
+	}
+	details := []proto.Message{info}
+	var l localizer
+	if errors.As(err, &l) {
+		for _, lang := range []string{storage.LangEN, storage.LangTR} {
+			details = append(details, &errdetails.LocalizedMessage{
+				Locale:  locales[lang],
+				Message: l.LocalizedMessage(lang),
+			})
+		}
+	}
+
+	var (
+		validation  *storage.ValidationError
+		foreignKey  *storage.ForeignKeyError
+		rateLimited *ratelimit.Error
+	)
+	if errors.As(err, &validation) {
+		// The codes of the violations, by field.
+		info.Metadata = make(map[string]string)
+		br := &errdetails.BadRequest{}
+		for _, v := range validation.Violations {
+			if v.Field != "" {
+				info.Metadata[v.Field] = v.Err.Code
+			}
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Err.Error(),
+			})
+		}
+		details = append(details, br)
+	}
+	if errors.As(err, &foreignKey) {
+		details = append(details, &errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        foreignKeyViolation,
+				Subject:     foreignKey.Table + "." + foreignKey.Constraint,
+				Description: foreignKey.Detail,
+			}},
+		})
+	}
+	if errors.As(err, &rateLimited) {
+		details = append(details,
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(rateLimited.RetryAfter)},
+			&errdetails.QuotaFailure{
+				Violations: []*errdetails.QuotaFailure_Violation{{
+					Subject:     rateLimited.Subject,
+					Description: rateLimited.Error(),
+				}},
+			})
+	}
+
+	return statusWithDetails(code(err), err, details...)
+}
+
+// code returns the code of a catalog error, by its kind.
+func code(err error) codes.Code {
+	switch {
+	case errors.Is(err, storage.ErrDoesNotExist):
+		return codes.NotFound
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return codes.AlreadyExists
+	case errors.Is(err, storage.ErrInvalidArgument):
+		return codes.InvalidArgument
+	case errors.Is(err, storage.ErrUsedByOtherObjects), errors.Is(err, storage.ErrReferenceDoesNotExist):
+		return codes.FailedPrecondition
+	case errors.Is(err, storage.ErrUnavailable):
+		return codes.Unavailable
+	case errors.Is(err, storage.ErrResourceExhausted):
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+// statusWithDetails returns a status error with the given details.
+func statusWithDetails(code codes.Code, err error, details ...proto.Message) error {
+	st := status.New(code, err.Error())
+	withDetails, detailsErr := st.WithDetails(details...)
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
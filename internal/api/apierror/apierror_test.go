@@ -0,0 +1,205 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/ratelimit"
+	"github.com/yurttasutkan/alarmservice/internal/config"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{storage.ErrAlarmNotFound, codes.NotFound},
+		{storage.ErrAlarmNotFound.With("alarm_id", "1"), codes.NotFound},
+		{storage.ErrAlarmAlreadyExists, codes.AlreadyExists},
+		{storage.ErrAlarmInvalidThreshold, codes.InvalidArgument},
+		{&storage.ValidationError{}, codes.InvalidArgument},
+		{storage.ErrUsedByOtherObjects, codes.FailedPrecondition},
+		{storage.ErrReferenceDoesNotExist, codes.FailedPrecondition},
+		{storage.ErrNotificationFailed, codes.Unavailable},
+		{storage.ErrWatchLagging, codes.Unavailable},
+		{storage.ErrRateLimited, codes.ResourceExhausted},
+		{fmt.Errorf("wrapped: %w", storage.ErrAlarmNotFound), codes.NotFound},
+		{errors.New("other"), codes.Internal},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			if got := code(tc.err); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	validation := &storage.ValidationError{}
+	validation.Add("min_treshold", storage.ErrAlarmInvalidThreshold)
+
+	fkErr := storage.HandlePSQLError(storage.Delete, &pq.Error{Code: "23503", Table: "alarm_date_time", Constraint: "alarm_date_time_alarm_id_fkey"}, "delete error")
+
+	limiter := ratelimit.NewLimiter(config.RateLimits{Caller: config.RateLimit{Rate: 0.001, Burst: 1}}, nil)
+	_ = limiter.Allow("/als.AlarmServerService/GetAlarm", "user:1", "")
+	rateErr := limiter.Allow("/als.AlarmServerService/GetAlarm", "user:1", "")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantMessage string
+		wantReason  string
+		// wantMetadata are entries of the ErrorInfo metadata.
+		wantMetadata map[string]string
+		wantDetails  []string
+	}{
+		{
+			name:        "status error as is",
+			err:         status.Error(codes.PermissionDenied, "permission denied"),
+			wantCode:    codes.PermissionDenied,
+			wantMessage: "permission denied",
+		},
+		{
+			name:        "canceled",
+			err:         fmt.Errorf("select error: %w", context.Canceled),
+			wantCode:    codes.Canceled,
+			wantMessage: "select error: context canceled",
+		},
+		{
+			name:        "deadline exceeded",
+			err:         context.DeadlineExceeded,
+			wantCode:    codes.DeadlineExceeded,
+			wantMessage: context.DeadlineExceeded.Error(),
+		},
+		{
+			name:        "internal error hides its detail",
+			err:         errors.New(`pq: relation "alarm_refactor2" does not exist`),
+			wantCode:    codes.Internal,
+			wantMessage: errInternal.Error(),
+			wantReason:  reasonInternal,
+			wantDetails: []string{"ErrorInfo"},
+		},
+		{
+			name:         "catalog error",
+			err:          storage.ErrAlarmNotFound.With("alarm_id", "12"),
+			wantCode:     codes.NotFound,
+			wantMessage:  "alarm does not exist (alarm_id=12)",
+			wantReason:   "ALARM_NOT_FOUND",
+			wantMetadata: map[string]string{"alarm_id": "12"},
+			wantDetails:  []string{"ErrorInfo", "LocalizedMessage", "LocalizedMessage"},
+		},
+		{
+			name:         "validation error",
+			err:          validation,
+			wantCode:     codes.InvalidArgument,
+			wantMessage:  validation.Error(),
+			wantReason:   "INVALID_ARGUMENT",
+			wantMetadata: map[string]string{"min_treshold": "ALARM_INVALID_THRESHOLD"},
+			wantDetails:  []string{"ErrorInfo", "LocalizedMessage", "LocalizedMessage", "BadRequest"},
+		},
+		{
+			name:        "foreign key error",
+			err:         fkErr,
+			wantCode:    codes.FailedPrecondition,
+			wantMessage: storage.ErrUsedByOtherObjects.Error(),
+			wantReason:  "USED_BY_OTHER_OBJECTS",
+			wantDetails: []string{"ErrorInfo", "LocalizedMessage", "LocalizedMessage", "PreconditionFailure"},
+		},
+		{
+			name:         "rate limited",
+			err:          rateErr,
+			wantCode:     codes.ResourceExhausted,
+			wantMessage:  rateErr.Error(),
+			wantReason:   "RATE_LIMITED",
+			wantMetadata: map[string]string{"subject": "user:1"},
+			wantDetails:  []string{"ErrorInfo", "LocalizedMessage", "LocalizedMessage", "RetryInfo", "QuotaFailure"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			st, ok := status.FromError(Status(tc.err))
+			if !ok {
+				t.Fatal("not a status error")
+			}
+			if st.Code() != tc.wantCode {
+				t.Errorf("got code %s, want %s", st.Code(), tc.wantCode)
+			}
+			if st.Message() != tc.wantMessage {
+				t.Errorf("got message %q, want %q", st.Message(), tc.wantMessage)
+			}
+
+			var details []string
+			for _, d := range st.Details() {
+				switch d := d.(type) {
+				case *errdetails.ErrorInfo:
+					details = append(details, "ErrorInfo")
+					if d.Reason != tc.wantReason {
+						t.Errorf("got reason %s, want %s", d.Reason, tc.wantReason)
+					}
+					if d.Domain != errorDomain {
+						t.Errorf("got domain %s", d.Domain)
+					}
+					for k, v := range tc.wantMetadata {
+						if d.Metadata[k] != v {
+							t.Errorf("got metadata %s=%s, want %s", k, d.Metadata[k], v)
+						}
+					}
+				case *errdetails.LocalizedMessage:
+					details = append(details, "LocalizedMessage")
+				case *errdetails.BadRequest:
+					details = append(details, "BadRequest")
+				case *errdetails.PreconditionFailure:
+					details = append(details, "PreconditionFailure")
+				case *errdetails.RetryInfo:
+					details = append(details, "RetryInfo")
+					if d.RetryDelay.AsDuration() <= time.Duration(0) {
+						t.Errorf("got retry delay %s", d.RetryDelay.AsDuration())
+					}
+				case *errdetails.QuotaFailure:
+					details = append(details, "QuotaFailure")
+				default:
+					t.Errorf("unexpected detail %T", d)
+				}
+			}
+			if fmt.Sprint(details) != fmt.Sprint(tc.wantDetails) {
+				t.Errorf("got details %v, want %v", details, tc.wantDetails)
+			}
+		})
+	}
+}
+
+func TestIsInternal(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"status error", status.Error(codes.NotFound, "not found"), false},
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"catalog error", storage.ErrAlarmNotFound, false},
+		{"validation error", &storage.ValidationError{}, false},
+		{"other error", errors.New("connection refused"), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsInternal(tc.err); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package auth authenticates gRPC calls with ChirpStack JWT tokens and API
+// keys and authorizes them against the organization owning the alarms.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/logging"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// Token subjects as issued by ChirpStack.
+const (
+	SubjectUser   = "user"
+	SubjectAPIKey = "api_key"
+)
+
+// audience is the audience of the tokens issued by the ChirpStack
+// application-server.
+const audience = "as"
+
+// Claims are the claims of a ChirpStack token. User tokens carry the user id,
+// older ones only the username. API keys carry the key id.
+type Claims struct {
+	jwt.RegisteredClaims
+	Username string `json:"username"`
+	UserID   int64  `json:"user_id"`
+	APIKeyID string `json:"api_key_id"`
+}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// UserID is set for user tokens.
+	UserID   int64
+	Username string
+	// APIKeyID is set for API keys.
+	APIKeyID string
+	// OrganizationID is the organization an organization or application
+	// API key is limited to.
+	OrganizationID int64
+	IsAdmin        bool
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given principal.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of ctx.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Validator validates the tokens signed with the ChirpStack JWT secret.
+type Validator struct {
+	secret []byte
+}
+
+// NewValidator creates a Validator for the given JWT secret.
+func NewValidator(secret string) *Validator {
+	return &Validator{secret: []byte(secret)}
+}
+
+// UnaryServerInterceptor authenticates every call, authorizes it for the
+// request and stores the principal in the context of the handler.
+func (v *Validator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, err := v.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := Authorize(storage.DBContext(ctx), p, req); err != nil {
+			return nil, err
+		}
+		return handler(withPrincipal(ctx, p), req)
+	}
+}
+
+// StreamServerInterceptor authenticates every stream and stores the
+// principal in the context of the handler. The request of a stream is only
+// received by the handler, which authorizes it.
+func (v *Validator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		p, err := v.Authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, identity.WithContext(ss, withPrincipal(ss.Context(), p)))
+	}
+}
+
+// withPrincipal returns a copy of ctx carrying the principal, with the
+// caller identity and the request log completed.
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	fields := log.Fields{logging.FieldUserID: p.UserID}
+	if p.OrganizationID != 0 {
+		fields[logging.FieldOrganizationID] = p.OrganizationID
+	}
+	logging.AddFields(ctx, fields)
+
+	id := identity.FromContext(ctx)
+	id.UserID = p.UserID
+	id.Authenticated = true
+	return identity.NewContext(NewContext(ctx, p), id)
+}
+
+// Authenticate validates the token in the authorization metadata of ctx and
+// returns its principal.
+func (v *Validator) Authenticate(ctx context.Context) (Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return Principal{}, status.Error(codes.Unauthenticated, "authorization token is missing")
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return v.secret, nil
+	})
+	if err != nil {
+		return Principal{}, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+	if !claims.VerifyAudience(audience, true) {
+		return Principal{}, status.Error(codes.Unauthenticated, "invalid token audience")
+	}
+
+	p, err := principalFromClaims(storage.DBContext(ctx), claims)
+	if err == storage.ErrDoesNotExist {
+		return Principal{}, status.Error(codes.Unauthenticated, "token subject does not exist")
+	}
+	return p, err
+}
+
+func principalFromClaims(db sqlx.Queryer, claims Claims) (Principal, error) {
+	switch claims.Subject {
+	case SubjectUser:
+		var u storage.User
+		var err error
+		if claims.UserID != 0 {
+			u, err = storage.GetUser(db, claims.UserID)
+		} else {
+			u, err = storage.GetUserByUsername(db, claims.Username)
+		}
+		if err != nil {
+			return Principal{}, err
+		}
+		if !u.IsActive {
+			return Principal{}, status.Error(codes.Unauthenticated, "user is not active")
+		}
+		return Principal{UserID: u.ID, Username: u.Username, IsAdmin: u.IsAdmin}, nil
+
+	case SubjectAPIKey:
+		k, err := storage.GetAPIKey(db, claims.APIKeyID)
+		if err != nil {
+			return Principal{}, err
+		}
+		p := Principal{APIKeyID: k.ID, IsAdmin: k.IsAdmin}
+		switch {
+		case k.OrganizationID != nil:
+			p.OrganizationID = *k.OrganizationID
+		case k.ApplicationID != nil:
+			if p.OrganizationID, err = storage.GetApplicationOrganizationID(db, *k.ApplicationID); err != nil {
+				return Principal{}, err
+			}
+		}
+		return p, nil
+
+	default:
+		return Principal{}, status.Errorf(codes.Unauthenticated, "invalid token subject: %s", claims.Subject)
+	}
+}
+
+// CanAccessOrganization returns true when the principal is admin or belongs
+// to the organization.
+func (p Principal) CanAccessOrganization(db sqlx.Queryer, organizationID int64) (bool, error) {
+	switch {
+	case p.IsAdmin:
+		return true, nil
+	case p.APIKeyID != "":
+		return p.OrganizationID != 0 && p.OrganizationID == organizationID, nil
+	default:
+		return storage.IsOrganizationUser(db, organizationID, p.UserID)
+	}
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+var errPermissionDenied = status.Error(codes.PermissionDenied, "permission denied")
+
+// Authorize checks that the principal may execute the given request. Alarms
+// belong to the organization owning their device, admin-only requests
+// require a global admin. Unknown requests are admin-only.
+func Authorize(db sqlx.Queryer, p Principal, req interface{}) error {
+	if p.IsAdmin {
+		return nil
+	}
+
+	switch r := req.(type) {
+	case *als.CreateAlarmRequest:
+		if r.Alarm == nil {
+			return storage.ErrAlarmRequired
+		}
+		return authorizeDevices(db, p, r.Alarm.DevEui)
+	case *als.UpdateAlarmRequest:
+		if err := authorizeAlarm(db, p, r.AlarmID); err != nil {
+			return err
+		}
+		if r.Alarm != nil && r.Alarm.DevEui != "" {
+			return authorizeDevices(db, p, r.Alarm.DevEui)
+		}
+		return nil
+	case *als.DeleteAlarmRequest:
+		return authorizeAlarm(db, p, r.AlarmID)
+	case *als.DeleteAlarmDatesRequest:
+		return authorizeAlarm(db, p, r.AlarmId)
+	case *als.DeleteSensorAlarmRequest:
+		return authorizeDevices(db, p, r.DevEuis...)
+	case *als.DeleteAlarmDevEuiRequest:
+		return authorizeDevices(db, p, r.Deveui)
+	case *als.GetAlarmRequest:
+		return authorizeAlarm(db, p, r.AlarmID)
+	case *als.GetAlarmLogsRequest:
+		return authorizeDevices(db, p, r.DevEui)
+	case *als.GetAlarmDatesRequest:
+		return authorizeAlarm(db, p, r.AlarmId)
+	case *als.GetAlarmListRequest:
+		if r.Filter != nil && r.Filter.DevEui != "" {
+			return authorizeDevices(db, p, r.Filter.DevEui)
+		}
+		if r.Filter != nil && r.Filter.UserID != 0 && r.Filter.UserID == p.UserID {
+			return nil
+		}
+		return errPermissionDenied
+	case *als.GetOrganizationAlarmListRequest:
+		return authorizeOrganization(db, p, r.OrganizationID)
+	case *alsext.BulkAlarmRequest:
+		return authorizeBulk(db, p, r)
+	case *alsext.RestoreAlarmRequest:
+		return authorizeAlarm(db, p, r.AlarmID)
+	case *alsext.GetAlarmHistoryRequest:
+		return authorizeAlarm(db, p, r.AlarmID)
+	case *alsext.RevertAlarmRequest:
+		return authorizeAlarm(db, p, r.AlarmID)
+	case *alsext.SearchAuditLogsRequest:
+		if r.OrganizationID == 0 {
+			return errPermissionDenied
+		}
+		return authorizeOrganization(db, p, r.OrganizationID)
+	case *alsext.VerifyAuditLogRequest:
+		if len(r.OrganizationIDs) == 0 {
+			return errPermissionDenied
+		}
+		for _, organizationID := range r.OrganizationIDs {
+			if err := authorizeOrganization(db, p, organizationID); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *alsext.CreateAlarmTemplateRequest:
+		return authorizeOrganization(db, p, r.Template.OrganizationID)
+	case *alsext.GetAlarmTemplateRequest:
+		return authorizeTemplate(db, p, r.TemplateID, nil)
+	case *alsext.GetAlarmTemplatesRequest:
+		return authorizeOrganization(db, p, r.OrganizationID)
+	case *alsext.UpdateAlarmTemplateRequest:
+		return authorizeTemplate(db, p, r.TemplateID, nil)
+	case *alsext.DeleteAlarmTemplateRequest:
+		return authorizeTemplate(db, p, r.TemplateID, nil)
+	case *alsext.ApplyAlarmTemplateRequest:
+		return authorizeTemplate(db, p, r.TemplateID, &storage.AlarmTemplateLink{
+			ZoneID:       r.ZoneID,
+			ZoneCategory: r.ZoneCategory,
+		})
+	case *alsext.RemoveAlarmTemplateLinkRequest:
+		l, err := storage.GetAlarmTemplateLink(db, r.LinkID)
+		if errors.Is(err, storage.ErrDoesNotExist) {
+			return errPermissionDenied
+		}
+		if err != nil {
+			return err
+		}
+		return authorizeTemplate(db, p, l.TemplateID, nil)
+	default:
+		// DeleteZoneAlarm, DeleteUserAlarm, EvaluateAlarms and unknown
+		// requests.
+		return errPermissionDenied
+	}
+}
+
+// AuthorizeWatch checks that the principal may watch the alarms of the given
+// organization, or of the devices of a zone. The request of a stream is not
+// seen by the stream interceptor, the handler calls it. Only admins may
+// watch a zone without devices, its organization is unknown. Users watching
+// an organization are further limited to the devices of their zones by the
+// handler.
+func AuthorizeWatch(db sqlx.Queryer, p Principal, organizationID int64, zoneDevEuis []string) error {
+	switch {
+	case p.IsAdmin:
+		return nil
+	case organizationID != 0:
+		return authorizeOrganization(db, p, organizationID)
+	case len(zoneDevEuis) == 0:
+		return errPermissionDenied
+	default:
+		return authorizeDevices(db, p, zoneDevEuis...)
+	}
+}
+
+// authorizeBulk authorizes every operation of a bulk request as the single
+// create, update or delete request.
+func authorizeBulk(db sqlx.Queryer, p Principal, r *alsext.BulkAlarmRequest) error {
+	for _, op := range r.Operations {
+		var req interface{}
+		switch op.Action {
+		case alsext.BulkCreate:
+			req = &als.CreateAlarmRequest{Alarm: op.Alarm}
+		case alsext.BulkUpdate:
+			req = &als.UpdateAlarmRequest{AlarmID: op.AlarmID, Alarm: op.Alarm}
+		case alsext.BulkDelete:
+			req = &als.DeleteAlarmRequest{AlarmID: op.AlarmID}
+		default:
+			return errPermissionDenied
+		}
+		if err := Authorize(db, p, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorizeTemplate checks that the principal can access the organization
+// of the template and, for users, that the devices covered by the template,
+// and by the given link when it is not nil, are in the zones assigned to
+// the user.
+func authorizeTemplate(db sqlx.Queryer, p Principal, templateID int64, link *storage.AlarmTemplateLink) error {
+	t, err := storage.GetAlarmTemplate(db, templateID)
+	if errors.Is(err, storage.ErrDoesNotExist) {
+		return errPermissionDenied
+	}
+	if err != nil {
+		return err
+	}
+	if err := authorizeOrganization(db, p, t.OrganizationID); err != nil {
+		return err
+	}
+	if p.UserID == 0 {
+		return nil
+	}
+
+	devEuis, err := storage.GetAlarmTemplateDevices(db, templateID)
+	if err != nil {
+		return err
+	}
+	if link != nil {
+		linked, err := storage.GetAlarmTemplateLinkDevices(db, t.OrganizationID, *link)
+		if err != nil {
+			return err
+		}
+		devEuis = append(devEuis, linked...)
+	}
+	if len(devEuis) == 0 {
+		return nil
+	}
+	ok, err := storage.AreDevicesInUserZones(db, p.UserID, devEuis)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errPermissionDenied
+	}
+	return nil
+}
+
+func authorizeOrganization(db sqlx.Queryer, p Principal, organizationID int64) error {
+	ok, err := p.CanAccessOrganization(db, organizationID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errPermissionDenied
+	}
+	return nil
+}
+
+// authorizeDevices checks that the principal can access the organizations
+// of all given devices and, for users, that the devices are in the zones
+// assigned to the user. Unknown devices are denied.
+func authorizeDevices(db sqlx.Queryer, p Principal, devEuis ...string) error {
+	if len(devEuis) == 0 {
+		return storage.ErrDevEUIRequired
+	}
+	organizationIDs, err := storage.GetDeviceOrganizationIDs(db, devEuis)
+	if errors.Is(err, storage.ErrDoesNotExist) {
+		return errPermissionDenied
+	}
+	if err != nil {
+		return err
+	}
+	for _, organizationID := range organizationIDs {
+		if err := authorizeOrganization(db, p, organizationID); err != nil {
+			return err
+		}
+	}
+
+	if p.UserID != 0 {
+		ok, err := storage.AreDevicesInUserZones(db, p.UserID, devEuis)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errPermissionDenied
+		}
+	}
+	return nil
+}
+
+func authorizeAlarm(db sqlx.Queryer, p Principal, alarmID int64) error {
+	devEui, err := storage.GetAlarmDevEui(db, alarmID)
+	if errors.Is(err, storage.ErrDoesNotExist) {
+		return errPermissionDenied
+	}
+	if err != nil {
+		return err
+	}
+	return authorizeDevices(db, p, devEui)
+}
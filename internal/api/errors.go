@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/apierror"
+	"github.com/yurttasutkan/alarmservice/internal/logging"
+)
+
+// errorInterceptor translates the errors of the handlers into gRPC status
+// errors, with details for the clients. Status errors are returned as is.
+// The errors outside of the storage error catalog are logged and returned
+// as a generic internal error.
+func errorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			if apierror.IsInternal(err) {
+				logging.FromContext(ctx).WithError(err).Error("api: internal error")
+			}
+			err = apierror.Status(err)
+		}
+		return resp, err
+	}
+}
+
+// errorStreamInterceptor is errorInterceptor for the streams.
+func errorStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if err != nil {
+			if apierror.IsInternal(err) {
+				logging.FromContext(ss.Context()).WithError(err).Error("api: internal error")
+			}
+			err = apierror.Status(err)
+		}
+		return err
+	}
+}
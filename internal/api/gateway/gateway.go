@@ -0,0 +1,447 @@
+// Package gateway exposes the AlarmServerService and AlarmServerExtService
+// RPCs as a REST/JSON API. Calls go through the same interceptors as the
+// gRPC API, so they share its authentication, authorization and caller
+// identity.
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+)
+
+// maxBodySize is the maximum size of a request body.
+const maxBodySize = 4 << 20
+
+// metadataHeaderPrefix prefixes the HTTP headers forwarded as gRPC metadata,
+// next to the headers in forwardedHeaders.
+const metadataHeaderPrefix = "Grpc-Metadata-"
+
+// forwardedHeaders are the HTTP headers forwarded as gRPC metadata: the
+// credentials, the client address, the request id, the idempotency key and
+// the trace context.
+var forwardedHeaders = map[string]bool{
+	"Authorization":   true,
+	"X-Forwarded-For": true,
+	"X-Request-Id":    true,
+	"Idempotency-Key": true,
+	"Traceparent":     true,
+	"Tracestate":      true,
+	"Baggage":         true,
+}
+
+var (
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+)
+
+// Handler serves the REST/JSON API.
+type Handler struct {
+	srv         Servers
+	interceptor grpc.UnaryServerInterceptor
+	openAPI     []byte
+}
+
+// NewHandler creates the REST/JSON handler for the given services. Every
+// call runs through interceptor as the gRPC method of its service.
+func NewHandler(srv Servers, interceptor grpc.UnaryServerInterceptor) (*Handler, error) {
+	doc, err := json.MarshalIndent(openAPIDocument(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal openapi document error: %w", err)
+	}
+	return &Handler{
+		srv:         srv,
+		interceptor: interceptor,
+		openAPI:     doc,
+	}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == openAPIPath {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(h.openAPI)
+		return
+	}
+
+	rt, params := match(r.Method, r.URL.Path)
+	if rt == nil {
+		if methods := allowedMethods(r.URL.Path); len(methods) != 0 {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeStatus(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "method not allowed"))
+		} else {
+			writeError(w, status.Error(codes.NotFound, "not found"))
+		}
+		return
+	}
+
+	req, err := h.decodeRequest(r, rt, params)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	info := grpc.UnaryServerInfo{
+		Server:     h.srv.ALS,
+		FullMethod: "/" + als.AlarmServerService_ServiceDesc.ServiceName + "/" + rt.rpc,
+	}
+	if rt.ext {
+		info.Server = h.srv.Ext
+		info.FullMethod = "/" + alsext.ServiceName + "/" + rt.rpc
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return rt.call(ctx, h.srv, req)
+	}
+
+	resp, err := h.interceptor(incomingContext(r), req, &info, handler)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	b, err := marshalResponse(resp)
+	if err != nil {
+		writeError(w, status.Errorf(codes.Internal, "marshal response error: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// decodeRequest builds the request from the JSON body, the query parameters
+// and the path parameters. Later sources override earlier ones.
+func (h *Handler) decodeRequest(r *http.Request, rt *route, params map[string]string) (interface{}, error) {
+	req := rt.newRequest()
+
+	if rt.body {
+		b, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "read body error: %v", err)
+		}
+		if len(strings.TrimSpace(string(b))) != 0 {
+			if err := unmarshalRequest(b, req); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid json body: %v", err)
+			}
+		}
+	}
+
+	for key, values := range r.URL.Query() {
+		for _, v := range values {
+			if err := setRequestField(req, key, v); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "query parameter %s: %v", key, err)
+			}
+		}
+	}
+	for key, v := range params {
+		if err := setRequestField(req, key, v); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "path parameter %s: %v", key, err)
+		}
+	}
+
+	return req, nil
+}
+
+// unmarshalRequest decodes a JSON body, proto messages with protojson.
+func unmarshalRequest(b []byte, req interface{}) error {
+	if m, ok := req.(proto.Message); ok {
+		return unmarshalOptions.Unmarshal(b, m)
+	}
+	return json.Unmarshal(b, req)
+}
+
+// marshalResponse encodes a response as JSON, proto messages with protojson.
+func marshalResponse(resp interface{}) ([]byte, error) {
+	if m, ok := resp.(proto.Message); ok {
+		return marshalOptions.Marshal(m)
+	}
+	return json.Marshal(resp)
+}
+
+// setRequestField sets the field at the dotted path of a proto message, or
+// the top level field of a Go struct.
+func setRequestField(req interface{}, path string, value string) error {
+	if m, ok := req.(proto.Message); ok {
+		return setField(m.ProtoReflect(), path, value)
+	}
+	return setStructField(reflect.ValueOf(req).Elem(), path, value)
+}
+
+// incomingContext returns the context of a call as the gRPC server would
+// build it: the client address as peer and the forwarded headers as metadata.
+func incomingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		switch {
+		case forwardedHeaders[key]:
+			md.Append(strings.ToLower(key), values...)
+		case strings.HasPrefix(key, metadataHeaderPrefix):
+			md.Append(strings.ToLower(strings.TrimPrefix(key, metadataHeaderPrefix)), values...)
+		}
+	}
+
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	return peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(r.RemoteAddr)})
+}
+
+// remoteAddr is the address of an HTTP client.
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+func (a remoteAddr) String() string  { return string(a) }
+
+// setField sets the field at the dotted path, e.g. filter.dev_eui, to the
+// given value. Names are matched ignoring case and underscores so that both
+// the proto and the JSON names are accepted. Repeated fields are appended to.
+func setField(m protoreflect.Message, path string, value string) error {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		fd := findField(m.Descriptor(), part)
+		if fd == nil {
+			return fmt.Errorf("unknown field %s", part)
+		}
+
+		if i < len(parts)-1 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return fmt.Errorf("field %s is not a message", part)
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+
+		if fd.IsMap() || (fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind) {
+			return fmt.Errorf("field %s can not be set from a string", part)
+		}
+		v, err := parseValue(fd, value)
+		if err != nil {
+			return err
+		}
+		if fd.IsList() {
+			m.Mutable(fd).List().Append(v)
+		} else {
+			m.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+// setStructField sets the field of a Go struct with the given JSON name to
+// the given value. Names are matched as by setField. Slices are appended to.
+func setStructField(v reflect.Value, name string, value string) error {
+	i, ok := structField(v.Type(), name)
+	if !ok {
+		return fmt.Errorf("unknown field %s", name)
+	}
+	f := v.Field(i)
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		elem := reflect.New(f.Type().Elem()).Elem()
+		if err := parseStructValue(elem, value); err != nil {
+			return err
+		}
+		f.Set(reflect.Append(f, elem))
+		return nil
+	}
+	return parseStructValue(f, value)
+}
+
+// structField returns the index of the exported field of t with the given
+// JSON name.
+func structField(t reflect.Type, name string) (int, bool) {
+	n := normalizeName(name)
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); sf.IsExported() && normalizeName(jsonName(sf)) == n {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// jsonName returns the JSON name of a struct field.
+func jsonName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+func parseStructValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		v.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		v.SetInt(i)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		v.SetUint(u)
+		return err
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		v.SetFloat(f)
+		return err
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := parseStructValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	default:
+		return fmt.Errorf("field of type %s can not be set from a string", v.Type())
+	}
+}
+
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	n := normalizeName(name)
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if normalizeName(string(fd.Name())) == n || normalizeName(fd.JSONName()) == n {
+			return fd
+		}
+	}
+	return nil
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+func parseValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(s)
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+	}
+}
+
+// httpStatus maps gRPC codes to HTTP status codes.
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+}
+
+// errorBody is the JSON body of an error response.
+type errorBody struct {
+	Code    int               `json:"code"`
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code, ok := httpStatus[st.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	if code >= http.StatusInternalServerError {
+		log.WithError(err).Error("gateway: call error")
+	}
+	writeStatus(w, code, st)
+}
+
+func writeStatus(w http.ResponseWriter, code int, st *status.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.RetryDelay != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ri.RetryDelay.AsDuration().Seconds()))))
+		}
+	}
+	w.WriteHeader(code)
+	body := errorBody{
+		Code:    int(st.Code()),
+		Status:  st.Code().String(),
+		Message: st.Message(),
+	}
+	// The details are encoded as google.protobuf.Any, with their @type.
+	for _, d := range st.Proto().GetDetails() {
+		b, err := protojson.Marshal(d)
+		if err != nil {
+			continue
+		}
+		body.Details = append(body.Details, b)
+	}
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,350 @@
+package gateway
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// openAPIPath is the path of the OpenAPI document.
+const openAPIPath = "/api/openapi.json"
+
+// openAPIDocument describes the routes as an OpenAPI 3 document, the schemas
+// are derived from the proto messages and the alsext Go structs.
+func openAPIDocument() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	for _, rt := range routes {
+		var params []interface{}
+		pathParams := make(map[string]bool)
+		for _, segment := range splitPath(rt.path) {
+			name, ok := pathParam(segment)
+			if !ok {
+				continue
+			}
+			pathParams[normalizeName(name)] = true
+			param := map[string]interface{}{"name": name, "in": "path", "required": true}
+			if schema := requestFieldSchema(rt.newRequest(), name, schemas); schema != nil {
+				param["schema"] = schema
+			}
+			params = append(params, param)
+		}
+		if !rt.body {
+			params = append(params, requestQueryParams(rt.newRequest(), pathParams, schemas)...)
+		}
+		if rt.idempotent {
+			params = append(params, map[string]interface{}{
+				"name":        "Idempotency-Key",
+				"in":          "header",
+				"description": "Retries with the same key return the result of the first request.",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+
+		op := map[string]interface{}{
+			"operationId": rt.rpc,
+			"summary":     rt.summary,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK",
+					"content":     jsonContent(valueSchemaOf(rt.newResponse(), schemas)),
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/Error"}),
+				},
+			},
+		}
+		if len(params) != 0 {
+			op["parameters"] = params
+		}
+		if rt.body {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(valueSchemaOf(rt.newRequest(), schemas)),
+			}
+		}
+
+		item, ok := paths[rt.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+
+	schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code":    map[string]interface{}{"type": "integer", "description": "gRPC status code."},
+			"status":  map[string]interface{}{"type": "string"},
+			"message": map[string]interface{}{"type": "string"},
+			"details": map[string]interface{}{
+				"type":        "array",
+				"description": "google.rpc error details, e.g. ErrorInfo and BadRequest, identified by @type.",
+				"items":       map[string]interface{}{"type": "object"},
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Alarm Service API",
+			"version": "1.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []interface{}{}},
+		},
+	}
+}
+
+// valueSchemaOf returns the schema of a request or response, a proto message
+// or a Go struct.
+func valueSchemaOf(v interface{}, schemas map[string]interface{}) map[string]interface{} {
+	if m, ok := v.(proto.Message); ok {
+		return messageSchema(m.ProtoReflect().Descriptor(), schemas)
+	}
+	return typeSchema(reflect.TypeOf(v), schemas)
+}
+
+// requestFieldSchema returns the schema of the request field with the given
+// name, nil when there is none.
+func requestFieldSchema(req interface{}, name string, schemas map[string]interface{}) map[string]interface{} {
+	if m, ok := req.(proto.Message); ok {
+		if fd := findField(m.ProtoReflect().Descriptor(), name); fd != nil {
+			return fieldSchema(fd, schemas)
+		}
+		return nil
+	}
+	t := reflect.TypeOf(req).Elem()
+	if i, ok := structField(t, name); ok {
+		return typeSchema(t.Field(i).Type, schemas)
+	}
+	return nil
+}
+
+// requestQueryParams lists the query parameters of a request: the scalar
+// fields of a proto message, or the top level scalar fields of a Go struct.
+func requestQueryParams(req interface{}, skip map[string]bool, schemas map[string]interface{}) []interface{} {
+	if m, ok := req.(proto.Message); ok {
+		return queryParams(m.ProtoReflect().Descriptor(), "", skip, schemas)
+	}
+	var params []interface{}
+	t := reflect.TypeOf(req).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := jsonName(sf)
+		if !sf.IsExported() || skip[normalizeName(name)] {
+			continue
+		}
+		schema := typeSchema(sf.Type, schemas)
+		if _, ok := schema["$ref"]; ok {
+			continue
+		}
+		params = append(params, map[string]interface{}{
+			"name":   name,
+			"in":     "query",
+			"schema": schema,
+		})
+	}
+	return params
+}
+
+// typeSchema returns the schema of a Go type following the encoding/json
+// mapping. Structs are added to schemas, the ones of proto messages with a
+// _struct suffix as their JSON differs from protojson.
+func typeSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+	default:
+		return map[string]interface{}{}
+	}
+
+	name := path.Base(t.PkgPath()) + "_" + t.Name()
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*proto.Message)(nil)).Elem()) {
+		name += "_struct"
+	}
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+
+	properties := make(map[string]interface{})
+	schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+	structProperties(t, properties, schemas)
+	return ref
+}
+
+// structProperties adds the JSON properties of the fields of t, the fields
+// of embedded structs are flattened as by encoding/json.
+func structProperties(t reflect.Type, properties map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("json") == "-" {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("json") == "" {
+			structProperties(sf.Type, properties, schemas)
+			continue
+		}
+		if sf.IsExported() {
+			properties[jsonName(sf)] = typeSchema(sf.Type, schemas)
+		}
+	}
+}
+
+// queryParams lists the scalar fields of a request as query parameters,
+// fields of nested messages with a dotted name.
+func queryParams(md protoreflect.MessageDescriptor, prefix string, skip map[string]bool, schemas map[string]interface{}) []interface{} {
+	var params []interface{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if prefix == "" && skip[normalizeName(string(fd.Name()))] {
+			continue
+		}
+		name := prefix + string(fd.Name())
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			if prefix == "" && !isWellKnown(fd.Message()) {
+				params = append(params, queryParams(fd.Message(), name+".", skip, schemas)...)
+			}
+			continue
+		}
+		if fd.IsMap() || fd.Kind() == protoreflect.GroupKind || fd.Kind() == protoreflect.MessageKind {
+			continue
+		}
+		params = append(params, map[string]interface{}{
+			"name":   name,
+			"in":     "query",
+			"schema": fieldSchema(fd, schemas),
+		})
+	}
+	return params
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// messageSchema returns a reference to the schema of the message, adding it
+// to schemas when missing.
+func messageSchema(md protoreflect.MessageDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return map[string]interface{}{"type": "string"}
+	}
+
+	name := strings.ReplaceAll(string(md.FullName()), ".", "_")
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+
+	properties := make(map[string]interface{})
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	schemas[name] = schema // Set before the fields, for recursive messages.
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		properties[string(fd.Name())] = fieldSchema(fd, schemas)
+	}
+	return ref
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	if fd.IsMap() {
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": valueSchema(fd.MapValue(), schemas),
+		}
+	}
+	if fd.IsList() {
+		return map[string]interface{}{
+			"type":  "array",
+			"items": valueSchema(fd, schemas),
+		}
+	}
+	return valueSchema(fd, schemas)
+}
+
+// valueSchema returns the schema of a single value of the field, following
+// the protojson mapping.
+func valueSchema(fd protoreflect.FieldDescriptor, schemas map[string]interface{}) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings.
+		return map[string]interface{}{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case protoreflect.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		var values []interface{}
+		ev := fd.Enum().Values()
+		for i := 0; i < ev.Len(); i++ {
+			values = append(values, string(ev.Get(i).Name()))
+		}
+		return map[string]interface{}{"type": "string", "enum": values}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageSchema(fd.Message(), schemas)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func isWellKnown(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile() != nil && strings.HasPrefix(string(md.ParentFile().Package()), "google.protobuf")
+}
@@ -0,0 +1,424 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/alsext"
+)
+
+// route maps an HTTP method and path to an RPC of the als service, or of
+// the alsext service when ext is set. Path segments in braces, e.g.
+// {alarm_id}, are set on the request field of the same name. Idempotent
+// routes accept an Idempotency-Key header. The requests and responses are
+// proto messages, or JSON encoded Go structs for the alsext service.
+type route struct {
+	method      string
+	path        string
+	rpc         string
+	summary     string
+	ext         bool
+	body        bool
+	idempotent  bool
+	newRequest  func() interface{}
+	newResponse func() interface{}
+	call        func(ctx context.Context, srv Servers, req interface{}) (interface{}, error)
+}
+
+// Servers are the services the gateway calls.
+type Servers struct {
+	ALS als.AlarmServerServiceServer
+	Ext alsext.AlarmServerExtServiceServer
+}
+
+func newEmpty() interface{} { return &emptypb.Empty{} }
+
+var routes = []route{
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms",
+		rpc:         "CreateAlarm",
+		summary:     "Create an alarm.",
+		body:        true,
+		idempotent:  true,
+		newRequest:  func() interface{} { return &als.CreateAlarmRequest{} },
+		newResponse: func() interface{} { return &als.CreateAlarmResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.CreateAlarm(ctx, req.(*als.CreateAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/alarms",
+		rpc:         "GetAlarmList",
+		summary:     "List the alarms matching the filter.",
+		newRequest:  func() interface{} { return &als.GetAlarmListRequest{} },
+		newResponse: func() interface{} { return &als.GetAlarmListResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.GetAlarmList(ctx, req.(*als.GetAlarmListRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/alarms/{alarm_id}",
+		rpc:         "GetAlarm",
+		summary:     "Get an alarm.",
+		newRequest:  func() interface{} { return &als.GetAlarmRequest{} },
+		newResponse: func() interface{} { return &als.GetAlarmResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.GetAlarm(ctx, req.(*als.GetAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodPut,
+		path:        "/api/alarms/{alarm_id}",
+		rpc:         "UpdateAlarm",
+		summary:     "Update an alarm.",
+		body:        true,
+		newRequest:  func() interface{} { return &als.UpdateAlarmRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.UpdateAlarm(ctx, req.(*als.UpdateAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodDelete,
+		path:        "/api/alarms/{alarm_id}",
+		rpc:         "DeleteAlarm",
+		summary:     "Delete an alarm.",
+		newRequest:  func() interface{} { return &als.DeleteAlarmRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.DeleteAlarm(ctx, req.(*als.DeleteAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/alarms/{alarm_id}/dates",
+		rpc:         "GetAlarmDates",
+		summary:     "Get the active time ranges of an alarm.",
+		newRequest:  func() interface{} { return &als.GetAlarmDatesRequest{} },
+		newResponse: func() interface{} { return &als.GetAlarmDatesResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.GetAlarmDates(ctx, req.(*als.GetAlarmDatesRequest))
+		},
+	},
+	{
+		method:      http.MethodDelete,
+		path:        "/api/alarms/{alarm_id}/dates",
+		rpc:         "DeleteAlarmDates",
+		summary:     "Delete the active time ranges of an alarm.",
+		newRequest:  func() interface{} { return &als.DeleteAlarmDatesRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.DeleteAlarmDates(ctx, req.(*als.DeleteAlarmDatesRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms/delete-by-devices",
+		rpc:         "DeleteSensorAlarm",
+		summary:     "Delete the alarms of the given devices.",
+		body:        true,
+		newRequest:  func() interface{} { return &als.DeleteSensorAlarmRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.DeleteSensorAlarm(ctx, req.(*als.DeleteSensorAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms/delete-by-zones",
+		rpc:         "DeleteZoneAlarm",
+		summary:     "Delete the alarms of the devices in the given zones.",
+		body:        true,
+		newRequest:  func() interface{} { return &als.DeleteZoneAlarmRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.DeleteZoneAlarm(ctx, req.(*als.DeleteZoneAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms/delete-by-users",
+		rpc:         "DeleteUserAlarm",
+		summary:     "Delete the alarms of the given users.",
+		body:        true,
+		newRequest:  func() interface{} { return &als.DeleteUserAlarmRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.DeleteUserAlarm(ctx, req.(*als.DeleteUserAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/devices/{dev_eui}/alarm-logs",
+		rpc:         "GetAlarmLogs",
+		summary:     "Get the alarm change logs of a device.",
+		newRequest:  func() interface{} { return &als.GetAlarmLogsRequest{} },
+		newResponse: func() interface{} { return &als.GetAlarmLogsResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.GetAlarmLogs(ctx, req.(*als.GetAlarmLogsRequest))
+		},
+	},
+	{
+		method:      http.MethodDelete,
+		path:        "/api/devices/{deveui}/alarms",
+		rpc:         "DeleteAlarmDevEui",
+		summary:     "Delete the alarms of a device.",
+		newRequest:  func() interface{} { return &als.DeleteAlarmDevEuiRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.DeleteAlarmDevEui(ctx, req.(*als.DeleteAlarmDevEuiRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/organizations/{organization_id}/alarms",
+		rpc:         "GetOrganizationAlarmList",
+		summary:     "List the alarms of an organization.",
+		newRequest:  func() interface{} { return &als.GetOrganizationAlarmListRequest{} },
+		newResponse: func() interface{} { return &als.GetOrganizationAlarmListResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.ALS.GetOrganizationAlarmList(ctx, req.(*als.GetOrganizationAlarmListRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms/bulk",
+		rpc:         "BulkAlarms",
+		summary:     "Create, update and delete alarms in one transaction.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.BulkAlarmRequest{} },
+		newResponse: func() interface{} { return &alsext.BulkAlarmResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.BulkAlarms(ctx, req.(*alsext.BulkAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarm-templates",
+		rpc:         "CreateAlarmTemplate",
+		summary:     "Create an alarm template.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.CreateAlarmTemplateRequest{} },
+		newResponse: func() interface{} { return &alsext.CreateAlarmTemplateResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.CreateAlarmTemplate(ctx, req.(*alsext.CreateAlarmTemplateRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/alarm-templates",
+		rpc:         "GetAlarmTemplates",
+		summary:     "List the alarm templates of an organization.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.GetAlarmTemplatesRequest{} },
+		newResponse: func() interface{} { return &alsext.GetAlarmTemplatesResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.GetAlarmTemplates(ctx, req.(*alsext.GetAlarmTemplatesRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/alarm-templates/{template_id}",
+		rpc:         "GetAlarmTemplate",
+		summary:     "Get an alarm template.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.GetAlarmTemplateRequest{} },
+		newResponse: func() interface{} { return &alsext.GetAlarmTemplateResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.GetAlarmTemplate(ctx, req.(*alsext.GetAlarmTemplateRequest))
+		},
+	},
+	{
+		method:      http.MethodPut,
+		path:        "/api/alarm-templates/{template_id}",
+		rpc:         "UpdateAlarmTemplate",
+		summary:     "Update an alarm template and its linked alarms.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.UpdateAlarmTemplateRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.UpdateAlarmTemplate(ctx, req.(*alsext.UpdateAlarmTemplateRequest))
+		},
+	},
+	{
+		method:      http.MethodDelete,
+		path:        "/api/alarm-templates/{template_id}",
+		rpc:         "DeleteAlarmTemplate",
+		summary:     "Delete an alarm template, its alarms are kept.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.DeleteAlarmTemplateRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.DeleteAlarmTemplate(ctx, req.(*alsext.DeleteAlarmTemplateRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarm-templates/{template_id}/links",
+		rpc:         "ApplyAlarmTemplate",
+		summary:     "Link an alarm template to a zone or zone category.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.ApplyAlarmTemplateRequest{} },
+		newResponse: func() interface{} { return &alsext.ApplyAlarmTemplateResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.ApplyAlarmTemplate(ctx, req.(*alsext.ApplyAlarmTemplateRequest))
+		},
+	},
+	{
+		method:      http.MethodDelete,
+		path:        "/api/alarm-template-links/{link_id}",
+		rpc:         "RemoveAlarmTemplateLink",
+		summary:     "Unlink an alarm template from a zone or zone category.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.RemoveAlarmTemplateLinkRequest{} },
+		newResponse: newEmpty,
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.RemoveAlarmTemplateLink(ctx, req.(*alsext.RemoveAlarmTemplateLinkRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms/{alarm_id}/restore",
+		rpc:         "RestoreAlarm",
+		summary:     "Restore a deleted alarm.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.RestoreAlarmRequest{} },
+		newResponse: func() interface{} { return &als.GetAlarmResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.RestoreAlarm(ctx, req.(*alsext.RestoreAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/alarms/{alarm_id}/history",
+		rpc:         "GetAlarmHistory",
+		summary:     "List the versions of an alarm.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.GetAlarmHistoryRequest{} },
+		newResponse: func() interface{} { return &alsext.GetAlarmHistoryResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.GetAlarmHistory(ctx, req.(*alsext.GetAlarmHistoryRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/alarms/{alarm_id}/revert",
+		rpc:         "RevertAlarm",
+		summary:     "Set an alarm back to an earlier version.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.RevertAlarmRequest{} },
+		newResponse: func() interface{} { return &als.GetAlarmResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.RevertAlarm(ctx, req.(*alsext.RevertAlarmRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/audit-logs",
+		rpc:         "SearchAuditLogs",
+		summary:     "Search the audit log, newest entries first.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.SearchAuditLogsRequest{} },
+		newResponse: func() interface{} { return &alsext.SearchAuditLogsResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.SearchAuditLogs(ctx, req.(*alsext.SearchAuditLogsRequest))
+		},
+	},
+	{
+		method:      http.MethodGet,
+		path:        "/api/audit-logs/verify",
+		rpc:         "VerifyAuditLog",
+		summary:     "Verify the audit log hash chains.",
+		ext:         true,
+		newRequest:  func() interface{} { return &alsext.VerifyAuditLogRequest{} },
+		newResponse: func() interface{} { return &alsext.VerifyAuditLogResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.VerifyAuditLog(ctx, req.(*alsext.VerifyAuditLogRequest))
+		},
+	},
+	{
+		method:      http.MethodPost,
+		path:        "/api/devices/{dev_eui}/evaluate",
+		rpc:         "EvaluateAlarms",
+		summary:     "Check the measurements of a device against its alarms.",
+		ext:         true,
+		body:        true,
+		newRequest:  func() interface{} { return &alsext.EvaluateAlarmsRequest{} },
+		newResponse: func() interface{} { return &alsext.EvaluateAlarmsResponse{} },
+		call: func(ctx context.Context, srv Servers, req interface{}) (interface{}, error) {
+			return srv.Ext.EvaluateAlarms(ctx, req.(*alsext.EvaluateAlarmsRequest))
+		},
+	},
+}
+
+// match returns the route of the given method and path with its path
+// parameters.
+func match(method, path string) (*route, map[string]string) {
+	segments := splitPath(path)
+	for i := range routes {
+		if routes[i].method != method {
+			continue
+		}
+		if params, ok := matchPath(splitPath(routes[i].path), segments); ok {
+			return &routes[i], params
+		}
+	}
+	return nil, nil
+}
+
+// allowedMethods returns the methods of the routes matching the path.
+func allowedMethods(path string) []string {
+	var methods []string
+	segments := splitPath(path)
+	for _, rt := range routes {
+		if _, ok := matchPath(splitPath(rt.path), segments); ok {
+			methods = append(methods, rt.method)
+		}
+	}
+	return methods
+}
+
+func matchPath(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, p := range pattern {
+		if name, ok := pathParam(p); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[name] = segments[i]
+			continue
+		}
+		if p != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// pathParam returns the name of a {name} path segment.
+func pathParam(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
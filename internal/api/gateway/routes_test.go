@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantRPC    string
+		wantParams map[string]string
+	}{
+		{
+			name:       "collection",
+			method:     http.MethodGet,
+			path:       "/api/alarms",
+			wantRPC:    "GetAlarmList",
+			wantParams: map[string]string{},
+		},
+		{
+			name:       "same path, other method",
+			method:     http.MethodPost,
+			path:       "/api/alarms",
+			wantRPC:    "CreateAlarm",
+			wantParams: map[string]string{},
+		},
+		{
+			name:       "path parameter",
+			method:     http.MethodGet,
+			path:       "/api/alarms/12",
+			wantRPC:    "GetAlarm",
+			wantParams: map[string]string{"alarm_id": "12"},
+		},
+		{
+			name:       "trailing slash",
+			method:     http.MethodDelete,
+			path:       "/api/alarms/12/",
+			wantRPC:    "DeleteAlarm",
+			wantParams: map[string]string{"alarm_id": "12"},
+		},
+		{
+			name:       "nested path parameter",
+			method:     http.MethodPost,
+			path:       "/api/alarm-templates/3/links",
+			wantRPC:    "ApplyAlarmTemplate",
+			wantParams: map[string]string{"template_id": "3"},
+		},
+		{
+			name:       "static segment before parameter",
+			method:     http.MethodPost,
+			path:       "/api/alarms/bulk",
+			wantRPC:    "BulkAlarms",
+			wantParams: map[string]string{},
+		},
+		{
+			name:       "static sub-resource",
+			method:     http.MethodGet,
+			path:       "/api/audit-logs/verify",
+			wantRPC:    "VerifyAuditLog",
+			wantParams: map[string]string{},
+		},
+		{
+			name:   "unknown method",
+			method: http.MethodPatch,
+			path:   "/api/alarms/12",
+		},
+		{
+			name:   "unknown path",
+			method: http.MethodGet,
+			path:   "/api/unknown",
+		},
+		{
+			name:   "too many segments",
+			method: http.MethodGet,
+			path:   "/api/alarms/12/dates/1",
+		},
+		{
+			name:   "empty path parameter",
+			method: http.MethodGet,
+			path:   "/api/organizations//alarms",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rt, params := match(tc.method, tc.path)
+			if tc.wantRPC == "" {
+				if rt != nil {
+					t.Fatalf("got route %s, want none", rt.rpc)
+				}
+				return
+			}
+			if rt == nil {
+				t.Fatalf("got no route, want %s", tc.wantRPC)
+			}
+			if rt.rpc != tc.wantRPC {
+				t.Errorf("got route %s, want %s", rt.rpc, tc.wantRPC)
+			}
+			if !reflect.DeepEqual(params, tc.wantParams) {
+				t.Errorf("got params %v, want %v", params, tc.wantParams)
+			}
+		})
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		path       string
+		wantOK     bool
+		wantParams map[string]string
+	}{
+		{
+			name:       "static",
+			pattern:    "/api/alarms",
+			path:       "/api/alarms",
+			wantOK:     true,
+			wantParams: map[string]string{},
+		},
+		{
+			name:       "parameters",
+			pattern:    "/api/{kind}/{id}",
+			path:       "/api/alarms/1",
+			wantOK:     true,
+			wantParams: map[string]string{"kind": "alarms", "id": "1"},
+		},
+		{
+			name:    "static mismatch",
+			pattern: "/api/alarms",
+			path:    "/api/alarm",
+		},
+		{
+			name:    "case sensitive",
+			pattern: "/api/alarms",
+			path:    "/API/alarms",
+		},
+		{
+			name:    "shorter path",
+			pattern: "/api/alarms/{alarm_id}",
+			path:    "/api/alarms",
+		},
+		{
+			name:    "longer path",
+			pattern: "/api/alarms",
+			path:    "/api/alarms/1",
+		},
+		{
+			name:    "empty parameter",
+			pattern: "/api/alarms/{alarm_id}/dates",
+			path:    "/api/alarms//dates",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			params, ok := matchPath(splitPath(tc.pattern), splitPath(tc.path))
+			if ok != tc.wantOK {
+				t.Fatalf("got ok %t, want %t", ok, tc.wantOK)
+			}
+			if ok && !reflect.DeepEqual(params, tc.wantParams) {
+				t.Errorf("got params %v, want %v", params, tc.wantParams)
+			}
+		})
+	}
+}
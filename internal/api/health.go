@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+const (
+	healthCheckInterval = 5 * time.Second
+	healthCheckTimeout  = 2 * time.Second
+
+	// healthServicePrefix prefixes the health service name of a subsystem,
+	// e.g. alarmservice.database.
+	healthServicePrefix = "alarmservice."
+)
+
+// HealthCheck checks a subsystem, such as the database or a notification
+// provider.
+type HealthCheck func(ctx context.Context) error
+
+// healthMonitor runs the subsystem checks and reports them through the
+// grpc.health.v1 service. The overall status, the empty service name, and
+// the status of the API services are SERVING only when all checks pass.
+type healthMonitor struct {
+	server   *health.Server
+	services []string
+
+	mu     sync.Mutex
+	checks map[string]healthCheck
+	ready  bool
+}
+
+// healthCheck is a registered check. The overall status only depends on the
+// critical checks.
+type healthCheck struct {
+	check    HealthCheck
+	critical bool
+}
+
+func newHealthMonitor() *healthMonitor {
+	m := healthMonitor{
+		server:   health.NewServer(),
+		services: []string{""},
+		checks:   make(map[string]healthCheck),
+	}
+	m.setOverall(healthpb.HealthCheckResponse_NOT_SERVING)
+	return &m
+}
+
+// AddService registers a gRPC service that follows the overall status.
+func (m *healthMonitor) AddService(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.services = append(m.services, name)
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if m.ready {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	m.server.SetServingStatus(name, st)
+}
+
+// AddCheck registers the check of a subsystem the service can not run
+// without, it is reported as NOT_SERVING until it passed.
+func (m *healthMonitor) AddCheck(name string, check HealthCheck) {
+	m.addCheck(name, healthCheck{check: check, critical: true})
+}
+
+// AddProviderCheck registers the check of a notification provider. It is
+// reported under its own name but does not change the overall status: the
+// alarms are still served while a provider is down.
+func (m *healthMonitor) AddProviderCheck(name string, check HealthCheck) {
+	m.addCheck(name, healthCheck{check: check})
+}
+
+func (m *healthMonitor) addCheck(name string, c healthCheck) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks[name] = c
+	m.server.SetServingStatus(healthServicePrefix+name, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Run runs the checks at a fixed interval until ctx is done, and right away
+// once storage is set up.
+func (m *healthMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	storageReady := storage.Ready()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-storageReady:
+			storageReady = nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ready returns true when the last run of the checks passed.
+func (m *healthMonitor) Ready() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ready
+}
+
+// Shutdown reports NOT_SERVING for every service, ignoring later updates.
+func (m *healthMonitor) Shutdown() {
+	m.server.Shutdown()
+}
+
+func (m *healthMonitor) check(ctx context.Context) {
+	m.mu.Lock()
+	checks := make(map[string]healthCheck, len(m.checks))
+	for name, c := range m.checks {
+		checks[name] = c
+	}
+	m.mu.Unlock()
+
+	// The checks run concurrently so that a slow provider does not delay
+	// the database check.
+	var wg sync.WaitGroup
+	failed := make(chan bool, len(checks))
+	for name, c := range checks {
+		wg.Add(1)
+		go func(name string, c healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			err := c.check(ctx)
+			cancel()
+
+			st := healthpb.HealthCheckResponse_SERVING
+			if err != nil {
+				failed <- c.critical
+				st = healthpb.HealthCheckResponse_NOT_SERVING
+				log.WithError(err).WithField("subsystem", name).Warn("api: health check failed")
+			}
+			m.server.SetServingStatus(healthServicePrefix+name, st)
+		}(name, c)
+	}
+	wg.Wait()
+	close(failed)
+
+	ready := true
+	for critical := range failed {
+		if critical {
+			ready = false
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ready != m.ready {
+		log.WithField("ready", ready).Info("api: readiness changed")
+	}
+	m.ready = ready
+	if ready {
+		m.setOverall(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		m.setOverall(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (m *healthMonitor) setOverall(st healthpb.HealthCheckResponse_ServingStatus) {
+	for _, s := range m.services {
+		m.server.SetServingStatus(s, st)
+	}
+}
+
+// databaseCheck pings the database, it fails until storage.Setup completed.
+func databaseCheck(ctx context.Context) error {
+	return storage.Ping(ctx)
+}
+
+// providerChecks are the checks of the notification providers.
+var providerChecks = map[string]HealthCheck{
+	"firebase": storage.CheckFirebase,
+	"sms":      storage.CheckSMS,
+	"email":    storage.CheckEmail,
+}
+
+// isHealthMethod returns true for the methods of the health service, which
+// are served without authentication and before the service is ready.
+func isHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// unlessHealthMethod applies the given interceptor to every method except
+// those of the health service.
+func unlessHealthMethod(i grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return i(ctx, req, info, handler)
+	}
+}
+
+// unlessHealthStream applies the given stream interceptor to every stream
+// except those of the health service.
+func unlessHealthStream(i grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isHealthMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return i(srv, ss, info, handler)
+	}
+}
+
+// readinessInterceptor rejects calls with Unavailable while the service is
+// not ready, so that no call reaches a database that is not set up. It must
+// be wrapped by unlessHealthMethod.
+func readinessInterceptor(m *healthMonitor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !m.Ready() {
+			return nil, status.Error(codes.Unavailable, "service is not ready")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// readinessStreamInterceptor is readinessInterceptor for the streams. It
+// must be wrapped by unlessHealthStream.
+func readinessStreamInterceptor(m *healthMonitor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !m.Ready() {
+			return status.Error(codes.Unavailable, "service is not ready")
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,151 @@
+// Package identity carries the identity of the gRPC caller, as captured by
+// the server interceptor, through the request context.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ForwardedForKey is the metadata key holding the X-Forwarded-For chain.
+const ForwardedForKey = "x-forwarded-for"
+
+// Identity is the caller of a request.
+type Identity struct {
+	// UserID is the authenticated user, 0 for API keys and unauthenticated
+	// calls.
+	UserID int64
+	// Authenticated is set once the caller presented a valid token.
+	Authenticated bool
+	// IPAddress is the client address. It is taken from X-Forwarded-For
+	// when the call comes from a trusted proxy, else from the peer.
+	IPAddress string
+	// PeerAddress is the address of the connection the call came in on.
+	PeerAddress string
+	// Actor names the background job making the changes, empty for calls.
+	Actor string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given identity.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity of ctx. The zero Identity is returned for
+// contexts that do not carry one, such as internal calls.
+func FromContext(ctx context.Context) Identity {
+	id, _ := ctx.Value(contextKey{}).(Identity)
+	return id
+}
+
+// ParseTrustedProxies parses the given IP addresses and CIDR ranges.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", p)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %w", p, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// UnaryServerInterceptor captures the identity of every call. X-Forwarded-For
+// is only honored when the peer is one of the trusted proxies, the nearest
+// untrusted hop is used as the client address.
+func UnaryServerInterceptor(trustedProxies []*net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(NewContext(ctx, fromIncomingContext(ctx, trustedProxies)), req)
+	}
+}
+
+// StreamServerInterceptor captures the identity of every stream, as
+// UnaryServerInterceptor does for the calls.
+func StreamServerInterceptor(trustedProxies []*net.IPNet) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := NewContext(ss.Context(), fromIncomingContext(ss.Context(), trustedProxies))
+		return handler(srv, WithContext(ss, ctx))
+	}
+}
+
+// WithContext returns ss with its context replaced by ctx, for the stream
+// interceptors to pass values to the handler.
+func WithContext(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func fromIncomingContext(ctx context.Context, trustedProxies []*net.IPNet) Identity {
+	var id Identity
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		id.PeerAddress = p.Addr.String()
+		id.IPAddress = hostOf(id.PeerAddress)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	// Walk X-Forwarded-For from the nearest hop, as long as the hop that
+	// added the entry is trusted.
+	var hops []string
+	for _, v := range md.Get(ForwardedForKey) {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0 && isTrusted(id.IPAddress, trustedProxies); i-- {
+		id.IPAddress = hostOf(hops[i])
+	}
+
+	return id
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func isTrusted(addr string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package identity
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name     string
+		proxies  []string
+		contains []string
+		excludes []string
+		wantErr  bool
+	}{
+		{
+			name:     "ipv4 address",
+			proxies:  []string{"10.0.0.1"},
+			contains: []string{"10.0.0.1"},
+			excludes: []string{"10.0.0.2"},
+		},
+		{
+			name:     "ipv6 address",
+			proxies:  []string{"::1"},
+			contains: []string{"::1"},
+			excludes: []string{"::2"},
+		},
+		{
+			name:     "cidr range",
+			proxies:  []string{"192.168.0.0/16"},
+			contains: []string{"192.168.3.4"},
+			excludes: []string{"192.169.0.1"},
+		},
+		{
+			name:    "invalid address",
+			proxies: []string{"proxy.local"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid range",
+			proxies: []string{"10.0.0.0/40"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nets, err := ParseTrustedProxies(tc.proxies)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, addr := range tc.contains {
+				if !isTrusted(addr, nets) {
+					t.Errorf("%s is not trusted", addr)
+				}
+			}
+			for _, addr := range tc.excludes {
+				if isTrusted(addr, nets) {
+					t.Errorf("%s is trusted", addr)
+				}
+			}
+		})
+	}
+}
+
+func TestFromIncomingContext(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		peer         string
+		forwardedFor []string
+		wantIP       string
+	}{
+		{
+			name:   "no forwarded for",
+			peer:   "203.0.113.7:5000",
+			wantIP: "203.0.113.7",
+		},
+		{
+			name:         "untrusted peer",
+			peer:         "203.0.113.7:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			wantIP:       "203.0.113.7",
+		},
+		{
+			name:         "trusted peer",
+			peer:         "10.0.0.1:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			wantIP:       "198.51.100.1",
+		},
+		{
+			name:         "nearest untrusted hop",
+			peer:         "10.0.0.1:5000",
+			forwardedFor: []string{"198.51.100.9, 198.51.100.1, 10.0.0.2"},
+			wantIP:       "198.51.100.1",
+		},
+		{
+			name:         "hops over several headers",
+			peer:         "10.0.0.1:5000",
+			forwardedFor: []string{"198.51.100.9", "10.0.0.3"},
+			wantIP:       "198.51.100.9",
+		},
+		{
+			name:         "only trusted hops",
+			peer:         "10.0.0.1:5000",
+			forwardedFor: []string{"10.0.0.2,10.0.0.3"},
+			wantIP:       "10.0.0.2",
+		},
+		{
+			name:         "hop with port",
+			peer:         "10.0.0.1:5000",
+			forwardedFor: []string{"198.51.100.1:443"},
+			wantIP:       "198.51.100.1",
+		},
+		{
+			name:         "empty hops",
+			peer:         "10.0.0.1:5000",
+			forwardedFor: []string{" , 198.51.100.1 ,"},
+			wantIP:       "198.51.100.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tc.peer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			md := metadata.MD{}
+			for _, v := range tc.forwardedFor {
+				md.Append(ForwardedForKey, v)
+			}
+			ctx = metadata.NewIncomingContext(ctx, md)
+
+			id := fromIncomingContext(ctx, trusted)
+			if id.IPAddress != tc.wantIP {
+				t.Errorf("got ip %s, want %s", id.IPAddress, tc.wantIP)
+			}
+			if id.PeerAddress != tc.peer {
+				t.Errorf("got peer %s, want %s", id.PeerAddress, tc.peer)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/logging"
+)
+
+// requestIDKey is the metadata key of the request id. A request id given by
+// the caller is kept, else one is generated. It is returned in the response
+// header.
+const requestIDKey = "x-request-id"
+
+// loggingInterceptor sets up the request log of every call and logs its
+// completion.
+func loggingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		requestID := incomingRequestID(ctx)
+		// Fails for the calls of the HTTP gateway, which have no stream.
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+
+		fields := requestFields(req)
+		fields[logging.FieldRequestID] = requestID
+		fields[logging.FieldRPC] = path.Base(info.FullMethod)
+		fields["ip_address"] = identity.FromContext(ctx).IPAddress
+		ctx = logging.NewContext(ctx, fields)
+
+		resp, err := handler(ctx, req)
+
+		entry := logging.FromContext(ctx).WithFields(log.Fields{
+			"grpc_code": status.Code(err).String(),
+			"duration":  time.Since(start).String(),
+		})
+		switch status.Code(err) {
+		case codes.OK:
+			entry.Info("api: call finished")
+		case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable:
+			entry.WithError(err).Error("api: call failed")
+		default:
+			entry.WithError(err).Warn("api: call failed")
+		}
+		return resp, err
+	}
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(requestIDKey); len(values) != 0 && values[0] != "" {
+		return values[0]
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+// requestFields returns the organization and the device a request is about,
+// when it names them.
+func requestFields(req interface{}) log.Fields {
+	fields := log.Fields{}
+	switch r := req.(type) {
+	case *als.CreateAlarmRequest:
+		if r.Alarm != nil {
+			fields[logging.FieldDevEUI] = r.Alarm.DevEui
+		}
+	case *als.UpdateAlarmRequest:
+		if r.Alarm != nil && r.Alarm.DevEui != "" {
+			fields[logging.FieldDevEUI] = r.Alarm.DevEui
+		}
+	case *als.DeleteAlarmDevEuiRequest:
+		fields[logging.FieldDevEUI] = r.Deveui
+	case *als.GetAlarmLogsRequest:
+		fields[logging.FieldDevEUI] = r.DevEui
+	case *als.GetAlarmListRequest:
+		if r.Filter != nil && r.Filter.DevEui != "" {
+			fields[logging.FieldDevEUI] = r.Filter.DevEui
+		}
+	case *als.GetOrganizationAlarmListRequest:
+		fields[logging.FieldOrganizationID] = r.OrganizationID
+	}
+	return fields
+}
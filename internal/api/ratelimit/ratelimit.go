@@ -0,0 +1,300 @@
+// Package ratelimit limits the gRPC calls per caller and per organization
+// with token buckets, configurable per RPC.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+	"google.golang.org/grpc"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/auth"
+	"github.com/yurttasutkan/alarmservice/internal/api/identity"
+	"github.com/yurttasutkan/alarmservice/internal/config"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+// sweepInterval is the interval at which the buckets that refilled are
+// dropped.
+const sweepInterval = time.Minute
+
+// organizationTTL is the time the organization of a user is cached for.
+const organizationTTL = time.Minute
+
+// Error is returned for the calls over a limit. It unwraps to
+// storage.ErrRateLimited.
+type Error struct {
+	// Subject is the limited caller or organization, e.g. organization:12.
+	Subject string
+	// RetryAfter is the delay after which the call would be allowed.
+	RetryAfter time.Duration
+
+	err *storage.Error
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// bucket is a token bucket, refilled on use.
+type bucket struct {
+	limit  config.RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit config.RateLimit, now time.Time) *bucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// wait returns the delay until the bucket holds a token.
+func (b *bucket) wait() time.Duration {
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// Limiter holds the buckets of the callers and organizations, per RPC.
+type Limiter struct {
+	defaults config.RateLimits
+	// rpcs are the limits of given RPCs, by lower case method name.
+	rpcs map[string]config.RateLimits
+
+	// userOrganizations returns the organizations of a user, from the
+	// database by default.
+	userOrganizations func(ctx context.Context, userID int64) ([]int64, error)
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	// organizations caches the organization of the users, by user id.
+	organizations map[int64]userOrganization
+}
+
+// userOrganization is the cached organization of a user, 0 when the user is
+// not a member of any.
+type userOrganization struct {
+	id      int64
+	expires time.Time
+}
+
+// NewLimiter creates a Limiter with the given default limits and the limits
+// of given RPCs, by method name, e.g. GetOrganizationAlarmList.
+func NewLimiter(defaults config.RateLimits, rpcs map[string]config.RateLimits) *Limiter {
+	l := &Limiter{
+		defaults:  defaults,
+		rpcs:      make(map[string]config.RateLimits),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		userOrganizations: func(ctx context.Context, userID int64) ([]int64, error) {
+			return storage.GetUserOrganizationIDs(storage.DBContext(ctx), userID)
+		},
+		organizations: make(map[int64]userOrganization),
+	}
+	for rpc, limits := range rpcs {
+		l.rpcs[strings.ToLower(rpc)] = limits
+	}
+	return l
+}
+
+// Enabled returns true when any limit is set.
+func (l *Limiter) Enabled() bool {
+	enabled := func(limits config.RateLimits) bool {
+		return limits.Caller.Rate > 0 || limits.Organization.Rate > 0
+	}
+	if enabled(l.defaults) {
+		return true
+	}
+	for _, limits := range l.rpcs {
+		if enabled(limits) {
+			return true
+		}
+	}
+	return false
+}
+
+// limits returns the limits of the given full method name.
+func (l *Limiter) limits(fullMethod string) config.RateLimits {
+	if limits, ok := l.rpcs[strings.ToLower(path.Base(fullMethod))]; ok {
+		return limits
+	}
+	return l.defaults
+}
+
+// Allow takes a token from the buckets of the caller and of the organization
+// for the given method. An empty caller or organization is not limited. When
+// a bucket is empty no token is taken and an *Error is returned.
+func (l *Limiter) Allow(fullMethod, caller, organization string) error {
+	limits := l.limits(fullMethod)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	var buckets []*bucket
+	for _, s := range []struct {
+		subject string
+		limit   config.RateLimit
+	}{
+		{caller, limits.Caller},
+		{organization, limits.Organization},
+	} {
+		if s.subject == "" || s.limit.Rate <= 0 {
+			continue
+		}
+		key := fullMethod + " " + s.subject
+		b, ok := l.buckets[key]
+		if !ok {
+			b = newBucket(s.limit, now)
+			l.buckets[key] = b
+		}
+		b.refill(now)
+		if b.tokens < 1 {
+			return &Error{
+				Subject:    s.subject,
+				RetryAfter: b.wait(),
+				err:        storage.ErrRateLimited.With("subject", s.subject),
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return nil
+}
+
+// sweep drops the buckets that refilled, they are recreated full.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	for userID, o := range l.organizations {
+		if now.After(o.expires) {
+			delete(l.organizations, userID)
+		}
+	}
+}
+
+// UnaryServerInterceptor rejects the calls over the limits. It must come
+// after the auth interceptor, the principal identifies the caller.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		organization, err := l.organizationOf(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.Allow(info.FullMethod, callerOf(ctx), organization); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects the streams over the limits, a stream
+// counts as one call when it starts.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		organization, err := l.organizationOf(ctx, info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		if err := l.Allow(info.FullMethod, callerOf(ctx), organization); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// callerOf returns the caller of ctx: the API key or the user of the
+// principal, else the client address.
+func callerOf(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		if p.APIKeyID != "" {
+			return "api_key:" + p.APIKeyID
+		}
+		return "user:" + strconv.FormatInt(p.UserID, 10)
+	}
+	if ip := identity.FromContext(ctx).IPAddress; ip != "" {
+		return "ip:" + ip
+	}
+	return ""
+}
+
+// organizationOf returns the organization of the call: the organization of
+// the API key, else the one of the request, else the organization of the
+// user, the first one for the members of several. "" is returned for the
+// other calls and when the method has no organization limit.
+func (l *Limiter) organizationOf(ctx context.Context, fullMethod string, req interface{}) (string, error) {
+	if l.limits(fullMethod).Organization.Rate <= 0 {
+		return "", nil
+	}
+
+	var organizationID int64
+	p, ok := auth.FromContext(ctx)
+	if ok && p.OrganizationID != 0 {
+		organizationID = p.OrganizationID
+	} else if r, isList := req.(*als.GetOrganizationAlarmListRequest); isList && r.OrganizationID != 0 {
+		organizationID = r.OrganizationID
+	} else if ok && p.UserID != 0 {
+		var err error
+		if organizationID, err = l.userOrganization(ctx, p.UserID); err != nil {
+			return "", err
+		}
+	}
+	if organizationID == 0 {
+		return "", nil
+	}
+	return "organization:" + strconv.FormatInt(organizationID, 10), nil
+}
+
+// userOrganization returns the first organization of the user, 0 when the
+// user is not a member of any. It is cached for organizationTTL.
+func (l *Limiter) userOrganization(ctx context.Context, userID int64) (int64, error) {
+	now := time.Now()
+	l.mu.Lock()
+	o, ok := l.organizations[userID]
+	l.mu.Unlock()
+	if ok && now.Before(o.expires) {
+		return o.id, nil
+	}
+
+	organizationIDs, err := l.userOrganizations(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	o = userOrganization{expires: now.Add(organizationTTL)}
+	if len(organizationIDs) != 0 {
+		o.id = organizationIDs[0]
+	}
+
+	l.mu.Lock()
+	l.organizations[userID] = o
+	l.mu.Unlock()
+	return o.id, nil
+}
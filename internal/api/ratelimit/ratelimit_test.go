@@ -0,0 +1,247 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
+
+	"github.com/yurttasutkan/alarmservice/internal/api/auth"
+	"github.com/yurttasutkan/alarmservice/internal/config"
+	"github.com/yurttasutkan/alarmservice/internal/storage"
+)
+
+const (
+	listMethod   = "/als.AlarmServerService/GetOrganizationAlarmList"
+	createMethod = "/als.AlarmServerService/CreateAlarm"
+)
+
+type call struct {
+	method       string
+	caller       string
+	organization string
+	wantSubject  string
+}
+
+func TestLimiterAllow(t *testing.T) {
+	slow := config.RateLimit{Rate: 0.001, Burst: 2}
+
+	tests := []struct {
+		name     string
+		defaults config.RateLimits
+		rpcs     map[string]config.RateLimits
+		calls    []call
+	}{
+		{
+			name:     "caller burst",
+			defaults: config.RateLimits{Caller: slow},
+			calls: []call{
+				{method: listMethod, caller: "user:1"},
+				{method: listMethod, caller: "user:1"},
+				{method: listMethod, caller: "user:1", wantSubject: "user:1"},
+				{method: listMethod, caller: "user:2"},
+			},
+		},
+		{
+			name:     "organization burst across callers",
+			defaults: config.RateLimits{Organization: slow},
+			calls: []call{
+				{method: listMethod, caller: "user:1", organization: "organization:1"},
+				{method: listMethod, caller: "user:2", organization: "organization:1"},
+				{method: listMethod, caller: "user:3", organization: "organization:1", wantSubject: "organization:1"},
+				{method: listMethod, caller: "user:3", organization: "organization:2"},
+			},
+		},
+		{
+			name:     "buckets per method",
+			defaults: config.RateLimits{Caller: config.RateLimit{Rate: 0.001, Burst: 1}},
+			calls: []call{
+				{method: listMethod, caller: "user:1"},
+				{method: createMethod, caller: "user:1"},
+				{method: listMethod, caller: "user:1", wantSubject: "user:1"},
+			},
+		},
+		{
+			name: "rpc limits by case insensitive name",
+			rpcs: map[string]config.RateLimits{
+				"getorganizationalarmlist": {Caller: config.RateLimit{Rate: 0.001, Burst: 1}},
+			},
+			calls: []call{
+				{method: listMethod, caller: "user:1"},
+				{method: listMethod, caller: "user:1", wantSubject: "user:1"},
+				{method: createMethod, caller: "user:1"},
+				{method: createMethod, caller: "user:1"},
+			},
+		},
+		{
+			name:     "empty subjects are not limited",
+			defaults: config.RateLimits{Caller: slow, Organization: slow},
+			calls: []call{
+				{method: listMethod},
+				{method: listMethod},
+				{method: listMethod},
+			},
+		},
+		{
+			name:     "burst of at least one",
+			defaults: config.RateLimits{Caller: config.RateLimit{Rate: 0.001}},
+			calls: []call{
+				{method: listMethod, caller: "user:1"},
+				{method: listMethod, caller: "user:1", wantSubject: "user:1"},
+			},
+		},
+		{
+			name: "no token taken from the caller when the organization is limited",
+			defaults: config.RateLimits{
+				Caller:       config.RateLimit{Rate: 0.001, Burst: 2},
+				Organization: config.RateLimit{Rate: 0.001, Burst: 1},
+			},
+			calls: []call{
+				{method: listMethod, caller: "user:1", organization: "organization:1"},
+				{method: listMethod, caller: "user:1", organization: "organization:1", wantSubject: "organization:1"},
+				{method: listMethod, caller: "user:1", organization: "organization:2"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(tc.defaults, tc.rpcs)
+			for i, c := range tc.calls {
+				err := l.Allow(c.method, c.caller, c.organization)
+				if c.wantSubject == "" {
+					if err != nil {
+						t.Fatalf("call %d: unexpected error: %v", i, err)
+					}
+					continue
+				}
+
+				var limitErr *Error
+				if !errors.As(err, &limitErr) {
+					t.Fatalf("call %d: expected an *Error, got %v", i, err)
+				}
+				if limitErr.Subject != c.wantSubject {
+					t.Errorf("call %d: got subject %s, want %s", i, limitErr.Subject, c.wantSubject)
+				}
+				if limitErr.RetryAfter <= 0 {
+					t.Errorf("call %d: got retry after %s", i, limitErr.RetryAfter)
+				}
+				if !errors.Is(err, storage.ErrRateLimited) {
+					t.Errorf("call %d: error does not unwrap to ErrRateLimited", i)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults config.RateLimits
+		rpcs     map[string]config.RateLimits
+		want     bool
+	}{
+		{name: "no limits"},
+		{name: "burst only", defaults: config.RateLimits{Caller: config.RateLimit{Burst: 5}}},
+		{name: "default caller", defaults: config.RateLimits{Caller: config.RateLimit{Rate: 1}}, want: true},
+		{name: "default organization", defaults: config.RateLimits{Organization: config.RateLimit{Rate: 1}}, want: true},
+		{
+			name: "rpc",
+			rpcs: map[string]config.RateLimits{"CreateAlarm": {Caller: config.RateLimit{Rate: 1}}},
+			want: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NewLimiter(tc.defaults, tc.rpcs).Enabled(); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	limit := config.RateLimit{Rate: 1, Burst: 2}
+	start := time.Now()
+
+	tests := []struct {
+		name string
+		// tokens left in the bucket at start.
+		tokens float64
+		// after is the time since the last sweep.
+		after time.Duration
+		kept  bool
+	}{
+		{name: "before the sweep interval", tokens: 0, after: sweepInterval / 2, kept: true},
+		{name: "refilled", tokens: 0, after: sweepInterval, kept: false},
+		{name: "full", tokens: 2, after: sweepInterval, kept: false},
+		{name: "not refilled yet", tokens: -sweepInterval.Seconds(), after: sweepInterval, kept: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(config.RateLimits{Caller: limit}, nil)
+			l.lastSweep = start
+			b := newBucket(limit, start)
+			b.tokens = tc.tokens
+			l.buckets["key"] = b
+
+			l.sweep(start.Add(tc.after))
+			if _, ok := l.buckets["key"]; ok != tc.kept {
+				t.Errorf("got kept %t, want %t", ok, tc.kept)
+			}
+		})
+	}
+}
+
+func TestLimiterOrganizationOf(t *testing.T) {
+	userOrganizations := map[int64][]int64{1: {3, 4}, 2: nil}
+	limited := config.RateLimits{Organization: config.RateLimit{Rate: 1}}
+
+	tests := []struct {
+		name      string
+		defaults  config.RateLimits
+		principal *auth.Principal
+		req       interface{}
+		want      string
+	}{
+		{name: "api key", defaults: limited, principal: &auth.Principal{APIKeyID: "key", OrganizationID: 5}, want: "organization:5"},
+		{name: "request", defaults: limited, principal: &auth.Principal{UserID: 1}, req: &als.GetOrganizationAlarmListRequest{OrganizationID: 4}, want: "organization:4"},
+		{name: "user", defaults: limited, principal: &auth.Principal{UserID: 1}, want: "organization:3"},
+		{name: "user without organization", defaults: limited, principal: &auth.Principal{UserID: 2}},
+		{name: "admin api key", defaults: limited, principal: &auth.Principal{APIKeyID: "key", IsAdmin: true}},
+		{name: "unauthenticated", defaults: limited},
+		{name: "no organization limit", principal: &auth.Principal{UserID: 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(tc.defaults, nil)
+			lookups := 0
+			l.userOrganizations = func(ctx context.Context, userID int64) ([]int64, error) {
+				lookups++
+				return userOrganizations[userID], nil
+			}
+			ctx := context.Background()
+			if tc.principal != nil {
+				ctx = auth.NewContext(ctx, *tc.principal)
+			}
+
+			for i := 0; i < 2; i++ {
+				got, err := l.organizationOf(ctx, listMethod, tc.req)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != tc.want {
+					t.Errorf("got %q, want %q", got, tc.want)
+				}
+			}
+			if lookups > 1 {
+				t.Errorf("got %d lookups, want the organization cached", lookups)
+			}
+		})
+	}
+}
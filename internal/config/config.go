@@ -1,10 +1,13 @@
 package config
 
+import "time"
+
 // Config defines the configuration structure.
 type Config struct {
 	General struct {
 		LogLevel                  int    `mapstructure:"log_level"`
 		LogToSyslog               bool   `mapstructure:"log_to_syslog"`
+		LogJSON                   bool   `mapstructure:"log_json"`
 		GRPCDefaultResolverScheme string `mapstructure:"grpc_default_resolver_scheme"`
 	} `mapstructure:"general"`
 
@@ -18,11 +21,66 @@ type Config struct {
 	AlarmServer struct{
 		API struct{
 			Bind string `mapstructure:"bind"`
+			TrustedProxies []string `mapstructure:"trusted_proxies"`
+			JWTSecret string `mapstructure:"jwt_secret"`
+			AuthDisabled bool `mapstructure:"auth_disabled"`
+			CACert string `mapstructure:"ca_cert"`
+			TLSCert string `mapstructure:"tls_cert"`
+			TLSKey string `mapstructure:"tls_key"`
+			Reflection bool `mapstructure:"reflection"`
+			RateLimit struct{
+				RateLimits `mapstructure:",squash"`
+				RPC map[string]RateLimits `mapstructure:"rpc"`
+			} `mapstructure:"rate_limit"`
 		} `mapstructure:"api"`
+		HTTP struct{
+			Bind string `mapstructure:"bind"`
+		} `mapstructure:"http"`
 		Address string `mapstructure:"als_addr"`
+		TemplateSyncInterval time.Duration `mapstructure:"template_sync_interval"`
+		DeletedAlarmRetention time.Duration `mapstructure:"deleted_alarm_retention"`
+		IdempotencyKeyTTL time.Duration `mapstructure:"idempotency_key_ttl"`
+		AlarmCacheMaxAge time.Duration `mapstructure:"alarm_cache_max_age"`
+		UniqueAlarms bool `mapstructure:"unique_alarms"`
+		ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
 
 	} `mapstructure:"alarm_server"`
+
+	Metrics struct {
+		Prometheus struct {
+			EndpointEnabled bool   `mapstructure:"endpoint_enabled"`
+			Bind            string `mapstructure:"bind"`
+		} `mapstructure:"prometheus"`
+
+		SMSCredit struct {
+			CheckInterval time.Duration `mapstructure:"check_interval"`
+			UserID        uint          `mapstructure:"user_id"`
+			Username      string        `mapstructure:"username"`
+			Password      string        `mapstructure:"password"`
+		} `mapstructure:"sms_credit"`
+	} `mapstructure:"metrics"`
+
+	Tracing struct {
+		Endpoint      string            `mapstructure:"endpoint"`
+		Headers       map[string]string `mapstructure:"headers"`
+		SamplingRatio float64           `mapstructure:"sampling_ratio"`
+		ExportTimeout time.Duration     `mapstructure:"export_timeout"`
+	} `mapstructure:"tracing"`
 }
+// RateLimit is a token bucket refilled with Rate tokens per second up to
+// Burst tokens, a call takes one token. A zero Rate means no limit.
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// RateLimits are the limits of the calls of an RPC, per caller and per
+// organization.
+type RateLimits struct {
+	Caller       RateLimit `mapstructure:"caller"`
+	Organization RateLimit `mapstructure:"organization"`
+}
+
 	// C holds the global configuration.
 	var C Config
 
@@ -0,0 +1,111 @@
+// Package lifecycle runs the long-running parts of the service and stops
+// them in order on shutdown.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Manager runs services in goroutines and stops them on shutdown. Shutdown
+// starts when the parent context is done or when a service fails.
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	err   error
+	stops []stopFunc
+}
+
+type stopFunc struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// New creates a Manager that shuts down when ctx is done.
+func New(ctx context.Context) *Manager {
+	m := Manager{}
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	return &m
+}
+
+// Context returns the context that is canceled when shutdown starts.
+// Background workers should return when it is done.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go runs fn in a goroutine. When fn returns an error, other than the
+// cancellation of the manager context, shutdown is started.
+func (m *Manager) Go(name string, fn func(context.Context) error) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := fn(m.ctx)
+		if err == nil || errors.Is(err, context.Canceled) {
+			return
+		}
+
+		log.WithError(err).WithField("service", name).Error("lifecycle: service failed")
+		m.mu.Lock()
+		if m.err == nil {
+			m.err = fmt.Errorf("%s: %w", name, err)
+		}
+		m.mu.Unlock()
+		m.cancel()
+	}()
+}
+
+// OnStop registers fn to run on shutdown, such as stopping a server whose
+// Serve runs in Go. Stop functions run in reverse order of registration.
+func (m *Manager) OnStop(name string, fn func(context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stops = append(m.stops, stopFunc{name: name, fn: fn})
+}
+
+// Wait blocks until shutdown starts, then runs the stop functions and waits
+// for the services to return, all within the given timeout. It returns the
+// error of the service that caused the shutdown, if any.
+func (m *Manager) Wait(timeout time.Duration) error {
+	<-m.ctx.Done()
+	log.Warning("lifecycle: stopping alarmservice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	stops := m.stops
+	m.mu.Unlock()
+
+	for i := len(stops) - 1; i >= 0; i-- {
+		s := stops[i]
+		if err := s.fn(ctx); err != nil {
+			log.WithError(err).WithField("service", s.name).Error("lifecycle: stop error")
+		} else {
+			log.WithField("service", s.name).Info("lifecycle: stopped")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warning("lifecycle: shutdown deadline exceeded, not all services stopped")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
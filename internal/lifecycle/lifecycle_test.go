@@ -0,0 +1,140 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testService is run with Go. It returns err, once the manager context is
+// done when it blocks.
+type testService struct {
+	name   string
+	err    error
+	blocks bool
+}
+
+func TestManagerShutdown(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name     string
+		services []testService
+		stops    []string
+		// cancel cancels the parent context.
+		cancel    bool
+		wantOrder []string
+		wantErr   string
+	}{
+		{
+			name:      "stop functions in reverse order",
+			services:  []testService{{name: "api", blocks: true}},
+			stops:     []string{"database", "notifications", "api"},
+			cancel:    true,
+			wantOrder: []string{"api", "notifications", "database"},
+		},
+		{
+			name:      "failed service starts the shutdown",
+			services:  []testService{{name: "api", blocks: true}, {name: "worker", err: errFailed}},
+			stops:     []string{"database", "api"},
+			wantOrder: []string{"api", "database"},
+			wantErr:   "worker: failed",
+		},
+		{
+			name:      "canceled service does not fail",
+			services:  []testService{{name: "worker", err: fmt.Errorf("run: %w", context.Canceled)}},
+			stops:     []string{"api"},
+			cancel:    true,
+			wantOrder: []string{"api"},
+		},
+		{
+			name:     "service returning nil does not start the shutdown",
+			services: []testService{{name: "migrations"}},
+			cancel:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parent, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := New(parent)
+
+			var (
+				mu    sync.Mutex
+				order []string
+			)
+			for _, name := range tc.stops {
+				name := name
+				m.OnStop(name, func(ctx context.Context) error {
+					mu.Lock()
+					defer mu.Unlock()
+					order = append(order, name)
+					return nil
+				})
+			}
+			for _, svc := range tc.services {
+				svc := svc
+				m.Go(svc.name, func(ctx context.Context) error {
+					if svc.blocks {
+						<-ctx.Done()
+					}
+					return svc.err
+				})
+			}
+			if tc.cancel {
+				// Let the services that return right away finish first.
+				time.Sleep(10 * time.Millisecond)
+				if m.Context().Err() != nil {
+					t.Fatal("shutdown started before the parent context was canceled")
+				}
+				cancel()
+			}
+
+			err := m.Wait(time.Second)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Fatalf("got error %v, want %s", err, tc.wantErr)
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tc.wantOrder) {
+				t.Errorf("got stop order %v, want %v", order, tc.wantOrder)
+			}
+		})
+	}
+}
+
+func TestManagerWaitTimeout(t *testing.T) {
+	m := New(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	m.Go("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	m.Go("failing", func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+
+	var stopCtx context.Context
+	m.OnStop("api", func(ctx context.Context) error {
+		stopCtx = ctx
+		return nil
+	})
+
+	start := time.Now()
+	err := m.Wait(50 * time.Millisecond)
+	if err == nil || err.Error() != "failing: failed" {
+		t.Fatalf("got error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait returned after %s", elapsed)
+	}
+	if _, ok := stopCtx.Deadline(); !ok {
+		t.Error("stop functions get no deadline")
+	}
+}
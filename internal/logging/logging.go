@@ -0,0 +1,59 @@
+// Package logging carries a request-scoped logrus entry through the request
+// context, so that every log line of a call has the same fields.
+package logging
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Field names of the request-scoped fields.
+const (
+	FieldRequestID      = "request_id"
+	FieldRPC            = "rpc"
+	FieldOrganizationID = "organization_id"
+	FieldDevEUI         = "dev_eui"
+	FieldUserID         = "user_id"
+)
+
+// requestLog is shared by the contexts of a call, so that the fields added
+// by an inner interceptor, e.g. the authenticated user, are also logged by
+// the outer ones.
+type requestLog struct {
+	mu    sync.Mutex
+	entry *log.Entry
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying a request log with the given
+// fields.
+func NewContext(ctx context.Context, fields log.Fields) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestLog{entry: log.WithFields(fields)})
+}
+
+// AddFields adds the given fields to the request log of ctx. It is a no-op
+// for contexts that do not carry one.
+func AddFields(ctx context.Context, fields log.Fields) {
+	rl, ok := ctx.Value(contextKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.entry = rl.entry.WithFields(fields)
+}
+
+// FromContext returns the logger of ctx. The standard logger is returned
+// for contexts that do not carry a request log, such as the workers.
+func FromContext(ctx context.Context) *log.Entry {
+	rl, ok := ctx.Value(contextKey{}).(*requestLog)
+	if !ok {
+		return log.NewEntry(log.StandardLogger())
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.entry
+}
@@ -0,0 +1,184 @@
+// Package metrics exposes the Prometheus metrics of the service.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurttasutkan/alarmservice/internal/config"
+)
+
+// Notification channels.
+const (
+	ChannelSMS       = "sms"
+	ChannelEmail     = "email"
+	ChannelFirebase  = "firebase"
+	ChannelOneSignal = "onesignal"
+)
+
+var (
+	apiDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "alarmservice_api_duration_seconds",
+		Help:    "The duration of the API calls, per RPC and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alarmservice_api_errors_total",
+		Help: "The number of failed API calls, per RPC and status code.",
+	}, []string{"method", "code"})
+
+	notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alarmservice_notifications_sent_total",
+		Help: "The number of notifications sent, per channel.",
+	}, []string{"channel"})
+
+	notificationsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alarmservice_notifications_failed_total",
+		Help: "The number of notifications that could not be sent, per channel.",
+	}, []string{"channel"})
+
+	alarmsRaised = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alarmservice_alarms_raised_total",
+		Help: "The number of alarms raised, per organization.",
+	}, []string{"organization_id"})
+
+	smsCredits = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "alarmservice_sms_credits_remaining",
+		Help: "The SMS credits remaining at the SMS provider, as of the last check.",
+	})
+
+	alarmCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alarmservice_alarm_cache_lookups_total",
+		Help: "The number of alarm cache lookups, per result: hit, miss or stale.",
+	}, []string{"result"})
+
+	alarmCacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "alarmservice_alarm_cache_invalidations_total",
+		Help: "The number of alarm cache entries invalidated by change notifications.",
+	})
+)
+
+// Alarm cache lookup results. Stale lookups found an entry older than the
+// staleness bound.
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheStale = "stale"
+)
+
+// UnaryServerInterceptor records the duration and the errors of the API
+// calls. It must be the outermost interceptor, so that calls rejected by the
+// other interceptors are counted.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		method := path.Base(info.FullMethod)
+		code := status.Code(err).String()
+		apiDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+		if err != nil {
+			apiErrors.WithLabelValues(method, code).Inc()
+		}
+		return resp, err
+	}
+}
+
+// RegisterDBStats exposes the connection pool stats of the database.
+func RegisterDBStats(db *sql.DB) error {
+	if err := prometheus.Register(collectors.NewDBStatsCollector(db, "alarmservice")); err != nil {
+		return fmt.Errorf("register database stats collector error: %w", err)
+	}
+	return nil
+}
+
+// NotificationSent records the result of sending a notification on the given
+// channel.
+func NotificationSent(channel string, err error) {
+	if err != nil {
+		notificationsFailed.WithLabelValues(channel).Inc()
+		return
+	}
+	notificationsSent.WithLabelValues(channel).Inc()
+}
+
+// AlarmRaised records an alarm raised for a device of the given organization.
+func AlarmRaised(organizationID int64) {
+	alarmsRaised.WithLabelValues(strconv.FormatInt(organizationID, 10)).Inc()
+}
+
+// AlarmCacheLookup records an alarm cache lookup with the given result.
+func AlarmCacheLookup(result string) {
+	alarmCacheLookups.WithLabelValues(result).Inc()
+}
+
+// AlarmCacheInvalidated records an alarm cache entry invalidated.
+func AlarmCacheInvalidated() {
+	alarmCacheInvalidations.Inc()
+}
+
+// SetSMSCredits records the SMS credits remaining at the SMS provider.
+func SetSMSCredits(credits uint) {
+	smsCredits.Set(float64(credits))
+}
+
+// Server serves the metrics endpoint.
+type Server struct {
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// Setup sets up the metrics endpoint, it returns nil when it is disabled.
+func Setup(conf *config.Config) (*Server, error) {
+	promConf := conf.Metrics.Prometheus
+	if !promConf.EndpointEnabled {
+		return nil, nil
+	}
+
+	log.WithFields(log.Fields{
+		"bind": promConf.Bind,
+	}).Info("metrics: starting prometheus metrics server")
+
+	lis, err := net.Listen("tcp", promConf.Bind)
+	if err != nil {
+		return nil, fmt.Errorf("start metrics listener error: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return &Server{
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		listener: lis,
+	}, nil
+}
+
+// Serve serves the metrics endpoint until Stop is called.
+func (s *Server) Serve() error {
+	if err := s.httpServer.Serve(s.listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Stop stops the metrics endpoint.
+func (s *Server) Stop(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
@@ -1,13 +1,12 @@
 package storage
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
-	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // SQL function to convert filters to SQL line
@@ -18,46 +17,70 @@ func (f AlarmFilters) SQL() string {
 		filters = append(filters, fmt.Sprint(" dev_eui =  '", f.DevEui+"'"))
 	}
 	filters = append(filters, fmt.Sprint(" and ", f.UserID, " = any(user_id)"))
+	if f.ZoneUserID != 0 {
+		filters = append(filters, " and "+UserZoneSQL("dev_eui", ":zone_user_id"))
+	}
 	if f.Limit != 0 {
 		filters = append(filters, fmt.Sprint(" LIMIT ", f.Limit))
 	}
 
-	return " where is_active = true and  " + strings.Join(filters, " ")
+	return " where is_active = true and deleted_at is null and " + strings.Join(filters, " ")
 }
 
-func CreateAlarmLog(ctx context.Context, db sqlx.Ext, a *als.Alarm, userID []int64, ipAddress string, isDeleted int64) error {
-	_, err := db.Exec(`insert into alarm_change_logs(
-		dev_eui,
-		min_treshold,
-		max_treshold,
-		user_id,
-		ip_address,
-		is_deleted,
-		sms,
-		temperature,
-		humadity,
-		ec,
-		door,
-		w_leak
-		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) `, a.DevEui, a.MinTreshold,
-		a.MaxTreshold, userID, ipAddress, isDeleted, a.Sms, a.Temperature, a.Humadity, a.Ec, a.Door, a.WLeak)
-	if err != nil {
-		return HandlePSQLError(Insert, nil, "insert error")
+// AlarmSensors are the sensor flags of an alarm.
+type AlarmSensors struct {
+	Temperature bool `db:"temperature"`
+	Humadity    bool `db:"humadity"`
+	Ec          bool `db:"ec"`
+	Door        bool `db:"door"`
+	WaterLeak   bool `db:"w_leak"`
+	Distance    bool `db:"distance"`
+	Pressure    bool `db:"pressure"`
+}
+
+// Sensors returns the sensor flags of the alarm.
+func (al Alarm) Sensors() AlarmSensors {
+	return AlarmSensors{
+		Temperature: al.Temperature,
+		Humadity:    al.Humadity,
+		Ec:          al.Ec,
+		Door:        al.Door,
+		WaterLeak:   al.WaterLeak,
+		Distance:    al.Distance,
+		Pressure:    al.Pressure,
 	}
+}
 
+// LockDeviceAlarms locks the alarms of the device until the end of the
+// transaction, serializing the creates for the device.
+func LockDeviceAlarms(db sqlx.Execer, devEui string) error {
+	_, err := db.Exec("select pg_advisory_xact_lock(hashtext('alarm_refactor2:' || lower($1)))", devEui)
+	if err != nil {
+		return HandlePSQLError(Select, err, "lock error")
+	}
 	return nil
 }
 
-// LogAudit logs changes into the alarm_audit_log table
-func LogAudit(db *sqlx.DB, alarmID int64, dev_eui string, userID int64, changeType string, previousValue, newValue interface{}) error {
-	// Convert old and new values to JSON
-	previousJSON, _ := json.Marshal(previousValue)
-	newJSON, _ := json.Marshal(newValue)
-
-	query := `
-		INSERT INTO alarm_audit_log (alarm_id, dev_eui, change_type, changed_by, old_values, new_values)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
-	_, err := db.Exec(query, alarmID, dev_eui, changeType, userID, previousJSON, newJSON)
-	return err
+// CheckDuplicateAlarm returns ErrAlarmAlreadyExists when an alarm other than
+// the given one, 0 for a new alarm, and not deleted, exists for the device
+// with the same sensor and the same set of users. Use LockDeviceAlarms
+// first for the check to hold until commit.
+func CheckDuplicateAlarm(db sqlx.Queryer, alarmID int64, devEui string, sensors AlarmSensors, userIDs []int64) error {
+	var ids []int64
+	err := sqlx.Select(db, &ids, `
+		select id from alarm_refactor2
+		where lower(dev_eui) = lower($1) and deleted_at is null
+			and temperature = $2 and humadity = $3 and ec = $4 and door = $5
+			and w_leak = $6 and distance = $7 and pressure = $8
+			and user_id @> $9 and user_id <@ $9 and id <> $10
+		limit 1`,
+		devEui, sensors.Temperature, sensors.Humadity, sensors.Ec, sensors.Door,
+		sensors.WaterLeak, sensors.Distance, sensors.Pressure, pq.Int64Array(userIDs), alarmID)
+	if err != nil {
+		return HandlePSQLError(Select, err, "select error")
+	}
+	if len(ids) != 0 {
+		return ErrAlarmAlreadyExists.With("alarm_id", strconv.FormatInt(ids[0], 10))
+	}
+	return nil
 }
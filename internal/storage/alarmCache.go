@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+// alarmCache is the cache used by GetDeviceAlarms, nil when it is disabled.
+var alarmCache *AlarmCache
+
+// AlarmCache keeps the active alarms of the devices with their date windows,
+// by dev_eui. Entries are invalidated through the change feed and reloaded
+// once older than maxAge, which bounds their staleness when notifications
+// are lost.
+type AlarmCache struct {
+	maxAge time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]alarmCacheEntry
+	// generation is incremented by every invalidation, the alarms loaded
+	// before one are not stored.
+	generation uint64
+}
+
+type alarmCacheEntry struct {
+	alarms   []AlarmSnapshot
+	loadedAt time.Time
+}
+
+// SetupAlarmCache enables the alarm cache of GetDeviceAlarms, its entries
+// are reloaded once older than maxAge. It must be called before Setup, the
+// cache is kept up to date by its Run method.
+func SetupAlarmCache(maxAge time.Duration) *AlarmCache {
+	alarmCache = &AlarmCache{
+		maxAge:  maxAge,
+		entries: make(map[string]alarmCacheEntry),
+	}
+	return alarmCache
+}
+
+// GetDeviceAlarms returns the active alarms of the device and their date
+// windows, from the alarm cache when it is enabled. The alarms must not be
+// modified.
+func GetDeviceAlarms(db sqlx.Queryer, devEui string) ([]AlarmSnapshot, error) {
+	if alarmCache == nil {
+		return loadDeviceAlarms(db, strings.ToLower(devEui))
+	}
+	return alarmCache.Get(db, devEui)
+}
+
+// Get returns the active alarms of the device, loaded from db when they are
+// not cached or the entry is older than maxAge.
+func (c *AlarmCache) Get(db sqlx.Queryer, devEui string) ([]AlarmSnapshot, error) {
+	key := strings.ToLower(devEui)
+
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	switch {
+	case ok && time.Since(e.loadedAt) < c.maxAge:
+		metrics.AlarmCacheLookup(metrics.CacheHit)
+		return e.alarms, nil
+	case ok:
+		metrics.AlarmCacheLookup(metrics.CacheStale)
+	default:
+		metrics.AlarmCacheLookup(metrics.CacheMiss)
+	}
+
+	loadedAt := time.Now()
+	alarms, err := loadDeviceAlarms(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.entries[key] = alarmCacheEntry{alarms: alarms, loadedAt: loadedAt}
+	}
+	c.mu.Unlock()
+	return alarms, nil
+}
+
+// Invalidate drops the entry of the given device.
+func (c *AlarmCache) Invalidate(devEui string) {
+	c.mu.Lock()
+	delete(c.entries, strings.ToLower(devEui))
+	c.generation++
+	c.mu.Unlock()
+	metrics.AlarmCacheInvalidated()
+}
+
+// InvalidateAll drops all the entries.
+func (c *AlarmCache) InvalidateAll() {
+	c.mu.Lock()
+	c.entries = make(map[string]alarmCacheEntry)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// Run invalidates the entries of the devices whose alarms change, as
+// published on the change feed of dsn, until ctx is done. The changes
+// missed while the feed reconnects are replayed. The entries older than
+// maxAge are dropped along the way.
+func (c *AlarmCache) Run(ctx context.Context, dsn string) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-Ready():
+	}
+
+	go c.dropExpired(ctx)
+
+	sub := changefeed.NewSubscriber(dsn, DB(), changefeed.Filter{}, 0)
+	return sub.Run(ctx, func(e changefeed.Event) error {
+		c.handleEvent(e)
+		return nil
+	})
+}
+
+// handleEvent invalidates the entry of the device of an alarm change, those
+// of the alarm templates included. Raised and cleared alarms do not change
+// the alarms.
+func (c *AlarmCache) handleEvent(e changefeed.Event) {
+	if e.ID != 0 {
+		c.Invalidate(e.DevEui)
+	}
+}
+
+// dropExpired drops the entries older than maxAge, until ctx is done.
+func (c *AlarmCache) dropExpired(ctx context.Context) {
+	ticker := time.NewTicker(c.maxAge)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		for key, e := range c.entries {
+			if time.Since(e.loadedAt) >= c.maxAge {
+				delete(c.entries, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// loadDeviceAlarms returns the active alarms of the device with the given
+// lower case dev_eui and their date windows.
+func loadDeviceAlarms(db sqlx.Queryer, devEui string) ([]AlarmSnapshot, error) {
+	var alarms []Alarm
+	err := sqlx.Select(db, &alarms, `select * from alarm_refactor2
+		where lower(dev_eui) = $1 and is_active = true and deleted_at is null order by id`, devEui)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+
+	return WithAlarmDates(db, alarms)
+}
+
+// WithAlarmDates returns the snapshots of the given alarms with their date
+// windows, as written to the audit log.
+func WithAlarmDates(db sqlx.Queryer, alarms []Alarm) ([]AlarmSnapshot, error) {
+	snapshots := make([]AlarmSnapshot, 0, len(alarms))
+	if len(alarms) == 0 {
+		return snapshots, nil
+	}
+	ids := make([]int64, 0, len(alarms))
+	for _, al := range alarms {
+		ids = append(ids, al.ID)
+	}
+	var dates []AlarmDateFilter
+	err := sqlx.Select(db, &dates, "select * from alarm_date_time where alarm_id = any($1) order by id", pq.Array(ids))
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+
+	byAlarm := make(map[int64][]AlarmDateFilter)
+	for _, d := range dates {
+		byAlarm[d.AlarmId] = append(byAlarm[d.AlarmId], d)
+	}
+	for _, al := range alarms {
+		dates := byAlarm[al.ID]
+		if dates == nil {
+			dates = []AlarmDateFilter{}
+		}
+		snapshots = append(snapshots, AlarmSnapshot{Alarm: al, AlarmDateTime: dates})
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+func TestAlarmCacheHandleEvent(t *testing.T) {
+	const devEui = "0a0b0c0d0e0f0102"
+	alarms := []AlarmSnapshot{{Alarm: Alarm{ID: 7, DevEui: devEui}}}
+
+	tests := []struct {
+		name            string
+		event           changefeed.Event
+		wantInvalidated bool
+	}{
+		{
+			name:            "alarm updated",
+			event:           changefeed.Event{ID: 12, Type: "UPDATE", AlarmID: 7, DevEui: devEui},
+			wantInvalidated: true,
+		},
+		{
+			name:            "upper case dev_eui",
+			event:           changefeed.Event{ID: 13, Type: "UPDATE", AlarmID: 7, DevEui: "0A0B0C0D0E0F0102"},
+			wantInvalidated: true,
+		},
+		{
+			name:  "other device",
+			event: changefeed.Event{ID: 14, Type: "UPDATE", AlarmID: 8, DevEui: "0807060504030201"},
+		},
+		{
+			name:  "alarm raised",
+			event: AlarmStateEvent(7, devEui, 1, true, time.Now()),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &AlarmCache{
+				maxAge:  time.Minute,
+				entries: map[string]alarmCacheEntry{devEui: {alarms: alarms, loadedAt: time.Now()}},
+			}
+			c.handleEvent(tc.event)
+
+			_, cached := c.entries[devEui]
+			if cached == tc.wantInvalidated {
+				t.Errorf("got cached %t, want %t", cached, !tc.wantInvalidated)
+			}
+			if !cached {
+				return
+			}
+			// A cached entry is served without querying the database.
+			got, err := c.Get(nil, "0A0B0C0D0E0F0102")
+			if err != nil || len(got) != 1 || got[0].ID != 7 {
+				t.Errorf("got %v, %v", got, err)
+			}
+		})
+	}
+}
@@ -1,15 +1,11 @@
 package storage
 
 import (
-	"fmt"
-
 	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
 	"github.com/jmoiron/sqlx"
 )
 
 func CreateAlarmDates(db sqlx.Queryer, alarmDates []AlarmDateFilter) ([]*als.AlarmDateTime, error) {
-	fmt.Println("create alarm date")
-
 	var returnDates []*als.AlarmDateTime
 
 	if len(alarmDates) > 0 {
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+// PublishAlarmState publishes on the change feed that the given alarm was
+// raised or cleared and returns the event. It is called by SetAlarmState
+// when an evaluation changes the state of the alarm. Within a transaction
+// the event is only delivered on commit.
+func PublishAlarmState(db sqlx.Ext, alarmID int64, raised bool) (changefeed.Event, error) {
+	var alarm struct {
+		DevEui         string `db:"dev_eui"`
+		OrganizationID int64  `db:"organization_id"`
+	}
+	err := sqlx.Get(db, &alarm, `select ar.dev_eui, coalesce((
+			select organization_id from device where dev_eui::text = '\x' || ar.dev_eui limit 1), 0) as organization_id
+		from alarm_refactor2 as ar where ar.id = $1`, alarmID)
+	if err == sql.ErrNoRows {
+		return changefeed.Event{}, ErrAlarmNotFound.With("alarm_id", strconv.FormatInt(alarmID, 10))
+	}
+	if err != nil {
+		return changefeed.Event{}, HandlePSQLError(Select, err, "select error")
+	}
+
+	e := AlarmStateEvent(alarmID, alarm.DevEui, alarm.OrganizationID, raised, time.Now())
+	if err := changefeed.Notify(db, e); err != nil {
+		return changefeed.Event{}, err
+	}
+	return e, nil
+}
+
+// AlarmStateEvent returns the change feed event of the given alarm raised or
+// cleared at the given time.
+func AlarmStateEvent(alarmID int64, devEui string, organizationID int64, raised bool, at time.Time) changefeed.Event {
+	eventType := changefeed.EventCleared
+	if raised {
+		eventType = changefeed.EventRaised
+	}
+	return changefeed.Event{
+		Type:           eventType,
+		AlarmID:        alarmID,
+		DevEui:         devEui,
+		OrganizationID: organizationID,
+		Time:           at,
+	}
+}
+
+// SetAlarmState records the evaluated state of the given alarm with the
+// measured value and, when the state changed, publishes it with
+// PublishAlarmState. It returns the published event, nil when the state did
+// not change. The state of the alarm is locked until the transaction of db
+// ends, the evaluations of an alarm are serialized. Alarms are cleared until
+// first raised.
+func SetAlarmState(db sqlx.Ext, alarmID int64, raised bool, value float64) (*changefeed.Event, error) {
+	_, err := db.Exec(`insert into alarm_state (alarm_id, raised) values ($1, false)
+		on conflict (alarm_id) do nothing`, alarmID)
+	if err != nil {
+		return nil, HandlePSQLError(Insert, err, "insert error")
+	}
+
+	var current bool
+	if err := sqlx.Get(db, &current, "select raised from alarm_state where alarm_id = $1 for update", alarmID); err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	if current == raised {
+		return nil, nil
+	}
+
+	_, err = db.Exec("update alarm_state set raised = $2, value = $3, changed_at = now() where alarm_id = $1", alarmID, raised, value)
+	if err != nil {
+		return nil, HandlePSQLError(Update, err, "update error")
+	}
+	e, err := PublishAlarmState(db, alarmID, raised)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AlarmSnapshot is the state of an alarm and its date windows as it is
+// written to the audit log. AlarmDateTime is nil for entries that were
+// written without date windows.
+type AlarmSnapshot struct {
+	Alarm
+	AlarmDateTime []AlarmDateFilter
+}
+
+// AlarmAuditEntry is a row of the alarm_audit_log table. AlarmID is 0 for
+// entries backfilled from the old change log, which only knew the dev_eui.
+type AlarmAuditEntry struct {
+	ID         int64     `db:"id"`
+	AlarmID    int64     `db:"alarm_id"`
+	DevEui     string    `db:"dev_eui"`
+	ChangeType string    `db:"change_type"`
+	ChangedBy  int64     `db:"changed_by"`
+	OldValues  []byte    `db:"old_values"`
+	NewValues  []byte    `db:"new_values"`
+	ChangedAt  time.Time `db:"changed_at"`
+	TableName  string    `db:"table_name"`
+	IPAddress  string    `db:"ip_address"`
+	Reason     string    `db:"reason"`
+	Actor      string    `db:"actor"`
+
+	OrganizationID int64  `db:"organization_id"`
+	ChainSeq       *int64 `db:"chain_seq"`
+	PrevHash       []byte `db:"prev_hash"`
+	Hash           []byte `db:"hash"`
+}
+
+// auditLogColumns are the alarm_audit_log columns scanned into AlarmAuditEntry.
+const auditLogColumns = `id, coalesce(alarm_id, 0) as alarm_id, dev_eui, change_type, changed_by, old_values, new_values,
+	changed_at, table_name, ip_address, reason, actor, organization_id, chain_seq, prev_hash, hash`
+
+// AlarmFieldChange is a single field that differs between two versions.
+type AlarmFieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// AlarmVersion is an alarm state taken from the audit log. Deleted is set for
+// the version written by a delete, its Snapshot is the state before it.
+type AlarmVersion struct {
+	Version    int                `json:"version"`
+	AuditID    int64              `json:"audit_id"`
+	ChangeType string             `json:"change_type"`
+	ChangedBy  int64              `json:"changed_by"`
+	Actor      string             `json:"actor,omitempty"`
+	ChangedAt  time.Time          `json:"changed_at"`
+	Deleted    bool               `json:"deleted"`
+	Snapshot   *AlarmSnapshot     `json:"snapshot"`
+	Changes    []AlarmFieldChange `json:"changes"`
+}
+
+// GetAlarmSnapshot returns the alarm with the given id, deleted or not, and
+// its date windows.
+func GetAlarmSnapshot(db sqlx.Queryer, alarmID int64) (AlarmSnapshot, error) {
+	var snap AlarmSnapshot
+	if err := sqlx.Get(db, &snap.Alarm, "select * from alarm_refactor2 where id = $1", alarmID); err != nil {
+		if err == sql.ErrNoRows {
+			return snap, ErrAlarmNotFound.With("alarm_id", strconv.FormatInt(alarmID, 10))
+		}
+		return snap, HandlePSQLError(Select, err, "select error")
+	}
+	snap.AlarmDateTime = []AlarmDateFilter{}
+	if err := sqlx.Select(db, &snap.AlarmDateTime, "select * from alarm_date_time where alarm_id = $1 order by changed_at, id", alarmID); err != nil {
+		return snap, HandlePSQLError(Select, err, "select error")
+	}
+	return snap, nil
+}
+
+// GetAlarmHistory returns the versions of the given alarm in the order they
+// were made, each with the fields changed compared to the previous version.
+func GetAlarmHistory(db sqlx.Queryer, alarmID int64) ([]AlarmVersion, error) {
+	var entries []AlarmAuditEntry
+	err := sqlx.Select(db, &entries, "select "+auditLogColumns+" from alarm_audit_log where alarm_id = $1 order by changed_at, id", alarmID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+
+	var versions []AlarmVersion
+	var previous *AlarmSnapshot
+	for i, e := range entries {
+		v := AlarmVersion{
+			Version:    i + 1,
+			AuditID:    e.ID,
+			ChangeType: e.ChangeType,
+			ChangedBy:  e.ChangedBy,
+			Actor:      e.Actor,
+			ChangedAt:  e.ChangedAt,
+			Deleted:    e.ChangeType == "DELETE",
+		}
+
+		values := e.NewValues
+		if v.Deleted || isJSONNull(values) {
+			values = e.OldValues
+		}
+		if !isJSONNull(values) {
+			snap, err := decodeAlarmSnapshot(values)
+			if err != nil {
+				return nil, fmt.Errorf("decode audit entry %d error: %w", e.ID, err)
+			}
+			v.Snapshot = &snap
+		}
+
+		if v.Snapshot != nil {
+			v.Changes = DiffAlarmSnapshots(previous, v.Snapshot)
+			previous = v.Snapshot
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+// GetAlarmVersion returns the state of the alarm at the given audit log
+// version.
+func GetAlarmVersion(db sqlx.Queryer, alarmID int64, auditID int64) (AlarmSnapshot, error) {
+	versions, err := GetAlarmHistory(db, alarmID)
+	if err != nil {
+		return AlarmSnapshot{}, err
+	}
+	for _, v := range versions {
+		if v.AuditID == auditID && v.Snapshot != nil {
+			return *v.Snapshot, nil
+		}
+	}
+	return AlarmSnapshot{}, ErrDoesNotExist
+}
+
+// RevertAlarm sets the alarm row and, when the version holds them, its date
+// windows back to the given version, as returned by GetAlarmVersion. A
+// soft-deleted alarm is restored first. The template fields changed on a
+// templated alarm are marked as overridden, as for an update. It returns
+// the state before and after the revert.
+func RevertAlarm(db sqlx.Ext, alarmID int64, target AlarmSnapshot) (AlarmSnapshot, AlarmSnapshot, error) {
+	current, err := GetAlarmSnapshot(db, alarmID)
+	if err != nil {
+		return AlarmSnapshot{}, AlarmSnapshot{}, err
+	}
+	if current.DeletedAt != nil {
+		if _, err := RestoreAlarm(db, alarmID); err != nil {
+			return current, AlarmSnapshot{}, err
+		}
+	}
+
+	al := target.Alarm
+	_, err = db.Exec(`update alarm_refactor2 set
+			min_treshold = $2, max_treshold = $3, sms = $4, email = $5, notification = $6, temperature = $7,
+			humadity = $8, ec = $9, door = $10, w_leak = $11, user_id = $12, is_time_limit_active = $13,
+			alarm_start_time = $14, alarm_stop_time = $15, zone_category = $16, is_active = $17,
+			pressure = $18, notification_sound = $19, distance = $20, defrost_time = $21
+		where id = $1`,
+		alarmID, al.MinTreshold, al.MaxTreshold, al.Sms, al.Email, al.Notification, al.Temperature,
+		al.Humadity, al.Ec, al.Door, al.WaterLeak, al.UserId, al.IsTimeLimitActive,
+		al.AlarmStartTime, al.AlarmStopTime, al.ZoneCategoryId, al.IsActive,
+		al.Pressure, al.NotificationSound, al.Distance, al.DefrostTime,
+	)
+	if err != nil {
+		return current, AlarmSnapshot{}, HandlePSQLError(Update, err, "update error")
+	}
+
+	if target.AlarmDateTime != nil {
+		if _, err := db.Exec("delete from alarm_date_time where alarm_id = $1", alarmID); err != nil {
+			return current, AlarmSnapshot{}, HandlePSQLError(Delete, err, "delete error")
+		}
+		var dates []AlarmDateFilter
+		for _, d := range target.AlarmDateTime {
+			d.AlarmId = alarmID
+			dates = append(dates, d)
+		}
+		if _, err := CreateAlarmDates(db, dates); err != nil {
+			return current, AlarmSnapshot{}, err
+		}
+	}
+
+	reverted, err := GetAlarmSnapshot(db, alarmID)
+	if err != nil {
+		return current, AlarmSnapshot{}, err
+	}
+	if reverted.TemplateID == nil {
+		return current, reverted, nil
+	}
+
+	var fields []string
+	for _, c := range DiffAlarmSnapshots(&current, &reverted) {
+		if c.Field == AlarmDateTimeField || isTemplateField(c.Field) {
+			fields = append(fields, c.Field)
+		}
+	}
+	if len(fields) == 0 {
+		return current, reverted, nil
+	}
+	if err := MarkAlarmFieldsOverridden(db, alarmID, fields); err != nil {
+		return current, AlarmSnapshot{}, err
+	}
+	reverted, err = GetAlarmSnapshot(db, alarmID)
+	if err != nil {
+		return current, AlarmSnapshot{}, err
+	}
+	return current, reverted, nil
+}
+
+func isJSONNull(b []byte) bool {
+	s := strings.TrimSpace(string(b))
+	return s == "" || s == "null"
+}
+
+// decodeAlarmSnapshot decodes audit values into a snapshot. Older entries
+// were written from the API message with snake_case keys, so keys are
+// matched against the Go field names and db tags ignoring case and
+// underscores.
+func decodeAlarmSnapshot(b []byte) (AlarmSnapshot, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return AlarmSnapshot{}, err
+	}
+
+	names := make(map[string]string)
+	t := reflect.TypeOf(Alarm{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		names[normalizeAuditKey(f.Name)] = f.Name
+		if tag := f.Tag.Get("db"); tag != "" && tag != "-" {
+			names[normalizeAuditKey(tag)] = f.Name
+		}
+	}
+	names[normalizeAuditKey("AlarmDateTime")] = "AlarmDateTime"
+	names[normalizeAuditKey("id")] = "ID"
+
+	normalized := make(map[string]json.RawMessage, len(raw))
+	for k, v := range raw {
+		if name, ok := names[normalizeAuditKey(k)]; ok {
+			normalized[name] = v
+		}
+	}
+
+	nb, err := json.Marshal(normalized)
+	if err != nil {
+		return AlarmSnapshot{}, err
+	}
+	var snap AlarmSnapshot
+	if err := json.Unmarshal(nb, &snap); err != nil {
+		return AlarmSnapshot{}, err
+	}
+	return snap, nil
+}
+
+func normalizeAuditKey(k string) string {
+	return strings.ToLower(strings.ReplaceAll(k, "_", ""))
+}
+
+// DiffAlarmSnapshots returns the fields that differ between two snapshots,
+// named after their alarm_refactor2 column. A nil previous snapshot compares
+// against the zero value. Date windows are only compared when both
+// snapshots hold them.
+func DiffAlarmSnapshots(previous, current *AlarmSnapshot) []AlarmFieldChange {
+	var changes []AlarmFieldChange
+	prev := AlarmSnapshot{}
+	if previous != nil {
+		prev = *previous
+	}
+
+	pv := reflect.ValueOf(prev.Alarm)
+	cv := reflect.ValueOf(current.Alarm)
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i).Tag.Get("db")
+		if field == "" || field == "id" || field == "deleted_at" || field == "active_before_delete" {
+			continue
+		}
+		o, n := pv.Field(i).Interface(), cv.Field(i).Interface()
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, AlarmFieldChange{Field: field, Old: o, New: n})
+		}
+	}
+
+	if current.AlarmDateTime != nil && (previous == nil || prev.AlarmDateTime != nil) && !equalAlarmDates(prev.AlarmDateTime, current.AlarmDateTime) {
+		changes = append(changes, AlarmFieldChange{Field: AlarmDateTimeField, Old: prev.AlarmDateTime, New: current.AlarmDateTime})
+	}
+
+	return changes
+}
+
+func equalAlarmDates(a, b []AlarmDateFilter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].AlarmDay != b[i].AlarmDay || a[i].AlarmStartTime != b[i].AlarmStartTime || a[i].AlarmEndTime != b[i].AlarmEndTime {
+			return false
+		}
+	}
+	return true
+}
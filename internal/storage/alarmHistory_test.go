@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestDiffAlarmSnapshots(t *testing.T) {
+	dates := []AlarmDateFilter{{ID: 1, AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18}}
+	snapshot := func(modify func(s *AlarmSnapshot)) *AlarmSnapshot {
+		s := &AlarmSnapshot{
+			Alarm: Alarm{
+				ID:          7,
+				DevEui:      "0102030405060708",
+				MinTreshold: 1,
+				MaxTreshold: 10,
+				UserId:      pq.Int64Array{1, 2},
+			},
+			AlarmDateTime: dates,
+		}
+		modify(s)
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		previous   *AlarmSnapshot
+		current    *AlarmSnapshot
+		wantFields []string
+	}{
+		{
+			name:     "no change",
+			previous: snapshot(func(s *AlarmSnapshot) {}),
+			current:  snapshot(func(s *AlarmSnapshot) {}),
+		},
+		{
+			name:       "thresholds",
+			previous:   snapshot(func(s *AlarmSnapshot) {}),
+			current:    snapshot(func(s *AlarmSnapshot) { s.MinTreshold, s.MaxTreshold = 2, 20 }),
+			wantFields: []string{"min_treshold", "max_treshold"},
+		},
+		{
+			name:       "users",
+			previous:   snapshot(func(s *AlarmSnapshot) {}),
+			current:    snapshot(func(s *AlarmSnapshot) { s.UserId = pq.Int64Array{1} }),
+			wantFields: []string{"user_id"},
+		},
+		{
+			name:     "id and soft delete fields are ignored",
+			previous: snapshot(func(s *AlarmSnapshot) {}),
+			current: snapshot(func(s *AlarmSnapshot) {
+				s.ID = 8
+				s.ActiveBeforeDelete = true
+			}),
+		},
+		{
+			name:     "date window ids are ignored",
+			previous: snapshot(func(s *AlarmSnapshot) {}),
+			current: snapshot(func(s *AlarmSnapshot) {
+				s.AlarmDateTime = []AlarmDateFilter{{ID: 2, AlarmId: 7, AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18}}
+			}),
+		},
+		{
+			name:     "date window changed",
+			previous: snapshot(func(s *AlarmSnapshot) {}),
+			current: snapshot(func(s *AlarmSnapshot) {
+				s.AlarmDateTime = []AlarmDateFilter{{AlarmDay: 2, AlarmStartTime: 8, AlarmEndTime: 18}}
+			}),
+			wantFields: []string{AlarmDateTimeField},
+		},
+		{
+			name:     "date window added",
+			previous: snapshot(func(s *AlarmSnapshot) {}),
+			current: snapshot(func(s *AlarmSnapshot) {
+				s.AlarmDateTime = append(dates, AlarmDateFilter{AlarmDay: 2})
+			}),
+			wantFields: []string{AlarmDateTimeField},
+		},
+		{
+			name:     "previous without date windows",
+			previous: snapshot(func(s *AlarmSnapshot) { s.AlarmDateTime = nil }),
+			current:  snapshot(func(s *AlarmSnapshot) {}),
+		},
+		{
+			name:     "current without date windows",
+			previous: snapshot(func(s *AlarmSnapshot) {}),
+			current:  snapshot(func(s *AlarmSnapshot) { s.AlarmDateTime = nil }),
+		},
+		{
+			name:       "no previous snapshot",
+			current:    snapshot(func(s *AlarmSnapshot) { s.UserId = nil }),
+			wantFields: []string{"dev_eui", "min_treshold", "max_treshold", AlarmDateTimeField},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := DiffAlarmSnapshots(tc.previous, tc.current)
+			var fields []string
+			for _, c := range changes {
+				fields = append(fields, c.Field)
+			}
+			if len(fields) != len(tc.wantFields) {
+				t.Fatalf("got fields %v, want %v", fields, tc.wantFields)
+			}
+			for i := range fields {
+				if fields[i] != tc.wantFields[i] {
+					t.Fatalf("got fields %v, want %v", fields, tc.wantFields)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeAlarmSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  string
+		want    Alarm
+		dates   int
+		wantErr bool
+	}{
+		{
+			name:   "go field names",
+			values: `{"ID":7,"DevEui":"0102030405060708","MinTreshold":1.5,"UserId":[1,2],"AlarmDateTime":[{"AlarmDay":1}]}`,
+			want:   Alarm{ID: 7, DevEui: "0102030405060708", MinTreshold: 1.5, UserId: pq.Int64Array{1, 2}},
+			dates:  1,
+		},
+		{
+			name:   "snake case keys",
+			values: `{"id":7,"dev_eui":"0102030405060708","min_treshold":1.5,"w_leak":true,"is_time_limit_active":true}`,
+			want:   Alarm{ID: 7, DevEui: "0102030405060708", MinTreshold: 1.5, WaterLeak: true, IsTimeLimitActive: true},
+		},
+		{
+			name:   "api message keys",
+			values: `{"devEui":"0102030405060708","maxTreshold":3,"waterLeak":true,"unknown":1}`,
+			want:   Alarm{DevEui: "0102030405060708", MaxTreshold: 3, WaterLeak: true},
+		},
+		{
+			name:    "invalid json",
+			values:  `{"id":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			snap, err := decodeAlarmSnapshot([]byte(tc.values))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changes := DiffAlarmSnapshots(&AlarmSnapshot{Alarm: tc.want}, &AlarmSnapshot{Alarm: snap.Alarm}); len(changes) != 0 {
+				t.Errorf("unexpected fields: %v", changes)
+			}
+			if snap.ID != tc.want.ID {
+				t.Errorf("got id %d, want %d", snap.ID, tc.want.ID)
+			}
+			if len(snap.AlarmDateTime) != tc.dates {
+				t.Errorf("got %d date windows, want %d", len(snap.AlarmDateTime), tc.dates)
+			}
+		})
+	}
+}
@@ -7,35 +7,39 @@ import (
 )
 
 type Alarm struct {
-	ID                int64         `db:"id"`
-	DevEui            string        `db:"dev_eui"`
-	MinTreshold       float32       `db:"min_treshold"`
-	MaxTreshold       float32       `db:"max_treshold"`
-	Sms               bool          `db:"sms"`
-	Email             bool          `db:"email"`
-	Notification      bool          `db:"notification"`
-	Temperature       bool          `db:"temperature"`
-	Humadity          bool          `db:"humadity"`
-	Ec                bool          `db:"ec"`
-	Door              bool          `db:"door"`
-	WaterLeak         bool          `db:"w_leak"`
-	UserId            pq.Int64Array `db:"user_id"`
-	IpAddress         string        `db:"ip_address"`
-	IsTimeLimitActive bool          `db:"is_time_limit_active"`
-	AlarmStartTime    float32       `db:"alarm_start_time"`
-	AlarmStopTime     float32       `db:"alarm_stop_time"`
-	ZoneCategoryId    int64         `db:"zone_category"`
-	IsActive          bool          `db:"is_active"`
-	Pressure          bool          `db:"pressure"`
-	Current           float32       `db:"current"`
-	Factor            float32       `db:"factor"`
-	Power             float32       `db:"power"`
-	Voltage           float32       `db:"voltage"`
-	Status            int64         `db:"status"`
-	PowerSum          float32       `db:"power_sum"`
-	NotificationSound string        `db:"notification_sound"`
-	Distance          bool          `db:"distance"`
-	DefrostTime       int64         `db:"defrost_time"`
+	ID                 int64          `db:"id"`
+	DevEui             string         `db:"dev_eui"`
+	MinTreshold        float32        `db:"min_treshold"`
+	MaxTreshold        float32        `db:"max_treshold"`
+	Sms                bool           `db:"sms"`
+	Email              bool           `db:"email"`
+	Notification       bool           `db:"notification"`
+	Temperature        bool           `db:"temperature"`
+	Humadity           bool           `db:"humadity"`
+	Ec                 bool           `db:"ec"`
+	Door               bool           `db:"door"`
+	WaterLeak          bool           `db:"w_leak"`
+	UserId             pq.Int64Array  `db:"user_id"`
+	IpAddress          string         `db:"ip_address"`
+	IsTimeLimitActive  bool           `db:"is_time_limit_active"`
+	AlarmStartTime     float32        `db:"alarm_start_time"`
+	AlarmStopTime      float32        `db:"alarm_stop_time"`
+	ZoneCategoryId     int64          `db:"zone_category"`
+	IsActive           bool           `db:"is_active"`
+	Pressure           bool           `db:"pressure"`
+	Current            float32        `db:"current"`
+	Factor             float32        `db:"factor"`
+	Power              float32        `db:"power"`
+	Voltage            float32        `db:"voltage"`
+	Status             int64          `db:"status"`
+	PowerSum           float32        `db:"power_sum"`
+	NotificationSound  string         `db:"notification_sound"`
+	Distance           bool           `db:"distance"`
+	DefrostTime        int64          `db:"defrost_time"`
+	TemplateID         *int64         `db:"template_id"`
+	OverriddenFields   pq.StringArray `db:"overridden_fields"`
+	DeletedAt          *time.Time     `db:"deleted_at"`
+	ActiveBeforeDelete bool           `db:"active_before_delete"`
 }
 type DoorAlarm struct {
 	ID                int64         `db:"id"`
@@ -53,39 +57,43 @@ type DoorAlarm struct {
 	IsTimeLimitActive bool          `db:"is_time_limit_active"`
 }
 type OrganizationAlarm struct {
-	ID                int64         `db:"id"`
-	DevEui            string        `db:"dev_eui"`
-	MinTreshold       float32       `db:"min_treshold"`
-	MaxTreshold       float32       `db:"max_treshold"`
-	Sms               bool          `db:"sms"`
-	Email             bool          `db:"email"`
-	Notification      bool          `db:"notification"`
-	Temperature       bool          `db:"temperature"`
-	Humadity          bool          `db:"humadity"`
-	Ec                bool          `db:"ec"`
-	Door              bool          `db:"door"`
-	WaterLeak         bool          `db:"w_leak"`
-	UserId            pq.Int64Array `db:"user_id"`
-	IpAddress         string        `db:"ip_address"`
-	IsTimeLimitActive bool          `db:"is_time_limit_active"`
-	AlarmStartTime    float32       `db:"alarm_start_time"`
-	AlarmStopTime     float32       `db:"alarm_stop_time"`
-	ZoneCategoryId    int64         `db:"zone_category"`
-	IsActive          bool          `db:"is_active"`
-	ZoneName          string        `db:"zone_name"`
-	DeviceName        string        `db:"device_name"`
-	Username          string        `db:"username"`
-	Pressure          bool          `db:"pressure"`
-	Current           float32       `db:"current"`
-	Factor            float32       `db:"factor"`
-	Power             float32       `db:"power"`
-	Voltage           float32       `db:"voltage"`
-	Status            int64         `db:"status"`
-	PowerSum          float32       `db:"power_sum"`
-	NotificationSound string        `db:"notification_sound"`
-	Distance          bool          `db:"distance"`
-	Time              int64         `db:"time"`
-	DefrostTime       int64         `db:"defrost_time"`
+	ID                 int64          `db:"id"`
+	DevEui             string         `db:"dev_eui"`
+	MinTreshold        float32        `db:"min_treshold"`
+	MaxTreshold        float32        `db:"max_treshold"`
+	Sms                bool           `db:"sms"`
+	Email              bool           `db:"email"`
+	Notification       bool           `db:"notification"`
+	Temperature        bool           `db:"temperature"`
+	Humadity           bool           `db:"humadity"`
+	Ec                 bool           `db:"ec"`
+	Door               bool           `db:"door"`
+	WaterLeak          bool           `db:"w_leak"`
+	UserId             pq.Int64Array  `db:"user_id"`
+	IpAddress          string         `db:"ip_address"`
+	IsTimeLimitActive  bool           `db:"is_time_limit_active"`
+	AlarmStartTime     float32        `db:"alarm_start_time"`
+	AlarmStopTime      float32        `db:"alarm_stop_time"`
+	ZoneCategoryId     int64          `db:"zone_category"`
+	IsActive           bool           `db:"is_active"`
+	ZoneName           string         `db:"zone_name"`
+	DeviceName         string         `db:"device_name"`
+	Username           string         `db:"username"`
+	Pressure           bool           `db:"pressure"`
+	Current            float32        `db:"current"`
+	Factor             float32        `db:"factor"`
+	Power              float32        `db:"power"`
+	Voltage            float32        `db:"voltage"`
+	Status             int64          `db:"status"`
+	PowerSum           float32        `db:"power_sum"`
+	NotificationSound  string         `db:"notification_sound"`
+	Distance           bool           `db:"distance"`
+	Time               int64          `db:"time"`
+	DefrostTime        int64          `db:"defrost_time"`
+	TemplateID         *int64         `db:"template_id"`
+	OverriddenFields   pq.StringArray `db:"overridden_fields"`
+	DeletedAt          *time.Time     `db:"deleted_at"`
+	ActiveBeforeDelete bool           `db:"active_before_delete"`
 }
 type AlarmWithDates struct {
 	ID                int64   `db:"id"`
@@ -153,11 +161,59 @@ type AlarmLogs struct {
 	SubmissionDate time.Time `db:"submission_date"`
 }
 
+// AlarmTemplate is a reusable alarm definition that can be linked to zones.
+type AlarmTemplate struct {
+	ID                int64               `db:"id" json:"id"`
+	OrganizationID    int64               `db:"organization_id" json:"organization_id"`
+	Name              string              `db:"name" json:"name"`
+	MinTreshold       float32             `db:"min_treshold" json:"min_treshold"`
+	MaxTreshold       float32             `db:"max_treshold" json:"max_treshold"`
+	Sms               bool                `db:"sms" json:"sms"`
+	Email             bool                `db:"email" json:"email"`
+	Notification      bool                `db:"notification" json:"notification"`
+	Temperature       bool                `db:"temperature" json:"temperature"`
+	Humadity          bool                `db:"humadity" json:"humadity"`
+	Ec                bool                `db:"ec" json:"ec"`
+	Door              bool                `db:"door" json:"door"`
+	WaterLeak         bool                `db:"w_leak" json:"w_leak"`
+	Pressure          bool                `db:"pressure" json:"pressure"`
+	Distance          bool                `db:"distance" json:"distance"`
+	UserId            pq.Int64Array       `db:"user_id" json:"user_id"`
+	IsTimeLimitActive bool                `db:"is_time_limit_active" json:"is_time_limit_active"`
+	ZoneCategoryId    int64               `db:"zone_category" json:"zone_category"`
+	NotificationSound string              `db:"notification_sound" json:"notification_sound"`
+	DefrostTime       int64               `db:"defrost_time" json:"defrost_time"`
+	CreatedAt         time.Time           `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time           `db:"updated_at" json:"updated_at"`
+	Dates             []AlarmTemplateDate `db:"-" json:"dates"`
+}
+
+// AlarmTemplateDate is a date window of an alarm template.
+type AlarmTemplateDate struct {
+	ID         int64   `db:"id" json:"id"`
+	TemplateID int64   `db:"template_id" json:"template_id"`
+	AlarmDay   int64   `db:"alarm_day" json:"alarm_day"`
+	StartTime  float32 `db:"start_time" json:"start_time"`
+	EndTime    float32 `db:"end_time" json:"end_time"`
+}
+
+// AlarmTemplateLink links a template to a zone or to a zone category.
+// Exactly one of ZoneID and ZoneCategory is set.
+type AlarmTemplateLink struct {
+	ID           int64     `db:"id" json:"id"`
+	TemplateID   int64     `db:"template_id" json:"template_id"`
+	ZoneID       *int64    `db:"zone_id" json:"zone_id"`
+	ZoneCategory *int64    `db:"zone_category" json:"zone_category"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
 // AlarmFilters filters
 type AlarmFilters struct {
 	Limit  int    `db:"limit"`
 	DevEui string `db:"dev_eui"`
 	UserID int64  `db:"user_id"`
+	// ZoneUserID limits the alarms to the zones of the given user when set.
+	ZoneUserID int64 `db:"zone_user_id"`
 }
 
 // SMSRequestBody ...
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// SoftDeleteAlarms marks the given alarms as deleted and deactivates their
+// active automation rules. The alarms and their date windows are kept until
+// PurgeDeletedAlarms removes them. It returns the number of deleted alarms.
+func SoftDeleteAlarms(db sqlx.Queryer, alarmIDs []int64) (int64, error) {
+	var count int64
+	err := sqlx.Get(db, &count, `
+		with deleted as (
+			update alarm_refactor2
+			set deleted_at = now(), active_before_delete = is_active, is_active = false
+			where id = any($1) and deleted_at is null
+			returning id, deleted_at
+		), rules as (
+			update alarm_automation_rules as r
+			set is_active = false, deleted_at = d.deleted_at
+			from deleted as d
+			where r.alarm_id = d.id and r.is_active = true
+			returning r.id
+		)
+		select count(*) from deleted`, pq.Array(alarmIDs))
+	if err != nil {
+		return 0, HandlePSQLError(Update, err, "update error")
+	}
+	return count, nil
+}
+
+// RestoreAlarm brings back a soft-deleted alarm together with the automation
+// rules that were deactivated by its delete. The date windows were never
+// removed and become visible again with the alarm.
+func RestoreAlarm(db sqlx.Ext, alarmID int64) (Alarm, error) {
+	var al Alarm
+	err := sqlx.Get(db, &al, "select * from alarm_refactor2 where id = $1 and deleted_at is not null for update", alarmID)
+	if err != nil {
+		return al, HandlePSQLError(Select, err, "select error")
+	}
+
+	_, err = db.Exec(`update alarm_automation_rules set is_active = true, deleted_at = null
+		where alarm_id = $1 and deleted_at = $2`, alarmID, al.DeletedAt)
+	if err != nil {
+		return al, HandlePSQLError(Update, err, "update error")
+	}
+
+	err = sqlx.Get(db, &al, `update alarm_refactor2
+		set deleted_at = null, is_active = active_before_delete, active_before_delete = false
+		where id = $1
+		returning *`, alarmID)
+	if err != nil {
+		return al, HandlePSQLError(Update, err, "update error")
+	}
+	return al, nil
+}
+
+// PurgeDeletedAlarms permanently removes the alarms that were soft-deleted
+// before the given time, together with their date windows, automation
+// rules, cold room restrictions and the idempotency keys that created them.
+// It returns the number of purged alarms.
+func PurgeDeletedAlarms(db sqlx.Queryer, before time.Time) (int64, error) {
+	var count int64
+	err := sqlx.Get(db, &count, `
+		with purged as (
+			select id from alarm_refactor2 where deleted_at < $1
+		), dates as (
+			delete from alarm_date_time where alarm_id in (select id from purged)
+		), rules as (
+			delete from alarm_automation_rules where alarm_id in (select id from purged)
+		), cold_rooms as (
+			delete from cold_room_restrictions where alarm_id in (select id from purged)
+		), utku as (
+			delete from utku_table where alarm_id in (select id from purged)
+		), keys as (
+			delete from alarm_idempotency_key where alarm_id in (select id from purged)
+		), alarms as (
+			delete from alarm_refactor2 where id in (select id from purged)
+			returning id
+		)
+		select count(*) from alarms`, before)
+	if err != nil {
+		return 0, HandlePSQLError(Delete, err, "delete error")
+	}
+	return count, nil
+}
@@ -0,0 +1,451 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// AlarmDateTimeField is the pseudo field stored in overridden_fields when the
+// date windows of a templated alarm were changed on the alarm itself.
+const AlarmDateTimeField = "alarm_date_time"
+
+// templateFields lists the alarm_refactor2 columns that are copied from an
+// alarm template to its linked alarms.
+var templateFields = []string{
+	"min_treshold",
+	"max_treshold",
+	"sms",
+	"email",
+	"notification",
+	"temperature",
+	"humadity",
+	"ec",
+	"door",
+	"w_leak",
+	"pressure",
+	"distance",
+	"user_id",
+	"is_time_limit_active",
+	"zone_category",
+	"notification_sound",
+	"defrost_time",
+}
+
+// isTemplateField returns whether the given alarm_refactor2 column is copied
+// from the alarm template.
+func isTemplateField(field string) bool {
+	for _, f := range templateFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// templateCoverageSQL selects the hex encoded dev_eui of every device of
+// the template organization in a zone linked to the template given as $1.
+// Zone categories are shared by the organizations, their zones are limited
+// to the devices of the template organization.
+const templateCoverageSQL = `
+	select distinct encode(d.dev_eui, 'hex')
+	from alarm_template_link as l
+		inner join alarm_template as t on t.id = l.template_id
+		inner join zone as z on z.zone_id = l.zone_id or z.zone_category = l.zone_category
+		inner join device as d on d.dev_eui::text = any(z.devices) and d.organization_id = t.organization_id
+	where l.template_id = $1`
+
+// CreateAlarmTemplate inserts the given template and its date windows.
+func CreateAlarmTemplate(db sqlx.Queryer, t *AlarmTemplate) error {
+	err := sqlx.Get(db, t, `
+		insert into alarm_template (
+			organization_id, name, min_treshold, max_treshold, sms, email, notification, temperature,
+			humadity, ec, door, w_leak, pressure, distance, user_id, is_time_limit_active, zone_category,
+			notification_sound, defrost_time
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		returning *`,
+		t.OrganizationID, t.Name, t.MinTreshold, t.MaxTreshold, t.Sms, t.Email, t.Notification, t.Temperature,
+		t.Humadity, t.Ec, t.Door, t.WaterLeak, t.Pressure, t.Distance, t.UserId, t.IsTimeLimitActive,
+		t.ZoneCategoryId, t.NotificationSound, t.DefrostTime,
+	)
+	if err != nil {
+		return HandlePSQLError(Insert, err, "insert error")
+	}
+
+	return createAlarmTemplateDates(db, t)
+}
+
+// GetAlarmTemplate returns the template with the given id and its date windows.
+func GetAlarmTemplate(db sqlx.Queryer, id int64) (AlarmTemplate, error) {
+	var t AlarmTemplate
+	if err := sqlx.Get(db, &t, "select * from alarm_template where id = $1", id); err != nil {
+		return t, HandlePSQLError(Select, err, "select error")
+	}
+	if err := sqlx.Select(db, &t.Dates, "select * from alarm_template_date_time where template_id = $1 order by id", id); err != nil {
+		return t, HandlePSQLError(Select, err, "select error")
+	}
+	return t, nil
+}
+
+// GetAlarmTemplates returns the templates of the given organization.
+func GetAlarmTemplates(db sqlx.Queryer, organizationID int64) ([]AlarmTemplate, error) {
+	var templates []AlarmTemplate
+	err := sqlx.Select(db, &templates, "select * from alarm_template where organization_id = $1 order by name", organizationID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	for i := range templates {
+		err := sqlx.Select(db, &templates[i].Dates, "select * from alarm_template_date_time where template_id = $1 order by id", templates[i].ID)
+		if err != nil {
+			return nil, HandlePSQLError(Select, err, "select error")
+		}
+	}
+	return templates, nil
+}
+
+// UpdateAlarmTemplate updates the given template and replaces its date windows.
+// Linked alarms are not touched, use SyncAlarmTemplate to propagate the change.
+func UpdateAlarmTemplate(db sqlx.Ext, t *AlarmTemplate) error {
+	res, err := db.Exec(`
+		update alarm_template set
+			name = $2, min_treshold = $3, max_treshold = $4, sms = $5, email = $6, notification = $7,
+			temperature = $8, humadity = $9, ec = $10, door = $11, w_leak = $12, pressure = $13,
+			distance = $14, user_id = $15, is_time_limit_active = $16, zone_category = $17,
+			notification_sound = $18, defrost_time = $19, updated_at = now()
+		where id = $1`,
+		t.ID, t.Name, t.MinTreshold, t.MaxTreshold, t.Sms, t.Email, t.Notification, t.Temperature,
+		t.Humadity, t.Ec, t.Door, t.WaterLeak, t.Pressure, t.Distance, t.UserId, t.IsTimeLimitActive,
+		t.ZoneCategoryId, t.NotificationSound, t.DefrostTime,
+	)
+	if err != nil {
+		return HandlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return HandlePSQLError(Update, err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	if _, err := db.Exec("delete from alarm_template_date_time where template_id = $1", t.ID); err != nil {
+		return HandlePSQLError(Delete, err, "delete error")
+	}
+	return createAlarmTemplateDates(db, t)
+}
+
+// DeleteAlarmTemplate deletes the given template. Linked alarms are kept and
+// become regular alarms, each detached alarm is written to the audit log
+// with the given author.
+func DeleteAlarmTemplate(db sqlx.Ext, id int64, author AuditAuthor) error {
+	var alarms []Alarm
+	err := sqlx.Select(db, &alarms, "select * from alarm_refactor2 where template_id = $1 order by id for update", id)
+	if err != nil {
+		return HandlePSQLError(Select, err, "select error")
+	}
+	previous, err := WithAlarmDates(db, alarms)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("update alarm_refactor2 set template_id = null where template_id = $1", id); err != nil {
+		return HandlePSQLError(Update, err, "update error")
+	}
+	for _, prev := range previous {
+		next := prev
+		next.TemplateID = nil
+		err := LogAudit(db, AuditLog{
+			AlarmID:    prev.ID,
+			DevEui:     prev.DevEui,
+			ChangeType: "UPDATE",
+			UserID:     author.UserID,
+			IPAddress:  author.IPAddress,
+			Actor:      author.Actor,
+			Reason:     "detached from alarm template",
+			Old:        prev,
+			New:        next,
+		})
+		if err != nil {
+			return fmt.Errorf("could not log audit: %w", err)
+		}
+	}
+
+	res, err := db.Exec("delete from alarm_template where id = $1", id)
+	if err != nil {
+		return HandlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return HandlePSQLError(Delete, err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+func createAlarmTemplateDates(db sqlx.Queryer, t *AlarmTemplate) error {
+	for i := range t.Dates {
+		t.Dates[i].TemplateID = t.ID
+		err := db.QueryRowx(`insert into alarm_template_date_time (template_id, alarm_day, start_time, end_time)
+			values ($1, $2, $3, $4) returning id`,
+			t.ID, t.Dates[i].AlarmDay, t.Dates[i].StartTime, t.Dates[i].EndTime).Scan(&t.Dates[i].ID)
+		if err != nil {
+			return HandlePSQLError(Insert, err, "insert error")
+		}
+	}
+	return nil
+}
+
+// CreateAlarmTemplateLink links a template to a zone or a zone category.
+func CreateAlarmTemplateLink(db sqlx.Queryer, l *AlarmTemplateLink) error {
+	err := sqlx.Get(db, l, `insert into alarm_template_link (template_id, zone_id, zone_category)
+		values ($1, $2, $3) returning *`, l.TemplateID, l.ZoneID, l.ZoneCategory)
+	if err != nil {
+		return HandlePSQLError(Insert, err, "insert error")
+	}
+	return nil
+}
+
+// GetAlarmTemplateLinks returns the zone and zone category links of a template.
+func GetAlarmTemplateLinks(db sqlx.Queryer, templateID int64) ([]AlarmTemplateLink, error) {
+	var links []AlarmTemplateLink
+	err := sqlx.Select(db, &links, "select * from alarm_template_link where template_id = $1 order by id", templateID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return links, nil
+}
+
+// GetAlarmTemplateLink returns the template link with the given id.
+func GetAlarmTemplateLink(db sqlx.Queryer, id int64) (AlarmTemplateLink, error) {
+	var l AlarmTemplateLink
+	if err := sqlx.Get(db, &l, "select * from alarm_template_link where id = $1", id); err != nil {
+		return l, HandlePSQLError(Select, err, "select error")
+	}
+	return l, nil
+}
+
+// GetAlarmTemplateLinkDevices returns the hex encoded dev_eui of the devices
+// of the given organization that the link would cover.
+func GetAlarmTemplateLinkDevices(db sqlx.Queryer, organizationID int64, l AlarmTemplateLink) ([]string, error) {
+	var devEuis []string
+	err := sqlx.Select(db, &devEuis, `
+		select distinct encode(d.dev_eui, 'hex')
+		from zone as z
+			inner join device as d on d.dev_eui::text = any(z.devices) and d.organization_id = $1
+		where z.zone_id = $2 or z.zone_category = $3`, organizationID, l.ZoneID, l.ZoneCategory)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return devEuis, nil
+}
+
+// DeleteAlarmTemplateLink removes a template link. Alarms of devices that are
+// no longer covered are detached by the next SyncAlarmTemplate.
+func DeleteAlarmTemplateLink(db sqlx.Execer, id int64) error {
+	res, err := db.Exec("delete from alarm_template_link where id = $1", id)
+	if err != nil {
+		return HandlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return HandlePSQLError(Delete, err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	return nil
+}
+
+// SyncAlarmTemplate reconciles the alarms linked to the given template.
+// It copies the template values and date windows to linked alarms except
+// for their overridden fields, and detaches the alarms of devices that are
+// no longer covered. Only the date windows that differ from the template
+// are rewritten. Every changed alarm is written to the audit log with its
+// date windows and the given author. The alarms of the covered devices that
+// have none yet, as returned by GetAlarmTemplateUncoveredDevices, are
+// created by the caller.
+func SyncAlarmTemplate(db sqlx.Ext, templateID int64, author AuditAuthor) error {
+	var alarms []Alarm
+	err := sqlx.Select(db, &alarms, "select * from alarm_refactor2 where template_id = $1 and deleted_at is null for update", templateID)
+	if err != nil {
+		return HandlePSQLError(Select, err, "select error")
+	}
+	previous, err := WithAlarmDates(db, alarms)
+	if err != nil {
+		return err
+	}
+	previousByID := make(map[int64]AlarmSnapshot, len(previous))
+	for _, snap := range previous {
+		previousByID[snap.ID] = snap
+	}
+	var templateDates []AlarmTemplateDate
+	err = sqlx.Select(db, &templateDates, "select * from alarm_template_date_time where template_id = $1 order by id", templateID)
+	if err != nil {
+		return HandlePSQLError(Select, err, "select error")
+	}
+
+	logChange := func(prev, next AlarmSnapshot, reason string) error {
+		err := LogAudit(db, AuditLog{
+			AlarmID:    next.ID,
+			DevEui:     next.DevEui,
+			ChangeType: "UPDATE",
+			UserID:     author.UserID,
+			IPAddress:  author.IPAddress,
+			Actor:      author.Actor,
+			Reason:     reason,
+			Old:        prev,
+			New:        next,
+		})
+		if err != nil {
+			return fmt.Errorf("could not log audit: %w", err)
+		}
+		return nil
+	}
+
+	// Detach the alarms of devices that left the linked zones.
+	var detached []Alarm
+	err = sqlx.Select(db, &detached, `update alarm_refactor2 set template_id = null
+		where template_id = $1 and deleted_at is null and dev_eui not in (`+templateCoverageSQL+`)
+		returning *`, templateID)
+	if err != nil {
+		return HandlePSQLError(Update, err, "update error")
+	}
+	for _, al := range detached {
+		prev := previousByID[al.ID]
+		if err := logChange(prev, AlarmSnapshot{Alarm: al, AlarmDateTime: prev.AlarmDateTime}, "detached from alarm template"); err != nil {
+			return err
+		}
+	}
+
+	// Propagate the template values to the fields that were not overridden.
+	var sets []string
+	for _, f := range templateFields {
+		sets = append(sets, fmt.Sprintf("%[1]s = case when '%[1]s' = any(ar.overridden_fields) then ar.%[1]s else t.%[1]s end", f))
+	}
+	var updated []Alarm
+	err = sqlx.Select(db, &updated, `update alarm_refactor2 as ar set `+strings.Join(sets, ", ")+`
+		from alarm_template as t
+		where t.id = $1 and ar.template_id = t.id and ar.deleted_at is null
+		returning ar.*`, templateID)
+	if err != nil {
+		return HandlePSQLError(Update, err, "update error")
+	}
+	for _, al := range updated {
+		prev := previousByID[al.ID]
+		next := AlarmSnapshot{Alarm: al, AlarmDateTime: prev.AlarmDateTime}
+		if !isOverridden(al, AlarmDateTimeField) && !sameTemplateDates(prev.AlarmDateTime, templateDates) {
+			if next.AlarmDateTime, err = replaceAlarmDates(db, al.ID, templateDates); err != nil {
+				return err
+			}
+		}
+		if reflect.DeepEqual(prev, next) {
+			continue
+		}
+		if err := logChange(prev, next, "alarm template changed"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isOverridden returns whether the given field of a templated alarm was
+// changed on the alarm itself.
+func isOverridden(al Alarm, field string) bool {
+	for _, f := range al.OverriddenFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTemplateDates returns whether the date windows of an alarm are those
+// of its template, in the same order.
+func sameTemplateDates(dates []AlarmDateFilter, templateDates []AlarmTemplateDate) bool {
+	if len(dates) != len(templateDates) {
+		return false
+	}
+	for i, d := range dates {
+		td := templateDates[i]
+		if d.AlarmDay != td.AlarmDay || d.AlarmStartTime != td.StartTime || d.AlarmEndTime != td.EndTime {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceAlarmDates replaces the date windows of the given alarm with those
+// of its template and returns them.
+func replaceAlarmDates(db sqlx.Ext, alarmID int64, templateDates []AlarmTemplateDate) ([]AlarmDateFilter, error) {
+	if _, err := db.Exec("delete from alarm_date_time where alarm_id = $1", alarmID); err != nil {
+		return nil, HandlePSQLError(Delete, err, "delete error")
+	}
+	dates := make([]AlarmDateFilter, 0, len(templateDates))
+	for _, td := range templateDates {
+		d := AlarmDateFilter{AlarmId: alarmID, AlarmDay: td.AlarmDay, AlarmStartTime: td.StartTime, AlarmEndTime: td.EndTime}
+		err := db.QueryRowx(`insert into alarm_date_time (alarm_id, alarm_day, start_time, end_time)
+			values ($1, $2, $3, $4) returning id`, d.AlarmId, d.AlarmDay, d.AlarmStartTime, d.AlarmEndTime).Scan(&d.ID)
+		if err != nil {
+			return nil, HandlePSQLError(Insert, err, "insert error")
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// GetAlarmTemplateUncoveredDevices returns the hex encoded dev_eui of the
+// devices covered by the template that have no alarm of it yet. Devices
+// whose templated alarm was deleted are not returned.
+func GetAlarmTemplateUncoveredDevices(db sqlx.Queryer, templateID int64) ([]string, error) {
+	var devEuis []string
+	err := sqlx.Select(db, &devEuis, `select c.dev_eui from (`+templateCoverageSQL+`) as c(dev_eui)
+		where not exists (
+			select 1 from alarm_refactor2 as ar where ar.template_id = $1 and ar.dev_eui = c.dev_eui
+		)
+		order by c.dev_eui`, templateID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return devEuis, nil
+}
+
+// GetAlarmTemplateDevices returns the hex encoded dev_eui of the devices
+// covered by the template.
+func GetAlarmTemplateDevices(db sqlx.Queryer, templateID int64) ([]string, error) {
+	var devEuis []string
+	if err := sqlx.Select(db, &devEuis, templateCoverageSQL, templateID); err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return devEuis, nil
+}
+
+// GetAlarmTemplateIDs returns the ids of the templates linked to a zone or
+// zone category.
+func GetAlarmTemplateIDs(db sqlx.Queryer) ([]int64, error) {
+	var ids []int64
+	if err := sqlx.Select(db, &ids, "select distinct template_id from alarm_template_link order by template_id"); err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return ids, nil
+}
+
+// MarkAlarmFieldsOverridden records that the given fields of a templated
+// alarm were changed on the alarm itself. Alarms without a template are
+// left untouched.
+func MarkAlarmFieldsOverridden(db sqlx.Execer, alarmID int64, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	_, err := db.Exec(`update alarm_refactor2
+		set overridden_fields = array(select distinct unnest(overridden_fields || $2::text[]))
+		where id = $1 and template_id is not null`, alarmID, pq.StringArray(fields))
+	if err != nil {
+		return HandlePSQLError(Update, err, "update error")
+	}
+	return nil
+}
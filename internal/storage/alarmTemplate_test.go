@@ -0,0 +1,59 @@
+package storage
+
+import "testing"
+
+func TestSameTemplateDates(t *testing.T) {
+	templateDates := []AlarmTemplateDate{
+		{ID: 1, TemplateID: 3, AlarmDay: 1, StartTime: 8, EndTime: 18},
+		{ID: 2, TemplateID: 3, AlarmDay: 2, StartTime: 8, EndTime: 12},
+	}
+
+	tests := []struct {
+		name  string
+		dates []AlarmDateFilter
+		want  bool
+	}{
+		{
+			name: "same windows",
+			dates: []AlarmDateFilter{
+				{ID: 10, AlarmId: 7, AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18},
+				{ID: 11, AlarmId: 7, AlarmDay: 2, AlarmStartTime: 8, AlarmEndTime: 12},
+			},
+			want: true,
+		},
+		{
+			name: "other end time",
+			dates: []AlarmDateFilter{
+				{AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18},
+				{AlarmDay: 2, AlarmStartTime: 8, AlarmEndTime: 13},
+			},
+		},
+		{
+			name: "other order",
+			dates: []AlarmDateFilter{
+				{AlarmDay: 2, AlarmStartTime: 8, AlarmEndTime: 12},
+				{AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18},
+			},
+		},
+		{
+			name:  "missing window",
+			dates: []AlarmDateFilter{{AlarmDay: 1, AlarmStartTime: 8, AlarmEndTime: 18}},
+		},
+		{
+			name:  "no windows",
+			dates: []AlarmDateFilter{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sameTemplateDates(tc.dates, templateDates); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+
+	if !sameTemplateDates(nil, nil) {
+		t.Error("got false without windows, want true")
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/yurttasutkan/alarmservice/pkg/changefeed"
+)
+
+// AuditTableAlarm is the table name recorded for alarm changes.
+const AuditTableAlarm = "alarm_refactor2"
+
+// Actors of the changes made by the service itself.
+const (
+	ActorTemplateSync = "template-sync"
+)
+
+// AuditLog is a configuration change written to the alarm_audit_log table.
+// Old and New are marshaled to JSON, nil means there is no value (INSERT
+// has no old value, DELETE has no new value). Actor is set instead of
+// UserID for the changes made by the service itself.
+type AuditLog struct {
+	TableName  string
+	AlarmID    int64
+	DevEui     string
+	ChangeType string
+	UserID     int64
+	IPAddress  string
+	Actor      string
+	Reason     string
+	Old        interface{}
+	New        interface{}
+}
+
+// AuditAuthor is the author of a change: a user and the address the change
+// came from, or an actor of the service itself.
+type AuditAuthor struct {
+	UserID    int64
+	IPAddress string
+	Actor     string
+}
+
+// LogAudit writes the given change to alarm_audit_log and appends it to the
+// hash chain of the device's organization. Alarm changes are also published
+// on the change feed. Pass the transaction of the change so that the audit
+// entry is committed or rolled back with it, the chain head stays locked
+// until then.
+func LogAudit(db sqlx.Ext, l AuditLog) error {
+	if l.TableName == "" {
+		l.TableName = AuditTableAlarm
+	}
+
+	oldJSON, err := marshalAuditValue(l.Old)
+	if err != nil {
+		return fmt.Errorf("marshal old audit value error: %w", err)
+	}
+	newJSON, err := marshalAuditValue(l.New)
+	if err != nil {
+		return fmt.Errorf("marshal new audit value error: %w", err)
+	}
+
+	var organizationID int64
+	err = sqlx.Get(db, &organizationID, `select coalesce((
+		select organization_id from device where dev_eui::text = '\x' || $1 limit 1), 0)`, l.DevEui)
+	if err != nil {
+		return HandlePSQLError(Select, err, "select organization error")
+	}
+
+	head, err := lockAuditChain(db, organizationID)
+	if err != nil {
+		return err
+	}
+
+	var e AlarmAuditEntry
+	err = sqlx.Get(db, &e, `
+		insert into alarm_audit_log (alarm_id, dev_eui, change_type, changed_by, old_values, new_values, table_name, ip_address, reason,
+			actor, organization_id, prev_hash)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		returning `+auditLogColumns,
+		l.AlarmID, l.DevEui, l.ChangeType, l.UserID, oldJSON, newJSON, l.TableName, l.IPAddress, l.Reason,
+		l.Actor, organizationID, head.LastHash,
+	)
+	if err != nil {
+		return HandlePSQLError(Insert, err, "insert audit log error")
+	}
+
+	if err := sealAuditEntry(db, e, head.LastSeq+1); err != nil {
+		return err
+	}
+	if e.TableName != AuditTableAlarm {
+		return nil
+	}
+	return changefeed.Notify(db, changefeed.Event{
+		ID:             e.ID,
+		Type:           e.ChangeType,
+		AlarmID:        e.AlarmID,
+		DevEui:         e.DevEui,
+		OrganizationID: e.OrganizationID,
+		Time:           e.ChangedAt,
+	})
+}
+
+func marshalAuditValue(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// GetAlarmLogs returns the audit entries of the given device in the format
+// of the old alarm_change_logs table, oldest first.
+func GetAlarmLogs(db sqlx.Queryer, devEui string) ([]AlarmLogs, error) {
+	var entries []AlarmAuditEntry
+	err := sqlx.Select(db, &entries, "select "+auditLogColumns+" from alarm_audit_log where dev_eui = $1 and table_name = $2 order by changed_at, id", devEui, AuditTableAlarm)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+
+	logs := make([]AlarmLogs, 0, len(entries))
+	for _, e := range entries {
+		values := e.NewValues
+		if e.ChangeType == "DELETE" || isJSONNull(values) {
+			values = e.OldValues
+		}
+		if isJSONNull(values) {
+			continue
+		}
+		snap, err := decodeAlarmSnapshot(values)
+		if err != nil {
+			return nil, fmt.Errorf("decode audit entry %d error: %w", e.ID, err)
+		}
+
+		l := AlarmLogs{
+			DevEui:         e.DevEui,
+			MinTreshold:    snap.MinTreshold,
+			MaxTreshold:    snap.MaxTreshold,
+			UserId:         e.ChangedBy,
+			IpAddress:      e.IPAddress,
+			Sms:            snap.Sms,
+			Temperature:    snap.Temperature,
+			Humadity:       snap.Humadity,
+			Ec:             snap.Ec,
+			Door:           snap.Door,
+			WaterLeak:      snap.WaterLeak,
+			SubmissionDate: e.ChangedAt,
+		}
+		if e.ChangeType == "DELETE" {
+			l.IsDeleted = 1
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
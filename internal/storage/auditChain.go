@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// AuditChainBreak is an audit entry at which the hash chain is broken.
+type AuditChainBreak struct {
+	AuditID int64  `json:"audit_id"`
+	Reason  string `json:"reason"`
+}
+
+// AuditChainReport is the result of verifying the audit chain of an
+// organization.
+type AuditChainReport struct {
+	OrganizationID int64             `json:"organization_id"`
+	Entries        int               `json:"entries"`
+	LastID         int64             `json:"last_id"`
+	Breaks         []AuditChainBreak `json:"breaks"`
+}
+
+// Valid returns true when the chain has no breaks.
+func (r AuditChainReport) Valid() bool {
+	return len(r.Breaks) == 0
+}
+
+// auditChainHead is the last entry of the audit chain of an organization.
+type auditChainHead struct {
+	LastHash []byte `db:"last_hash"`
+	LastSeq  int64  `db:"last_seq"`
+}
+
+// lockAuditChain locks the chain head of the given organization, creating it
+// when needed, and returns it.
+func lockAuditChain(db sqlx.Queryer, organizationID int64) (auditChainHead, error) {
+	var head auditChainHead
+	err := sqlx.Get(db, &head, `
+		insert into alarm_audit_chain (organization_id) values ($1)
+		on conflict (organization_id) do update set organization_id = excluded.organization_id
+		returning last_hash, last_seq`, organizationID)
+	if err != nil {
+		return head, HandlePSQLError(Update, err, "lock audit chain error")
+	}
+	return head, nil
+}
+
+// sealAuditEntry stores the hash and the chain position of the given entry
+// and moves the chain head of its organization to it. The chain head must
+// be locked.
+func sealAuditEntry(db sqlx.Execer, e AlarmAuditEntry, seq int64) error {
+	hash := auditEntryHash(e)
+	if _, err := db.Exec("update alarm_audit_log set hash = $2, chain_seq = $3 where id = $1", e.ID, hash, seq); err != nil {
+		return HandlePSQLError(Update, err, "update audit log hash error")
+	}
+	_, err := db.Exec("update alarm_audit_chain set last_id = $2, last_hash = $3, last_seq = $4 where organization_id = $1",
+		e.OrganizationID, e.ID, hash, seq)
+	if err != nil {
+		return HandlePSQLError(Update, err, "update audit chain error")
+	}
+	return nil
+}
+
+// auditEntryHash returns the sha256 of the entry content and its prev_hash.
+// Every field is length-prefixed so that moving bytes between fields changes
+// the hash. The actor is only hashed when set, the hashes of the entries
+// written before it was introduced are unchanged.
+func auditEntryHash(e AlarmAuditEntry) []byte {
+	h := sha256.New()
+	fields := [][]byte{
+		[]byte(strconv.FormatInt(e.ID, 10)),
+		[]byte(strconv.FormatInt(e.OrganizationID, 10)),
+		[]byte(strconv.FormatInt(e.AlarmID, 10)),
+		[]byte(e.DevEui),
+		[]byte(e.ChangeType),
+		[]byte(strconv.FormatInt(e.ChangedBy, 10)),
+		e.OldValues,
+		e.NewValues,
+		[]byte(e.ChangedAt.UTC().Format(time.RFC3339Nano)),
+		[]byte(e.TableName),
+		[]byte(e.IPAddress),
+		[]byte(e.Reason),
+		e.PrevHash,
+	}
+	if e.Actor != "" {
+		fields = append(fields, []byte(e.Actor))
+	}
+	for _, f := range fields {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(f)))
+		h.Write(n[:])
+		h.Write(f)
+	}
+	return h.Sum(nil)
+}
+
+// SealAuditLog appends the audit entries that have no hash yet, such as the
+// ones written before the hash chain was introduced, to the chain of their
+// organization in id order. They are appended after the entries that are
+// already sealed, even those with a higher id: the chain order is kept in
+// chain_seq and can differ from the id order.
+func SealAuditLog(db *sqlx.DB) error {
+	var organizationIDs []int64
+	err := sqlx.Select(db, &organizationIDs, "select distinct organization_id from alarm_audit_log where hash is null")
+	if err != nil {
+		return HandlePSQLError(Select, err, "select error")
+	}
+
+	for _, organizationID := range organizationIDs {
+		tx, err := db.Beginx()
+		if err != nil {
+			return fmt.Errorf("could not start transaction: %w", err)
+		}
+		n, err := sealOrganizationAuditLog(tx, organizationID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("seal audit log of organization %d error: %w", organizationID, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit transaction: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"organization_id": organizationID,
+			"entries":         n,
+		}).Info("storage: audit log entries sealed")
+	}
+	return nil
+}
+
+func sealOrganizationAuditLog(tx *sqlx.Tx, organizationID int64) (int, error) {
+	head, err := lockAuditChain(tx, organizationID)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []AlarmAuditEntry
+	err = tx.Select(&entries, "select "+auditLogColumns+" from alarm_audit_log where organization_id = $1 and hash is null order by id", organizationID)
+	if err != nil {
+		return 0, HandlePSQLError(Select, err, "select error")
+	}
+
+	prevHash, seq := head.LastHash, head.LastSeq
+	for _, e := range entries {
+		e.PrevHash = prevHash
+		seq++
+		if _, err := tx.Exec("update alarm_audit_log set prev_hash = $2 where id = $1", e.ID, e.PrevHash); err != nil {
+			return 0, HandlePSQLError(Update, err, "update audit log error")
+		}
+		if err := sealAuditEntry(tx, e, seq); err != nil {
+			return 0, err
+		}
+		prevHash = auditEntryHash(e)
+	}
+	return len(entries), nil
+}
+
+// GetAuditChainOrganizations returns the organizations that have audit entries.
+func GetAuditChainOrganizations(db sqlx.Queryer) ([]int64, error) {
+	var ids []int64
+	err := sqlx.Select(db, &ids, `select organization_id from alarm_audit_chain
+		union select distinct organization_id from alarm_audit_log
+		order by organization_id`)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return ids, nil
+}
+
+// VerifyAuditChain walks the audit chain of the organization and reports
+// the entries whose hash does not match their content or whose prev_hash
+// does not match the previous entry. Entries are walked in chain order, the
+// unsealed ones last. Entries removed from the end of the chain are detected
+// through the chain head.
+func VerifyAuditChain(db sqlx.Queryer, organizationID int64) (AuditChainReport, error) {
+	report := AuditChainReport{OrganizationID: organizationID}
+
+	rows, err := db.Queryx("select "+auditLogColumns+" from alarm_audit_log where organization_id = $1 order by chain_seq nulls last, id", organizationID)
+	if err != nil {
+		return report, HandlePSQLError(Select, err, "select error")
+	}
+	defer rows.Close()
+
+	v := auditChainVerifier{report: report}
+	for rows.Next() {
+		var e AlarmAuditEntry
+		if err := rows.StructScan(&e); err != nil {
+			return v.report, HandlePSQLError(Select, err, "scan error")
+		}
+		v.add(e)
+	}
+	if err := rows.Err(); err != nil {
+		return v.report, HandlePSQLError(Select, err, "select error")
+	}
+
+	var head struct {
+		LastID   *int64 `db:"last_id"`
+		LastHash []byte `db:"last_hash"`
+	}
+	err = sqlx.Get(db, &head, "select last_id, last_hash from alarm_audit_chain where organization_id = $1", organizationID)
+	if err != nil && err != sql.ErrNoRows {
+		return v.report, HandlePSQLError(Select, err, "select error")
+	}
+
+	var headID int64
+	if head.LastID != nil {
+		headID = *head.LastID
+	}
+	v.end(headID, head.LastHash)
+	return v.report, nil
+}
+
+// auditChainVerifier checks the entries of an audit chain given in chain
+// order.
+type auditChainVerifier struct {
+	report   AuditChainReport
+	prevHash []byte
+}
+
+// add checks the next entry of the chain.
+func (v *auditChainVerifier) add(e AlarmAuditEntry) {
+	v.report.Entries++
+	v.report.LastID = e.ID
+
+	switch {
+	case e.Hash == nil:
+		v.report.Breaks = append(v.report.Breaks, AuditChainBreak{AuditID: e.ID, Reason: "entry is not sealed"})
+	case !bytes.Equal(e.PrevHash, v.prevHash):
+		v.report.Breaks = append(v.report.Breaks, AuditChainBreak{AuditID: e.ID, Reason: "previous hash does not match, entries were removed or reordered"})
+	case !bytes.Equal(e.Hash, auditEntryHash(e)):
+		v.report.Breaks = append(v.report.Breaks, AuditChainBreak{AuditID: e.ID, Reason: "hash does not match the entry content"})
+	}
+	v.prevHash = e.Hash
+}
+
+// end checks that the chain head, 0 and nil when there is none, is the last
+// entry added.
+func (v *auditChainVerifier) end(headID int64, headHash []byte) {
+	if headID != v.report.LastID || !bytes.Equal(headHash, v.prevHash) {
+		v.report.Breaks = append(v.report.Breaks, AuditChainBreak{AuditID: headID, Reason: "chain head does not match the last entry, entries were removed from the end"})
+	}
+}
+
+// VerifyAuditLog verifies the audit chains of the given organizations, or of
+// every organization when none are given, from a single snapshot.
+func VerifyAuditLog(ctx context.Context, db *sqlx.DB, organizationIDs []int64) ([]AuditChainReport, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(organizationIDs) == 0 {
+		if organizationIDs, err = GetAuditChainOrganizations(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	reports := make([]AuditChainReport, 0, len(organizationIDs))
+	for _, organizationID := range organizationIDs {
+		report, err := VerifyAuditChain(tx, organizationID)
+		if err != nil {
+			return nil, fmt.Errorf("verify audit chain of organization %d error: %w", organizationID, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
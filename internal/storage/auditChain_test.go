@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func testAuditEntry(id int64) AlarmAuditEntry {
+	return AlarmAuditEntry{
+		ID:             id,
+		AlarmID:        7,
+		DevEui:         "0102030405060708",
+		ChangeType:     "UPDATE",
+		ChangedBy:      3,
+		OldValues:      []byte(`{"min_treshold":1}`),
+		NewValues:      []byte(`{"min_treshold":2}`),
+		ChangedAt:      time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC),
+		TableName:      AuditTableAlarm,
+		IPAddress:      "203.0.113.7",
+		Reason:         "test",
+		OrganizationID: 1,
+	}
+}
+
+// testAuditChain returns a sealed chain of the given number of entries.
+func testAuditChain(n int) []AlarmAuditEntry {
+	var chain []AlarmAuditEntry
+	var prevHash []byte
+	for i := 1; i <= n; i++ {
+		e := testAuditEntry(int64(i))
+		e.PrevHash = prevHash
+		e.Hash = auditEntryHash(e)
+		prevHash = e.Hash
+		chain = append(chain, e)
+	}
+	return chain
+}
+
+func TestAuditEntryHash(t *testing.T) {
+	base := testAuditEntry(1)
+	baseHash := auditEntryHash(base)
+
+	tests := []struct {
+		name    string
+		modify  func(e *AlarmAuditEntry)
+		changed bool
+	}{
+		{name: "same content", modify: func(e *AlarmAuditEntry) {}},
+		{name: "same time in another zone", modify: func(e *AlarmAuditEntry) {
+			e.ChangedAt = e.ChangedAt.In(time.FixedZone("UTC+3", 3*3600))
+		}},
+		{name: "hash and chain seq are not hashed", modify: func(e *AlarmAuditEntry) {
+			seq := int64(9)
+			e.Hash = []byte("hash")
+			e.ChainSeq = &seq
+		}},
+		{name: "id", modify: func(e *AlarmAuditEntry) { e.ID = 2 }, changed: true},
+		{name: "organization", modify: func(e *AlarmAuditEntry) { e.OrganizationID = 2 }, changed: true},
+		{name: "alarm", modify: func(e *AlarmAuditEntry) { e.AlarmID = 8 }, changed: true},
+		{name: "dev_eui", modify: func(e *AlarmAuditEntry) { e.DevEui = "0102030405060709" }, changed: true},
+		{name: "change type", modify: func(e *AlarmAuditEntry) { e.ChangeType = "DELETE" }, changed: true},
+		{name: "changed by", modify: func(e *AlarmAuditEntry) { e.ChangedBy = 4 }, changed: true},
+		{name: "old values", modify: func(e *AlarmAuditEntry) { e.OldValues = []byte(`{"min_treshold":0}`) }, changed: true},
+		{name: "new values", modify: func(e *AlarmAuditEntry) { e.NewValues = nil }, changed: true},
+		{name: "changed at", modify: func(e *AlarmAuditEntry) { e.ChangedAt = e.ChangedAt.Add(time.Nanosecond) }, changed: true},
+		{name: "table", modify: func(e *AlarmAuditEntry) { e.TableName = "alarm_date_time" }, changed: true},
+		{name: "ip address", modify: func(e *AlarmAuditEntry) { e.IPAddress = "" }, changed: true},
+		{name: "reason", modify: func(e *AlarmAuditEntry) { e.Reason = "other" }, changed: true},
+		{name: "actor", modify: func(e *AlarmAuditEntry) { e.Actor = ActorTemplateSync }, changed: true},
+		{name: "prev hash", modify: func(e *AlarmAuditEntry) { e.PrevHash = []byte{1} }, changed: true},
+		{name: "bytes moved between fields", modify: func(e *AlarmAuditEntry) {
+			e.IPAddress, e.Reason = "203.0.113.7t", "est"
+		}, changed: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := testAuditEntry(1)
+			tc.modify(&e)
+			if changed := !bytes.Equal(auditEntryHash(e), baseHash); changed != tc.changed {
+				t.Errorf("got changed %t, want %t", changed, tc.changed)
+			}
+		})
+	}
+}
+
+func TestAuditChainVerifier(t *testing.T) {
+	tests := []struct {
+		name string
+		// modify tampers with the chain and returns the chain head id.
+		modify     func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64)
+		wantBreaks []int64
+	}{
+		{
+			name: "valid",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				return chain, 3
+			},
+		},
+		{
+			name: "empty chain without head",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				return nil, 0
+			},
+		},
+		{
+			name: "content changed",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				chain[1].Reason = "changed"
+				return chain, 3
+			},
+			wantBreaks: []int64{2},
+		},
+		{
+			name: "entry removed",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				return append(chain[:1], chain[2:]...), 3
+			},
+			wantBreaks: []int64{3},
+		},
+		{
+			name: "entries reordered",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				chain[1], chain[2] = chain[2], chain[1]
+				return chain, 3
+			},
+			wantBreaks: []int64{3, 2, 3},
+		},
+		{
+			name: "entry not sealed",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				chain[2].Hash = nil
+				return chain, 3
+			},
+			wantBreaks: []int64{3, 3},
+		},
+		{
+			name: "last entry removed",
+			modify: func(chain []AlarmAuditEntry) ([]AlarmAuditEntry, int64) {
+				return chain[:2], 3
+			},
+			wantBreaks: []int64{3},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := testAuditChain(3)
+			head := chain[len(chain)-1].Hash
+			chain, headID := tc.modify(chain)
+			if headID == 0 {
+				head = nil
+			}
+
+			v := auditChainVerifier{report: AuditChainReport{OrganizationID: 1}}
+			for _, e := range chain {
+				v.add(e)
+			}
+			v.end(headID, head)
+
+			if v.report.Entries != len(chain) {
+				t.Errorf("got %d entries, want %d", v.report.Entries, len(chain))
+			}
+			var breaks []int64
+			for _, b := range v.report.Breaks {
+				breaks = append(breaks, b.AuditID)
+			}
+			if len(breaks) != len(tc.wantBreaks) {
+				t.Fatalf("got breaks %v, want %v", breaks, tc.wantBreaks)
+			}
+			for i := range breaks {
+				if breaks[i] != tc.wantBreaks[i] {
+					t.Fatalf("got breaks %v, want %v", breaks, tc.wantBreaks)
+				}
+			}
+			if v.report.Valid() != (len(tc.wantBreaks) == 0) {
+				t.Errorf("got valid %t", v.report.Valid())
+			}
+		})
+	}
+}
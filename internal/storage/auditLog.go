@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditLogFilters filters the alarm_audit_log search. Zero values are ignored.
+type AuditLogFilters struct {
+	AlarmID    int64     `db:"alarm_id"`
+	DevEui     string    `db:"dev_eui"`
+	ChangedBy  int64     `db:"changed_by"`
+	ChangeType string    `db:"change_type"`
+	From       time.Time `db:"from"`
+	To         time.Time `db:"to"`
+	Limit      int       `db:"limit"`
+	Offset     int       `db:"offset"`
+	// OrganizationID limits the entries to the given organization when set.
+	OrganizationID int64 `db:"organization_id"`
+	// ZoneUserID limits the entries to the devices in the zones of the
+	// given user when set.
+	ZoneUserID int64 `db:"zone_user_id"`
+}
+
+// SQL returns the where clause of the filters using named parameters.
+func (f AuditLogFilters) SQL() string {
+	var filters []string
+
+	if f.AlarmID != 0 {
+		filters = append(filters, "alarm_id = :alarm_id")
+	}
+	if f.DevEui != "" {
+		filters = append(filters, "dev_eui = :dev_eui")
+	}
+	if f.ChangedBy != 0 {
+		filters = append(filters, "changed_by = :changed_by")
+	}
+	if f.ChangeType != "" {
+		filters = append(filters, "change_type = :change_type")
+	}
+	if !f.From.IsZero() {
+		filters = append(filters, "changed_at >= :from")
+	}
+	if !f.To.IsZero() {
+		filters = append(filters, "changed_at < :to")
+	}
+	if f.OrganizationID != 0 {
+		filters = append(filters, "organization_id = :organization_id")
+	}
+	if f.ZoneUserID != 0 {
+		filters = append(filters, UserZoneSQL("dev_eui", ":zone_user_id"))
+	}
+
+	if len(filters) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(filters, " and ")
+}
+
+// GetAuditLogCount returns the number of audit entries matching the filters.
+func GetAuditLogCount(db sqlx.Queryer, filters AuditLogFilters) (int, error) {
+	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, "select count(*) from alarm_audit_log"+filters.SQL(), filters)
+	if err != nil {
+		return 0, HandlePSQLError(Select, err, "named query error")
+	}
+
+	var count int
+	if err := sqlx.Get(db, &count, query, args...); err != nil {
+		return 0, HandlePSQLError(Select, err, "select error")
+	}
+	return count, nil
+}
+
+// GetAuditLogs returns the audit entries matching the filters, newest first.
+func GetAuditLogs(db sqlx.Queryer, filters AuditLogFilters) ([]AlarmAuditEntry, error) {
+	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, `
+		select `+auditLogColumns+` from alarm_audit_log`+filters.SQL()+`
+		order by id desc
+		limit :limit offset :offset`, filters)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "named query error")
+	}
+
+	var entries []AlarmAuditEntry
+	if err := sqlx.Select(db, &entries, query, args...); err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return entries, nil
+}
+
+// Before decodes the values of the alarm before the change, nil for inserts.
+func (e AlarmAuditEntry) Before() (*AlarmSnapshot, error) {
+	return decodeAuditValues(e.OldValues)
+}
+
+// After decodes the values of the alarm after the change, nil for deletes.
+func (e AlarmAuditEntry) After() (*AlarmSnapshot, error) {
+	return decodeAuditValues(e.NewValues)
+}
+
+func decodeAuditValues(b []byte) (*AlarmSnapshot, error) {
+	if isJSONNull(b) {
+		return nil, nil
+	}
+	snap, err := decodeAlarmSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// APIKey is a ChirpStack API key. A key is either global admin, scoped to an
+// organization or scoped to an application.
+type APIKey struct {
+	ID             string `db:"id"`
+	IsAdmin        bool   `db:"is_admin"`
+	OrganizationID *int64 `db:"organization_id"`
+	ApplicationID  *int64 `db:"application_id"`
+}
+
+// GetUser returns the user with the given id. Only the fields used for
+// authorization are set.
+func GetUser(db sqlx.Queryer, userID int64) (User, error) {
+	var u User
+	err := db.QueryRowx(`select id, username, is_admin, is_active from "user" where id = $1`, userID).
+		Scan(&u.ID, &u.Username, &u.IsAdmin, &u.IsActive)
+	if err != nil {
+		return u, HandlePSQLError(Select, err, "select error")
+	}
+	return u, nil
+}
+
+// GetUserByUsername returns the user with the given username. Only the
+// fields used for authorization are set.
+func GetUserByUsername(db sqlx.Queryer, username string) (User, error) {
+	var u User
+	err := db.QueryRowx(`select id, username, is_admin, is_active from "user" where username = $1`, username).
+		Scan(&u.ID, &u.Username, &u.IsAdmin, &u.IsActive)
+	if err != nil {
+		return u, HandlePSQLError(Select, err, "select error")
+	}
+	return u, nil
+}
+
+// GetAPIKey returns the API key with the given id.
+func GetAPIKey(db sqlx.Queryer, id string) (APIKey, error) {
+	var k APIKey
+	if err := sqlx.Get(db, &k, "select id, is_admin, organization_id, application_id from api_key where id = $1", id); err != nil {
+		return k, HandlePSQLError(Select, err, "select error")
+	}
+	return k, nil
+}
+
+// GetApplicationOrganizationID returns the organization of the given application.
+func GetApplicationOrganizationID(db sqlx.Queryer, applicationID int64) (int64, error) {
+	var organizationID int64
+	if err := sqlx.Get(db, &organizationID, "select organization_id from application where id = $1", applicationID); err != nil {
+		return 0, HandlePSQLError(Select, err, "select error")
+	}
+	return organizationID, nil
+}
+
+// IsOrganizationUser returns true when the user is a member of the organization.
+func IsOrganizationUser(db sqlx.Queryer, organizationID, userID int64) (bool, error) {
+	var count int
+	err := sqlx.Get(db, &count, "select count(*) from organization_user where organization_id = $1 and user_id = $2", organizationID, userID)
+	if err != nil {
+		return false, HandlePSQLError(Select, err, "select error")
+	}
+	return count != 0, nil
+}
+
+// GetUserOrganizationIDs returns the organizations the user is a member of,
+// by id.
+func GetUserOrganizationIDs(db sqlx.Queryer, userID int64) ([]int64, error) {
+	var organizationIDs []int64
+	err := sqlx.Select(db, &organizationIDs, "select organization_id from organization_user where user_id = $1 order by organization_id", userID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return organizationIDs, nil
+}
+
+// GetDeviceOrganizationIDs returns the organizations owning the given
+// devices. ErrDeviceNotFound is returned when any of the devices is unknown.
+func GetDeviceOrganizationIDs(db sqlx.Queryer, devEuis []string) ([]int64, error) {
+	var devices []struct {
+		DevEui         string `db:"dev_eui"`
+		OrganizationID int64  `db:"organization_id"`
+	}
+	err := sqlx.Select(db, &devices, `select encode(dev_eui, 'hex') as dev_eui, organization_id from device
+		where dev_eui = any(select decode(e, 'hex') from unnest($1::text[]) as e)`, pq.Array(devEuis))
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+
+	found := make(map[string]bool)
+	seen := make(map[int64]bool)
+	var organizationIDs []int64
+	for _, d := range devices {
+		found[d.DevEui] = true
+		if !seen[d.OrganizationID] {
+			seen[d.OrganizationID] = true
+			organizationIDs = append(organizationIDs, d.OrganizationID)
+		}
+	}
+	for _, devEui := range devEuis {
+		if !found[strings.ToLower(devEui)] {
+			return nil, ErrDeviceNotFound.With("dev_eui", devEui)
+		}
+	}
+	return organizationIDs, nil
+}
+
+// GetAlarmDevEui returns the dev_eui of the given alarm, deleted or not.
+func GetAlarmDevEui(db sqlx.Queryer, alarmID int64) (string, error) {
+	var devEui string
+	if err := sqlx.Get(db, &devEui, "select dev_eui from alarm_refactor2 where id = $1", alarmID); err != nil {
+		return "", HandlePSQLError(Select, err, "select error")
+	}
+	return devEui, nil
+}
+
+// UserZoneSQL returns a condition that is true when the device in the given
+// hex dev_eui column is in one of the zones assigned to the user given by
+// userParam (user.zone_id_list). It contains no '::' casts so that it can be
+// used in named queries.
+func UserZoneSQL(devEuiColumn, userParam string) string {
+	return `exists (
+		select 1 from zone as z
+			inner join "user" as u on z.zone_id = any(u.zone_id_list)
+		where u.id = ` + userParam + ` and '\x' || ` + devEuiColumn + ` = any(z.devices))`
+}
+
+// AreDevicesInUserZones returns true when all given devices are in zones
+// assigned to the user.
+func AreDevicesInUserZones(db sqlx.Queryer, userID int64, devEuis []string) (bool, error) {
+	var missing int
+	err := sqlx.Get(db, &missing, `select count(*) from unnest($2::text[]) as e
+		where not `+UserZoneSQL("lower(e)", "$1"), userID, pq.Array(devEuis))
+	if err != nil {
+		return false, HandlePSQLError(Select, err, "select error")
+	}
+	return missing == 0, nil
+}
@@ -1,8 +1,6 @@
 package storage
 
 import (
-	"log"
-
 	"github.com/ibrahimozekici/chirpstack-api/go/v5/als"
 	"github.com/jmoiron/sqlx"
 )
@@ -25,7 +23,7 @@ func CreateColdRoomRestrictions(alarm *als.Alarm, alarmID int64, db sqlx.Ext) er
 		alarm_time
 	) values ($1, $2, $3, $4, $5)`, coldRes.DevEui, coldRes.AlarmId, coldRes.DefrostTime, coldRes.DefrostFrequency, coldRes.AlarmTime)
 	if err != nil {
-		log.Fatalf("Insert error %v", err)
+		return HandlePSQLError(Insert, err, "insert error")
 	}
 	return nil
 }
@@ -40,7 +38,7 @@ func CreateUtku(alarm *als.Alarm, alarmID int64, db sqlx.Ext) error {
 		alarm_id
 	) values ($1, $2)`, utkuObject.DevEui, utkuObject.AlarmId)
 	if err != nil {
-		log.Fatalf("Insert error %v", err)
+		return HandlePSQLError(Insert, err, "insert error")
 	}
 	return nil
 }
@@ -1,13 +1,36 @@
 package storage
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
+	"net"
+	"strconv"
 
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/gomail.v2"
+
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
+)
+
+const (
+	smtpHost = "mail.vaps.com.tr"
+	smtpPort = 587
 )
 
+// CheckEmail checks that the SMTP server accepts connections.
+func CheckEmail(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(smtpHost, strconv.Itoa(smtpPort)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 func SendEmail(receiver string, textmessage string) {
+	notifications.Add(1)
+	defer notifications.Done()
 
 	m := gomail.NewMessage()
 	m.SetHeader("From", "alarm@vaps.com.tr")
@@ -17,15 +40,17 @@ func SendEmail(receiver string, textmessage string) {
 	m.SetBody("text/html", textmessage)
 	//m.Attach("/home/Alex/lolcat.jpg")
 
-	d := gomail.NewDialer("mail.vaps.com.tr", 587, "alarm@vaps.com.tr", "Letirev01*Veritel")
+	d := gomail.NewDialer(smtpHost, smtpPort, "alarm@vaps.com.tr", "Letirev01*Veritel")
 	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 
 	// Send the email to Bob, Cora and Dan.
-	if err := d.DialAndSend(m); err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Print("sent")
+	_, span := tracer.Start(context.Background(), "smtp send", trace.WithSpanKind(trace.SpanKindClient))
+	err := d.DialAndSend(m)
+	endSpan(span, err)
+	metrics.NotificationSent(metrics.ChannelEmail, err)
+	if err != nil {
+		log.WithError(err).WithField("to", receiver).Error("storage: send email error")
+		return
 	}
-
-	fmt.Println("Email Sent Successfully!")
+	log.WithField("to", receiver).Info("storage: email sent")
 }
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"database/sql"
+	"sort"
+	"strings"
 
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
@@ -19,31 +21,204 @@ const (
 	Scan
 )
 
-// errors
+// Languages of the error messages.
+const (
+	LangEN = "en"
+	LangTR = "tr"
+)
+
+// Error is an error of the catalog below. Its code is stable and its
+// messages can be shown to the users as is.
+type Error struct {
+	// Code identifies the error, e.g. ALARM_NOT_FOUND.
+	Code string
+	// Message is the English message, MessageTR the Turkish one.
+	Message   string
+	MessageTR string
+	// Metadata identifies the objects involved, e.g. the alarm id.
+	Metadata map[string]string
+
+	kind error
+}
+
+func newError(kind error, code, message, messageTR string) *Error {
+	return &Error{Code: code, Message: message, MessageTR: messageTR, kind: kind}
+}
+
+func (e *Error) Error() string {
+	if len(e.Metadata) == 0 {
+		return e.Message
+	}
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+e.Metadata[k])
+	}
+	return e.Message + " (" + strings.Join(pairs, ", ") + ")"
+}
+
+// Is matches the errors of the same code, whatever their metadata.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Unwrap returns the generic error of the catalog the error is a kind of,
+// e.g. ErrDoesNotExist for ErrAlarmNotFound.
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// With returns a copy of the error with the given metadata added.
+func (e *Error) With(key, value string) *Error {
+	c := *e
+	c.Metadata = make(map[string]string, len(e.Metadata)+1)
+	for k, v := range e.Metadata {
+		c.Metadata[k] = v
+	}
+	c.Metadata[key] = value
+	return &c
+}
+
+// LocalizedMessage returns the message in the given language, English for
+// unknown languages.
+func (e *Error) LocalizedMessage(lang string) string {
+	if lang == LangTR && e.MessageTR != "" {
+		return e.MessageTR
+	}
+	return e.Message
+}
+
+// Generic errors, the errors below are kinds of them.
+var (
+	ErrDoesNotExist          = newError(nil, "NOT_FOUND", "object does not exist", "kayıt bulunamadı")
+	ErrAlreadyExists         = newError(nil, "ALREADY_EXISTS", "object already exists", "kayıt zaten mevcut")
+	ErrUsedByOtherObjects    = newError(nil, "USED_BY_OTHER_OBJECTS", "this object is used by other objects, remove them first", "bu kayıt başka kayıtlar tarafından kullanılıyor, önce onları silin")
+	ErrReferenceDoesNotExist = newError(nil, "REFERENCE_DOES_NOT_EXIST", "referenced object does not exist", "ilişkili kayıt bulunamadı")
+	ErrInvalidArgument       = newError(nil, "INVALID_ARGUMENT", "invalid argument", "geçersiz değer")
+	ErrUnavailable           = newError(nil, "UNAVAILABLE", "service is unavailable, try again later", "servis şu anda kullanılamıyor, daha sonra tekrar deneyin")
+	ErrResourceExhausted     = newError(nil, "RESOURCE_EXHAUSTED", "resource exhausted, try again later", "kaynak sınırına ulaşıldı, daha sonra tekrar deneyin")
+)
+
+// Alarm errors.
+var (
+	ErrAlarmNotFound         = newError(ErrDoesNotExist, "ALARM_NOT_FOUND", "alarm does not exist", "alarm bulunamadı")
+	ErrAlarmAlreadyExists    = newError(ErrAlreadyExists, "ALARM_ALREADY_EXISTS", "an alarm with the same settings already exists", "aynı ayarlara sahip bir alarm zaten mevcut")
+	ErrAlarmRequired         = newError(ErrInvalidArgument, "ALARM_REQUIRED", "alarm is required", "alarm bilgisi zorunludur")
+	ErrAlarmInvalidThreshold = newError(ErrInvalidArgument, "ALARM_INVALID_THRESHOLD", "min threshold must not be greater than max threshold", "minimum eşik değeri maksimum eşik değerinden büyük olamaz")
+	ErrAlarmNoSensor         = newError(ErrInvalidArgument, "ALARM_NO_SENSOR", "a sensor must be selected", "bir sensör seçilmelidir")
+	ErrAlarmMultipleSensors  = newError(ErrInvalidArgument, "ALARM_MULTIPLE_SENSORS", "only one sensor can be selected per alarm", "bir alarm için yalnızca bir sensör seçilebilir")
+	ErrAlarmUserRequired     = newError(ErrInvalidArgument, "ALARM_USER_REQUIRED", "user is required", "kullanıcı bilgisi zorunludur")
+	ErrAlarmInvalidUser      = newError(ErrInvalidArgument, "ALARM_INVALID_USER", "invalid user id", "geçersiz kullanıcı numarası")
+	ErrAlarmInvalidValue     = newError(ErrInvalidArgument, "ALARM_INVALID_VALUE", "invalid value", "geçersiz değer")
+	ErrIdempotencyKeyReused  = newError(ErrInvalidArgument, "IDEMPOTENCY_KEY_REUSED", "idempotency key was already used for another request", "istek anahtarı başka bir istek için kullanılmış")
+)
+
+// Schedule errors, for the date and time windows of the alarms.
+var (
+	ErrScheduleNotFound         = newError(ErrDoesNotExist, "SCHEDULE_NOT_FOUND", "alarm schedule does not exist", "alarm zaman aralığı bulunamadı")
+	ErrScheduleInvalidTimeRange = newError(ErrInvalidArgument, "SCHEDULE_INVALID_TIME_RANGE", "schedule start time must be before its end time", "başlangıç saati bitiş saatinden önce olmalıdır")
+	ErrScheduleInvalidDay       = newError(ErrInvalidArgument, "SCHEDULE_INVALID_DAY", "schedule day must be between 0 (Sunday) and 6", "gün 0 (Pazar) ile 6 arasında olmalıdır")
+	ErrScheduleInvalidTime      = newError(ErrInvalidArgument, "SCHEDULE_INVALID_TIME", "schedule time must be between 0 and 24", "saat 0 ile 24 arasında olmalıdır")
+)
+
+// Notification errors.
+var (
+	ErrNotificationFailed     = newError(ErrUnavailable, "NOTIFICATION_FAILED", "notification could not be sent", "bildirim gönderilemedi")
+	ErrSMSProviderUnavailable = newError(ErrUnavailable, "SMS_PROVIDER_UNAVAILABLE", "sms provider could not be reached", "SMS servisine ulaşılamadı")
+	ErrSMSInvalidResponse     = newError(ErrUnavailable, "SMS_INVALID_RESPONSE", "sms provider returned an unexpected response", "SMS servisinden beklenmeyen bir yanıt alındı")
+	ErrSMSUserNotFound        = newError(ErrDoesNotExist, "SMS_USER_NOT_FOUND", "sms provider user not found, check the user credentials", "kullanıcı bulunamadı, kullanıcı bilgilerini kontrol ediniz")
+	ErrSMSReportNotFound      = newError(ErrDoesNotExist, "SMS_REPORT_NOT_FOUND", "sms report not found, check the user credentials, the report id and the date", "kayıt bulunamadı, kullanıcı bilgileri, rapor ID ve tarih bilgilerini doğru girmeye özen gösteriniz")
+)
+
+// API errors.
 var (
-	ErrAlreadyExists                   = errors.New("object already exists")
-	ErrDoesNotExist                    = errors.New("object does not exist")
-	ErrUsedByOtherObjects              = errors.New("this object is used by other objects, remove them first")
-	ErrApplicationInvalidName          = errors.New("invalid application name")
-	ErrNodeInvalidName                 = errors.New("invalid node name")
-	ErrNodeMaxRXDelay                  = errors.New("max value of RXDelay is 15")
-	ErrCFListTooManyChannels           = errors.New("too many channels in channel-list")
-	ErrUserInvalidUsername             = errors.New("username name may only be composed of upper and lower case characters and digits")
-	ErrUserPasswordLength              = errors.New("passwords must be at least 6 characters long")
-	ErrInvalidUsernameOrPassword       = errors.New("invalid username or password")
-	ErrOrganizationInvalidName         = errors.New("invalid organization name")
-	ErrGatewayInvalidName              = errors.New("invalid gateway name")
-	ErrInvalidEmail                    = errors.New("invalid e-mail")
-	ErrInvalidGatewayDiscoveryInterval = errors.New("invalid gateway-discovery interval, it must be greater than 0")
-	ErrDeviceProfileInvalidName        = errors.New("invalid device-profile name")
-	ErrServiceProfileInvalidName       = errors.New("invalid service-profile name")
-	ErrMulticastGroupInvalidName       = errors.New("invalid multicast-group name")
-	ErrOrganizationMaxDeviceCount      = errors.New("organization reached max. device count")
-	ErrOrganizationMaxGatewayCount     = errors.New("organization reached max. gateway count")
-	ErrNetworkServerInvalidName        = errors.New("invalid network-server name")
-	ErrAPIKeyInvalidName               = errors.New("invalid API Key name")
+	ErrRateLimited         = newError(ErrResourceExhausted, "RATE_LIMITED", "too many requests, try again later", "çok fazla istek gönderildi, daha sonra tekrar deneyin")
+	ErrWatchTargetRequired = newError(ErrInvalidArgument, "WATCH_TARGET_REQUIRED", "organization_id or zone_id is required", "organization_id veya zone_id zorunludur")
+	ErrWatchLagging        = newError(ErrUnavailable, "WATCH_LAGGING", "the watch fell behind the events, resume from the last cursor", "izleme olayların gerisinde kaldı, son imleçten devam edin")
+	ErrWatchClosed         = newError(ErrUnavailable, "WATCH_CLOSED", "the server is stopping, resume from the last cursor", "sunucu durduruluyor, son imleçten devam edin")
+	ErrBulkUnknownAction   = newError(ErrInvalidArgument, "BULK_UNKNOWN_ACTION", "unknown bulk action", "bilinmeyen toplu işlem")
 )
 
+// Device lookup errors.
+var (
+	ErrDeviceNotFound       = newError(ErrDoesNotExist, "DEVICE_NOT_FOUND", "device does not exist", "cihaz bulunamadı")
+	ErrDeviceInvalidDevEUI  = newError(ErrInvalidArgument, "DEVICE_INVALID_DEV_EUI", "dev_eui must be 16 hexadecimal characters", "dev_eui 16 karakterlik onaltılık bir değer olmalıdır")
+	ErrDevEUIRequired       = newError(ErrInvalidArgument, "DEVICE_DEV_EUI_REQUIRED", "dev_eui is required", "dev_eui zorunludur")
+	ErrZoneDevicesNotFound  = newError(ErrDoesNotExist, "ZONE_DEVICES_NOT_FOUND", "no devices found in the given zones", "verilen bölgelerde cihaz bulunamadı")
+	ErrZoneCategoryNotFound = newError(ErrDoesNotExist, "ZONE_CATEGORY_NOT_FOUND", "zone category does not exist", "bölge kategorisi bulunamadı")
+	ErrZoneNotFound         = newError(ErrDoesNotExist, "ZONE_NOT_FOUND", "zone does not exist", "bölge bulunamadı")
+)
+
+// ForeignKeyError is returned when a write violates a foreign key. It
+// unwraps to ErrUsedByOtherObjects for deletes, else to
+// ErrReferenceDoesNotExist.
+type ForeignKeyError struct {
+	Table      string
+	Constraint string
+	Detail     string
+	err        *Error
+}
+
+func (e *ForeignKeyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ForeignKeyError) Unwrap() error {
+	return e.err
+}
+
+// FieldViolation is an invalid field of a request.
+type FieldViolation struct {
+	Field string
+	Err   *Error
+}
+
+// ValidationError is returned when a request or a value written to the
+// database is invalid. It matches ErrInvalidArgument.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid argument: " + e.LocalizedMessage(LangEN)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidArgument
+}
+
+// LocalizedMessage returns the messages of the violations in the given
+// language.
+func (e *ValidationError) LocalizedMessage(lang string) string {
+	var msgs []string
+	for _, v := range e.Violations {
+		msg := v.Err.LocalizedMessage(lang)
+		if v.Field != "" {
+			msg = v.Field + ": " + msg
+		}
+		msgs = append(msgs, msg)
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Add adds a violation of the given field.
+func (e *ValidationError) Add(field string, err *Error) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Err: err})
+}
+
+// Err returns the validation error, nil when there are no violations.
+func (e *ValidationError) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
 func HandlePSQLError(action Action, err error, description string) error {
 	if err == sql.ErrNoRows {
 		return ErrDoesNotExist
@@ -55,12 +230,20 @@ func HandlePSQLError(action Action, err error, description string) error {
 		case "unique_violation":
 			return ErrAlreadyExists
 		case "foreign_key_violation":
+			fkErr := &ForeignKeyError{Table: err.Table, Constraint: err.Constraint, Detail: err.Detail}
 			switch action {
 			case Delete:
-				return ErrUsedByOtherObjects
+				fkErr.err = ErrUsedByOtherObjects
 			default:
-				return ErrDoesNotExist
+				fkErr.err = ErrReferenceDoesNotExist
 			}
+			return fkErr
+		case "not_null_violation", "check_violation":
+			return &ValidationError{Violations: []FieldViolation{{Field: err.Column, Err: ErrAlarmInvalidValue.With("detail", err.Message)}}}
+		}
+		// Class 22 holds the data exceptions, e.g. a malformed value.
+		if err.Code.Class() == "22" {
+			return &ValidationError{Violations: []FieldViolation{{Field: err.Column, Err: ErrAlarmInvalidValue.With("detail", err.Message)}}}
 		}
 	}
 
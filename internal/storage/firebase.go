@@ -2,10 +2,14 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
 )
 
 type FirebaseNotification struct {
@@ -43,12 +47,23 @@ type OneSignalNotificationData struct {
 	Priority int `json:"priority"`
 }
 
+const (
+	firebaseURL  = "https://fcm.googleapis.com/fcm/send"
+	oneSignalURL = "https://onesignal.com/api/v1/notifications"
+)
+
+// healthClient is the HTTP client of the provider checks, they are not
+// traced.
+var healthClient = &http.Client{}
+
 var firebaseAythKey = "AAAA5h0bGnM:APA91bHFEwqNn8auXh64E_z_cltvqmrPa6OygwVUQfmGctyuINkThNmNpBRT2X43yAByAn04MFI03oVYhYpMzU5gXYh2QZOI3oQh4NsQiGGTxdwIv20aoISOQQiOkaCVK8mTx-Eq8A5E"
 var OneSignalAythKey = "Basic YzU2Yzg4NGMtZjQ2Yy00Nzg4LWFkNjYtNDNjNGI2YTM1MDgy"
 
 // SendFirebaseNotification SendFirebaseNotification
 func SendFirebaseNotification(u User, f FirebaseNotificationData) error {
-	client := &http.Client{}
+	notifications.Add(1)
+	defer notifications.Done()
+	client := &http.Client{Transport: tracedTransport}
 
 	if u.WebKey != "" {
 		notification := FirebaseNotification{
@@ -58,18 +73,18 @@ func SendFirebaseNotification(u User, f FirebaseNotificationData) error {
 		var jsonBody []byte
 		jsonBody, err := json.Marshal(notification)
 		if err != nil {
-			fmt.Println("json marshal error")
+			log.WithError(err).Error("storage: marshal notification error")
 		}
-		req, err := http.NewRequest("POST", "https://fcm.googleapis.com/fcm/send", bytes.NewBuffer(jsonBody))
+		req, err := http.NewRequest("POST", firebaseURL, bytes.NewBuffer(jsonBody))
 		if err != nil {
-			fmt.Println("NewRequest error")
+			log.WithError(err).Error("storage: create notification request error")
 		}
 		req.Header.Set("Authorization", "key="+firebaseAythKey)
 		req.Header.Set("Content-Type", "application/json")
 
-		_, err = client.Do(req)
+		err = sendNotificationRequest(client, req, metrics.ChannelFirebase)
 		if err != nil {
-			fmt.Println("http error")
+			log.WithError(err).Error("storage: send notification error")
 		}
 	}
 	if u.AndroidKey != "" {
@@ -80,18 +95,18 @@ func SendFirebaseNotification(u User, f FirebaseNotificationData) error {
 		var jsonBody []byte
 		jsonBody, err := json.Marshal(notification)
 		if err != nil {
-			fmt.Println("json marshal error")
+			log.WithError(err).Error("storage: marshal notification error")
 		}
-		req, err := http.NewRequest("POST", "https://fcm.googleapis.com/fcm/send", bytes.NewBuffer(jsonBody))
+		req, err := http.NewRequest("POST", firebaseURL, bytes.NewBuffer(jsonBody))
 		if err != nil {
-			fmt.Println("NewRequest error")
+			log.WithError(err).Error("storage: create notification request error")
 		}
 		req.Header.Set("Authorization", "key="+firebaseAythKey)
 		req.Header.Set("Content-Type", "application/json")
 
-		_, err = client.Do(req)
+		err = sendNotificationRequest(client, req, metrics.ChannelFirebase)
 		if err != nil {
-			fmt.Println("http error")
+			log.WithError(err).Error("storage: send notification error")
 		}
 		// One Signal Android
 
@@ -108,19 +123,56 @@ func SendFirebaseNotification(u User, f FirebaseNotificationData) error {
 		var json0 []byte
 		json0, err = json.Marshal(oneSignalNotification)
 		if err != nil {
-			fmt.Println("json marshal error")
+			log.WithError(err).Error("storage: marshal notification error")
 		}
 
-		reqOne, err := http.NewRequest("POST", "https://onesignal.com/api/v1/notifications", bytes.NewBuffer(json0))
+		reqOne, err := http.NewRequest("POST", oneSignalURL, bytes.NewBuffer(json0))
 		reqOne.Header.Set("Authorization", OneSignalAythKey)
 		reqOne.Header.Set("Content-Type", "application/json")
 		reqOne.Header.Set("Accept", "application/json")
 
-		_, err = client.Do(reqOne)
+		err = sendNotificationRequest(client, reqOne, metrics.ChannelOneSignal)
 		if err != nil {
-			fmt.Println("http error")
+			log.WithError(err).Error("storage: send notification error")
 
 		}
 	}
 	return nil
 }
+
+// CheckFirebase checks that the Firebase and OneSignal endpoints answer.
+func CheckFirebase(ctx context.Context) error {
+	if err := checkEndpoint(ctx, firebaseURL); err != nil {
+		return err
+	}
+	return checkEndpoint(ctx, oneSignalURL)
+}
+
+// checkEndpoint checks that the server of the given URL answers HTTP
+// requests, whatever their status.
+func checkEndpoint(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := healthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sendNotificationRequest sends a push notification request and records its
+// result for the given channel.
+func sendNotificationRequest(client *http.Client, req *http.Request, channel string) error {
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusMultipleChoices {
+			err = ErrNotificationFailed.With("channel", channel).With("status", resp.Status)
+		}
+	}
+	metrics.NotificationSent(channel, err)
+	return err
+}
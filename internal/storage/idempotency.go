@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// IdempotencyKey is a client-supplied key of a create request.
+type IdempotencyKey struct {
+	Scope       string    `db:"scope"`
+	Key         string    `db:"key"`
+	RequestHash []byte    `db:"request_hash"`
+	AlarmID     *int64    `db:"alarm_id"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// ClaimIdempotencyKey claims the key for the request with the given hash.
+// It returns true when the key was claimed, the caller then stores its
+// result with SetIdempotencyKeyAlarm within the same transaction. Else the
+// key of a previous request is returned. A concurrent claim of the same key
+// blocks until the transaction of the first one ends. Keys older than ttl
+// are replaced, with a ttl of 0 keys never expire. ErrIdempotencyKeyReused
+// is returned when the key was used for another request.
+func ClaimIdempotencyKey(db sqlx.Ext, scope, key string, requestHash []byte, ttl time.Duration) (IdempotencyKey, bool, error) {
+	if ttl > 0 {
+		_, err := db.Exec("delete from alarm_idempotency_key where scope = $1 and key = $2 and created_at < $3",
+			scope, key, time.Now().Add(-ttl))
+		if err != nil {
+			return IdempotencyKey{}, false, HandlePSQLError(Delete, err, "delete error")
+		}
+	}
+
+	var k IdempotencyKey
+	err := sqlx.Get(db, &k, `
+		insert into alarm_idempotency_key (scope, key, request_hash)
+		values ($1, $2, $3)
+		on conflict (scope, key) do nothing
+		returning *`, scope, key, requestHash)
+	if err == nil {
+		return k, true, nil
+	}
+	// No row is returned when the key exists.
+	if err != sql.ErrNoRows {
+		return IdempotencyKey{}, false, HandlePSQLError(Insert, err, "insert error")
+	}
+
+	if err := sqlx.Get(db, &k, "select * from alarm_idempotency_key where scope = $1 and key = $2", scope, key); err != nil {
+		return IdempotencyKey{}, false, HandlePSQLError(Select, err, "select error")
+	}
+	if !bytes.Equal(k.RequestHash, requestHash) {
+		return IdempotencyKey{}, false, ErrIdempotencyKeyReused.With("idempotency_key", key)
+	}
+	return k, false, nil
+}
+
+// SetIdempotencyKeyAlarm stores the alarm created for the given key.
+func SetIdempotencyKeyAlarm(db sqlx.Execer, scope, key string, alarmID int64) error {
+	_, err := db.Exec("update alarm_idempotency_key set alarm_id = $3 where scope = $1 and key = $2", scope, key, alarmID)
+	if err != nil {
+		return HandlePSQLError(Update, err, "update error")
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys deletes the keys created before the given time and
+// returns their number.
+func PurgeIdempotencyKeys(db sqlx.Execer, before time.Time) (int64, error) {
+	res, err := db.Exec("delete from alarm_idempotency_key where created_at < $1", before)
+	if err != nil {
+		return 0, HandlePSQLError(Delete, err, "delete error")
+	}
+	return res.RowsAffected()
+}
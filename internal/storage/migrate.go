@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate applies the database migrations that have not been applied yet.
+// Each migration runs in its own transaction and is recorded in the
+// alarm_service_migration table. A session advisory lock is held for the
+// whole run, replicas starting together apply the migrations one at a time.
+func Migrate(db *sqlx.DB) error {
+	ctx := context.Background()
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection error: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "select pg_advisory_lock(hashtext('alarm_service_migration'))"); err != nil {
+		return fmt.Errorf("acquire migration lock error: %w", err)
+	}
+	defer conn.ExecContext(ctx, "select pg_advisory_unlock(hashtext('alarm_service_migration'))")
+
+	_, err = conn.ExecContext(ctx, `create table if not exists alarm_service_migration (
+		id text primary key,
+		applied_at timestamp with time zone not null default now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create migration table error: %w", err)
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("list migrations error: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		var count int
+		if err := conn.GetContext(ctx, &count, "select count(*) from alarm_service_migration where id = $1", f); err != nil {
+			return HandlePSQLError(Select, err, "select migration error")
+		}
+		if count != 0 {
+			continue
+		}
+
+		b, err := migrations.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("read migration error: %w", err)
+		}
+
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin migration transaction error: %w", err)
+		}
+		if _, err := tx.Exec(string(b)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %s error: %w", f, err)
+		}
+		if _, err := tx.Exec("insert into alarm_service_migration (id) values ($1)", f); err != nil {
+			tx.Rollback()
+			return HandlePSQLError(Insert, err, "insert migration error")
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration error: %w", err)
+		}
+
+		log.WithField("migration", f).Info("storage: migration applied")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+create table if not exists alarm_template (
+	id bigserial primary key,
+	organization_id bigint not null,
+	name varchar(100) not null,
+	min_treshold real not null default 0,
+	max_treshold real not null default 0,
+	sms boolean not null default false,
+	email boolean not null default false,
+	notification boolean not null default false,
+	temperature boolean not null default false,
+	humadity boolean not null default false,
+	ec boolean not null default false,
+	door boolean not null default false,
+	w_leak boolean not null default false,
+	pressure boolean not null default false,
+	distance boolean not null default false,
+	user_id bigint[] not null default '{}',
+	is_time_limit_active boolean not null default false,
+	zone_category bigint not null default 0,
+	notification_sound varchar(100) not null default '',
+	defrost_time bigint not null default 0,
+	created_at timestamp with time zone not null default now(),
+	updated_at timestamp with time zone not null default now()
+);
+
+create index if not exists idx_alarm_template_organization_id on alarm_template(organization_id);
+
+create table if not exists alarm_template_date_time (
+	id bigserial primary key,
+	template_id bigint not null references alarm_template on delete cascade,
+	alarm_day bigint not null,
+	start_time real not null,
+	end_time real not null
+);
+
+create index if not exists idx_alarm_template_date_time_template_id on alarm_template_date_time(template_id);
+
+-- A template is linked either to a single zone or to every zone of a zone category.
+create table if not exists alarm_template_link (
+	id bigserial primary key,
+	template_id bigint not null references alarm_template on delete cascade,
+	zone_id bigint,
+	zone_category bigint,
+	created_at timestamp with time zone not null default now(),
+	check ((zone_id is null) <> (zone_category is null))
+);
+
+create unique index if not exists idx_alarm_template_link_zone on alarm_template_link(template_id, zone_id) where zone_id is not null;
+create unique index if not exists idx_alarm_template_link_zone_category on alarm_template_link(template_id, zone_category) where zone_category is not null;
+
+-- Alarms created from a template keep a reference to it. overridden_fields lists
+-- the columns changed on the alarm itself, which template updates must not touch.
+alter table alarm_refactor2
+	add column if not exists template_id bigint references alarm_template on delete set null,
+	add column if not exists overridden_fields text[] not null default '{}';
+
+create index if not exists idx_alarm_refactor2_template_id on alarm_refactor2(template_id);
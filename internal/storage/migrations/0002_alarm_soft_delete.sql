@@ -0,0 +1,12 @@
+-- Deleted alarms are kept until they are purged after the retention period.
+-- active_before_delete keeps is_active so that a restore brings it back.
+alter table alarm_refactor2
+	add column if not exists deleted_at timestamp with time zone,
+	add column if not exists active_before_delete boolean not null default false;
+
+create index if not exists idx_alarm_refactor2_deleted_at on alarm_refactor2(deleted_at) where deleted_at is not null;
+
+-- Automation rules deactivated by an alarm delete share its deleted_at, so a
+-- restore only re-activates those rules.
+alter table alarm_automation_rules
+	add column if not exists deleted_at timestamp with time zone;
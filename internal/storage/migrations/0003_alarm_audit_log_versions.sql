@@ -0,0 +1,18 @@
+-- Alarm history is built from alarm_audit_log ordered by id, make sure the
+-- table and the columns it relies on exist.
+create table if not exists alarm_audit_log (
+	id bigserial primary key,
+	alarm_id bigint not null,
+	dev_eui varchar(16) not null,
+	change_type varchar(20) not null,
+	changed_by bigint not null,
+	old_values jsonb,
+	new_values jsonb,
+	changed_at timestamp with time zone not null default now()
+);
+
+alter table alarm_audit_log
+	add column if not exists id bigserial,
+	add column if not exists changed_at timestamp with time zone not null default now();
+
+create index if not exists idx_alarm_audit_log_alarm_id on alarm_audit_log(alarm_id, id);
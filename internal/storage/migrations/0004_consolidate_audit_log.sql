@@ -0,0 +1,103 @@
+-- alarm_audit_log becomes the single audit table, replacing alarm_change_logs
+-- and audit_logs which are kept read-only for reference. The backfilled
+-- entries get higher ids than the existing ones although they are older:
+-- the entries are read in changed_at order.
+alter table alarm_audit_log
+	add column if not exists table_name varchar(100) not null default 'alarm_refactor2',
+	add column if not exists ip_address varchar(100) not null default '',
+	add column if not exists reason text not null default '',
+	alter column alarm_id drop not null;
+
+create index if not exists idx_alarm_audit_log_dev_eui on alarm_audit_log(dev_eui, id);
+create index if not exists idx_alarm_audit_log_changed_by on alarm_audit_log(changed_by, id);
+
+-- alarm_audit_try_jsonb returns the value as jsonb, null when it is not
+-- valid JSON, so that malformed legacy values do not abort the migration.
+create or replace function pg_temp.alarm_audit_try_jsonb(value text) returns jsonb as $$
+begin
+	return nullif(value::jsonb, 'null'::jsonb);
+exception when others then
+	return null;
+end
+$$ language plpgsql;
+
+do $$
+declare
+	changed_at_column text;
+begin
+	if to_regclass('alarm_change_logs') is not null then
+		insert into alarm_audit_log (alarm_id, dev_eui, change_type, changed_by, old_values, new_values, changed_at, table_name, ip_address, reason)
+		select
+			a.id,
+			l.dev_eui,
+			case when l.is_deleted = 1 then 'DELETE' else 'UPDATE' end,
+			0,
+			case when l.is_deleted = 1 then v.snapshot end,
+			case when l.is_deleted = 1 then null else v.snapshot end,
+			l.submission_date,
+			'alarm_refactor2',
+			coalesce(l.ip_address, ''),
+			'backfilled from alarm_change_logs'
+		from alarm_change_logs as l,
+			lateral (select jsonb_build_object(
+				'dev_eui', l.dev_eui,
+				'min_treshold', l.min_treshold,
+				'max_treshold', l.max_treshold,
+				'user_id', to_jsonb(l.user_id),
+				'sms', l.sms,
+				'temperature', l.temperature,
+				'humadity', l.humadity,
+				'ec', l.ec,
+				'door', l.door,
+				'w_leak', l.w_leak
+			) as snapshot) as v
+			-- The old change log only knew the dev_eui: the entry is attached
+			-- to the alarm of the device watching the same sensors when there
+			-- is exactly one.
+			left join lateral (
+				select min(ar.id) as id
+				from alarm_refactor2 as ar
+				where ar.dev_eui = l.dev_eui
+					and ar.temperature = l.temperature and ar.humadity = l.humadity
+					and ar.ec = l.ec and ar.door = l.door and ar.w_leak = l.w_leak
+				having count(*) = 1
+			) as a on true
+		-- DeleteAlarm wrote its DELETE entries to both tables.
+		where not exists (
+			select 1 from alarm_audit_log as e
+			where e.alarm_id = a.id
+				and e.change_type = case when l.is_deleted = 1 then 'DELETE' else 'UPDATE' end
+				and e.changed_at = l.submission_date
+		)
+		order by l.submission_date;
+	end if;
+
+	if to_regclass('audit_logs') is not null then
+		select column_name into changed_at_column
+		from information_schema.columns
+		where table_name = 'audit_logs' and column_name in ('created_at', 'changed_at', 'timestamp')
+		limit 1;
+
+		execute format($f$
+			insert into alarm_audit_log (alarm_id, dev_eui, change_type, changed_by, old_values, new_values, changed_at, table_name, ip_address, reason)
+			select
+				record_id,
+				coalesce(n.value->>'DevEui', n.value->>'dev_eui', o.value->>'DevEui', o.value->>'dev_eui', ''),
+				change_type,
+				coalesce(user_id, 0),
+				o.value,
+				n.value,
+				%1$s,
+				coalesce(table_name, 'alarm_refactor2'),
+				coalesce(ip_address, ''),
+				coalesce(nullif(reason, ''), 'backfilled from audit_logs')
+			from audit_logs,
+				lateral (select pg_temp.alarm_audit_try_jsonb(previous_value::text) as value) as o,
+				lateral (select pg_temp.alarm_audit_try_jsonb(new_value::text) as value) as n
+			order by %1$s
+		$f$, coalesce(quote_ident(changed_at_column), 'now()'));
+	end if;
+end
+$$;
+
+drop function pg_temp.alarm_audit_try_jsonb(text);
@@ -0,0 +1,21 @@
+-- Every alarm_audit_log row is chained to the previous row of the same
+-- organization: hash covers the row content and prev_hash. The head of each
+-- chain is kept in alarm_audit_chain, its row lock serializes the writers of
+-- an organization. Existing rows are sealed by the service on startup.
+alter table alarm_audit_log
+	add column if not exists organization_id bigint not null default 0,
+	add column if not exists prev_hash bytea,
+	add column if not exists hash bytea;
+
+create index if not exists idx_alarm_audit_log_organization_id on alarm_audit_log(organization_id, id);
+
+update alarm_audit_log as l
+set organization_id = d.organization_id
+from device as d
+where d.dev_eui::text = '\x' || l.dev_eui and l.organization_id = 0;
+
+create table if not exists alarm_audit_chain (
+	organization_id bigint primary key,
+	last_id bigint,
+	last_hash bytea
+);
@@ -0,0 +1,13 @@
+-- Idempotency keys of CreateAlarm: a retry with the same key returns the
+-- alarm created by the first call. Keys are scoped to the caller and purged
+-- after their TTL. request_hash detects a key reused for another request.
+create table if not exists alarm_idempotency_key (
+	scope text not null,
+	key text not null,
+	request_hash bytea not null,
+	alarm_id bigint,
+	created_at timestamp with time zone not null default now(),
+	primary key (scope, key)
+);
+
+create index if not exists idx_alarm_idempotency_key_created_at on alarm_idempotency_key(created_at);
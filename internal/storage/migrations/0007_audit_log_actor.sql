@@ -0,0 +1,4 @@
+-- Changes made by the service itself, such as the periodic template sync,
+-- are recorded with an actor instead of a user.
+alter table alarm_audit_log
+	add column if not exists actor text not null default '';
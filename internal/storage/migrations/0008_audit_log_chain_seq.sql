@@ -0,0 +1,27 @@
+-- chain_seq is the position of a row in the hash chain of its organization.
+-- Rows sealed on startup, such as the ones written by a replica that did not
+-- chain them yet, are appended to the chain tail after rows with a higher
+-- id: the chain is verified in chain_seq order, not in id order.
+alter table alarm_audit_log add column if not exists chain_seq bigint;
+alter table alarm_audit_chain add column if not exists last_seq bigint not null default 0;
+
+-- Number the rows sealed so far by following their prev_hash links from the
+-- first row of each chain.
+with recursive chain as (
+	select l.id, l.organization_id, l.hash, 1::bigint as seq
+	from alarm_audit_log as l
+	where l.hash is not null and l.prev_hash is null
+	union all
+	select l.id, l.organization_id, l.hash, c.seq + 1
+	from chain as c
+		inner join alarm_audit_log as l on l.organization_id = c.organization_id and l.prev_hash = c.hash
+)
+update alarm_audit_log as l
+set chain_seq = c.seq
+from chain as c
+where c.id = l.id;
+
+update alarm_audit_chain as h
+set last_seq = coalesce((select max(l.chain_seq) from alarm_audit_log as l where l.organization_id = h.organization_id), 0);
+
+create index if not exists idx_alarm_audit_log_chain_seq on alarm_audit_log(organization_id, chain_seq);
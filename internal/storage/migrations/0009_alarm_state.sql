@@ -0,0 +1,8 @@
+-- The last evaluated state of each alarm: an alarm is raised or cleared when
+-- the measurements of its device change its state, not on every measurement.
+create table if not exists alarm_state (
+	alarm_id bigint primary key references alarm_refactor2(id) on delete cascade,
+	raised boolean not null,
+	value double precision,
+	changed_at timestamp with time zone not null default now()
+);
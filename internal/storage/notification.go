@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// notifications tracks the firebase, SMS and email notifications being sent.
+var notifications sync.WaitGroup
+
+// WaitNotifications waits until the notifications being sent are done or
+// ctx is done.
+func WaitNotifications(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		notifications.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
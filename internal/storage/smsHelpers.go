@@ -2,16 +2,17 @@ package storage
 
 import (
 	"encoding/xml"
-	"fmt"
 	"net/url"
 	"regexp"
 	"strings"
+
+	log "github.com/sirupsen/logrus"
 )
 
 func PrepareXml(data interface{}) url.Values {
 	xmlData, err := xml.Marshal(data)
 	if err != nil {
-		fmt.Println(err)
+		log.WithError(err).Error("storage: marshal sms xml error")
 	}
 	xmlString := string(xmlData)
 	values := url.Values{}
@@ -1,52 +1,77 @@
 package storage
 
 import (
+	"context"
 	"encoding/xml"
-	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/tiaguinho/gosoap"
+
+	"github.com/yurttasutkan/alarmservice/internal/metrics"
 )
 
+// smsClient is the HTTP client of the SMS panel.
+var smsClient = &http.Client{Transport: tracedTransport}
+
+// CheckSMS checks that the SMS panel answers.
+func CheckSMS(ctx context.Context) error {
+	return checkEndpoint(ctx, Url1N)
+}
+
 func (data OneToN) Send1N() (SendResult, error) {
+	notifications.Add(1)
+	defer notifications.Done()
 	values := PrepareXml(data)
-	fmt.Println(values)
-	req, err := http.PostForm(Url1N, values)
+	req, err := smsClient.PostForm(Url1N, values)
 	if err != nil {
-		fmt.Println(err)
+		metrics.NotificationSent(metrics.ChannelSMS, err)
+		return SendResult{}, err
 	}
+	defer req.Body.Close()
 	bodyBytes, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		fmt.Println(err)
+		log.WithError(err).Error("storage: read sms response error")
 	}
-	response, _ := SmsResponse(string(bodyBytes))
+	response, err := SmsResponse(string(bodyBytes))
+	if err == nil && !response.Status {
+		err = ErrNotificationFailed.With("detail", response.Description)
+	}
+	metrics.NotificationSent(metrics.ChannelSMS, err)
 	return response, nil
 
 }
 
 func (data NToN) SendNN() (SendResult, error) {
+	notifications.Add(1)
+	defer notifications.Done()
 	values := PrepareXml(data)
-	req, err := http.PostForm(UrlNN, values)
+	req, err := smsClient.PostForm(UrlNN, values)
 	if err != nil {
-		fmt.Println(err)
+		metrics.NotificationSent(metrics.ChannelSMS, err)
+		return SendResult{}, err
 	}
+	defer req.Body.Close()
 	bodyBytes, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		fmt.Println(err)
+		log.WithError(err).Error("storage: read sms response error")
+	}
+	response, err := SmsResponse(string(bodyBytes))
+	if err == nil && !response.Status {
+		err = ErrNotificationFailed.With("detail", response.Description)
 	}
-	response, _ := SmsResponse(string(bodyBytes))
+	metrics.NotificationSent(metrics.ChannelSMS, err)
 	return response, nil
 }
 
 func SmsResponse(response string) (SendResult, error) {
 	parse := strings.Split(response, ":")
 	if len(parse) < 2 {
-		return SendResult{}, errors.New("SMS sonucu parçalanamadı. Servis yanıtı: " + response)
+		return SendResult{}, ErrSMSInvalidResponse.With("response", response)
 	}
 	code, _ := strconv.Atoi(parse[0])
 
@@ -70,18 +95,17 @@ func SmsResponse(response string) (SendResult, error) {
 func (data Report) GetReport() ([]ReportDetailResult, error) {
 	var reportDetails ReportDetail
 	var httpClient = &http.Client{
-		Timeout: 1500 * time.Millisecond,
+		Timeout:   1500 * time.Millisecond,
+		Transport: tracedTransport,
 	}
 
 	soap, err := gosoap.SoapClient(WebServiceUrl, httpClient)
 	if err != nil {
-		return reportDetails.Result, errors.New("Soap başlatılamadı. " + err.Error())
+		return reportDetails.Result, ErrSMSProviderUnavailable.With("detail", err.Error())
 	}
 
 	date, _ := time.Parse("2006-01-02", data.Date)
 
-	fmt.Println(date)
-
 	params := gosoap.Params{
 		"kullanicino":    strconv.Itoa(int(data.UserID)),
 		"kullaniciadi":   data.Username,
@@ -93,7 +117,7 @@ func (data Report) GetReport() ([]ReportDetailResult, error) {
 
 	res, err := soap.Call("ikitariharasisorgulaXMLverID", params)
 	if err != nil {
-		return reportDetails.Result, errors.New("Soap çağrısı yapılamadı. " + err.Error())
+		return reportDetails.Result, ErrSMSProviderUnavailable.With("detail", err.Error())
 	}
 
 	reportDetailReturn := struct {
@@ -105,16 +129,16 @@ func (data Report) GetReport() ([]ReportDetailResult, error) {
 
 	//err = xml.Unmarshal([]byte(reportDetailReturn), &reportDetailReturn)
 	if err != nil {
-		return reportDetails.Result, errors.New("kayıt bulunamadı. ")
+		return reportDetails.Result, ErrSMSReportNotFound
 	}
 
 	if strings.Contains(reportDetailReturn.Return[0], "HATA:Kullanici bulunamadi") {
-		return reportDetails.Result, errors.New("kullanıcı bulunamadı, kullanıcı bilgileri, rapor ID ve tarih bilgilerini doğru girmeye özen gösteriniz. ")
+		return reportDetails.Result, ErrSMSReportNotFound
 	}
 
 	err = xml.Unmarshal([]byte(reportDetailReturn.Return[0]), &reportDetails)
 	if err != nil {
-		return reportDetails.Result, errors.New("kayıt bulunamadı. ")
+		return reportDetails.Result, ErrSMSReportNotFound
 	}
 
 	return reportDetails.Result, nil
@@ -123,12 +147,13 @@ func (data Report) GetReport() ([]ReportDetailResult, error) {
 func (data UserInfo) GetUser() (UserInfoResult, error) {
 	var user UserInfoResult
 	var httpClient = &http.Client{
-		Timeout: 1500 * time.Millisecond,
+		Timeout:   1500 * time.Millisecond,
+		Transport: tracedTransport,
 	}
 
 	soap, err := gosoap.SoapClient(WebServiceUrl, httpClient)
 	if err != nil {
-		return user, errors.New("Soap başlatılamadı. " + err.Error())
+		return user, ErrSMSProviderUnavailable.With("detail", err.Error())
 	}
 
 	params := gosoap.Params{
@@ -139,7 +164,7 @@ func (data UserInfo) GetUser() (UserInfoResult, error) {
 
 	res, err := soap.Call("UyeBilgisiSorgula", params)
 	if err != nil {
-		return user, errors.New("soap çağrısı yapılamadı. " + err.Error())
+		return user, ErrSMSProviderUnavailable.With("detail", err.Error())
 	}
 
 	userInfo := struct {
@@ -149,11 +174,11 @@ func (data UserInfo) GetUser() (UserInfoResult, error) {
 
 	err = res.Unmarshal(&userInfo)
 	if err != nil {
-		return user, errors.New("kayıt bulunamadı. ")
+		return user, ErrSMSInvalidResponse
 	}
 
 	if strings.Contains(userInfo.Return[0], "Kullanici bulunamadi") {
-		return user, errors.New("kullanıcı bulunamadı, kullanıcı bilgilerini kontrol ediniz. ")
+		return user, ErrSMSUserNotFound
 	}
 
 	splitBr := strings.Split(userInfo.Return[0], "<br>")
@@ -164,6 +189,7 @@ func (data UserInfo) GetUser() (UserInfoResult, error) {
 		if strings.Contains(splitField[0], "Toplam SMS") {
 			credit, _ := strconv.Atoi(splitField[1])
 			user.Credit = uint(credit)
+			metrics.SetSMSCredits(user.Credit)
 		} else if strings.Contains(splitField[0], "Firma") {
 			user.Company = splitField[1]
 		} else if strings.Contains(splitField[0], "Yetkili") {
@@ -1,11 +1,13 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/yurttasutkan/alarmservice/internal/config"
@@ -13,6 +15,9 @@ import (
 
 var (
 	db *sqlx.DB
+
+	// ready is closed once Setup has connected and migrated the database.
+	ready = make(chan struct{})
 )
 
 // DB returns the DB instance.
@@ -20,8 +25,9 @@ func DB() *sqlx.DB {
 	return db
 }
 
-// Setup configures the storage package.
-func Setup(conf *config.Config) error {
+// Setup configures the storage package. It waits for the database until it
+// answers or ctx is done.
+func Setup(ctx context.Context, conf *config.Config) error {
 	log.Info("storage: connecting to PostgreSQL database")
 	d, err := sqlx.Open("postgres", conf.PostgreSQL.DSN)
 	if err != nil {
@@ -30,17 +36,71 @@ func Setup(conf *config.Config) error {
 	d.SetMaxOpenConns(conf.PostgreSQL.MaxOpenConnections)
 	d.SetMaxIdleConns(conf.PostgreSQL.MaxIdleConnections)
 	for {
-		if err := d.Ping(); err != nil {
+		if err := d.PingContext(ctx); err != nil {
 			log.WithError(err).Warning("storage: ping PostgreSQL database error, will retry in 2s")
-			time.Sleep(time.Second * 2)
 		} else {
 			log.Infof("Connected to PostgreSQL")
 			break
 		}
+		select {
+		case <-ctx.Done():
+			d.Close()
+			return fmt.Errorf("connect to postgresql database: %w", ctx.Err())
+		case <-time.After(time.Second * 2):
+		}
 	}
 
 	db = d
 
+	if conf.PostgreSQL.Automigrate {
+		log.Info("storage: applying PostgreSQL schema migrations")
+		if err := Migrate(db); err != nil {
+			return fmt.Errorf("migrate postgresql database error: %w", err)
+		}
+		if err := SealAuditLog(db); err != nil {
+			return fmt.Errorf("seal audit log error: %w", err)
+		}
+	}
+
+	close(ready)
 	return nil
 }
 
+// Open opens a connection pool to the database without migrating it or
+// sealing the audit log, for the commands that only read the database. The
+// pool is not the one returned by DB.
+func Open(conf *config.Config) (*sqlx.DB, error) {
+	d, err := sqlx.Open("postgres", conf.PostgreSQL.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("open postgresql connection error: %w", err)
+	}
+	if err := d.Ping(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("ping postgresql database error: %w", err)
+	}
+	return d, nil
+}
+
+// Ready returns a channel that is closed once Setup has completed. DB must
+// not be used by other goroutines before.
+func Ready() <-chan struct{} {
+	return ready
+}
+
+// Ping checks the database connection. It fails while Setup has not completed.
+func Ping(ctx context.Context) error {
+	select {
+	case <-ready:
+	default:
+		return errors.New("storage: database is not set up")
+	}
+	return db.PingContext(ctx)
+}
+
+// Close closes the database connection pool.
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
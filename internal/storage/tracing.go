@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yurttasutkan/alarmservice/internal/storage")
+
+// tracedTransport traces the requests to the notification providers.
+var tracedTransport = otelhttp.NewTransport(http.DefaultTransport)
+
+// TracedDB is the database handle of a call. Its queries run within the call
+// context and are traced as children of the span of the call.
+type TracedDB struct {
+	*sqlx.DB
+	ctx context.Context
+}
+
+// DBContext returns the database handle for the given call context.
+func DBContext(ctx context.Context) *TracedDB {
+	return &TracedDB{DB: db, ctx: ctx}
+}
+
+// Exec executes a query without returning rows.
+func (d *TracedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(d.ctx, query)
+	res, err := d.DB.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return res, err
+}
+
+// Query executes a query returning rows.
+func (d *TracedDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(d.ctx, query)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// Queryx executes a query returning sqlx rows.
+func (d *TracedDB) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := startQuerySpan(d.ctx, query)
+	rows, err := d.DB.QueryxContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// QueryRowx executes a query returning at most one row.
+func (d *TracedDB) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startQuerySpan(d.ctx, query)
+	row := d.DB.QueryRowxContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+// Get scans a single row into dest.
+func (d *TracedDB) Get(dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Get(d, dest, query, args...)
+}
+
+// Select scans all rows into dest.
+func (d *TracedDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Select(d, dest, query, args...)
+}
+
+// Beginx starts a transaction within the call context.
+func (d *TracedDB) Beginx() (*TracedTx, error) {
+	return d.BeginTxx(d.ctx, nil)
+}
+
+// BeginTxx starts a transaction with the given options.
+func (d *TracedDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*TracedTx, error) {
+	tx, err := d.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TracedTx{Tx: tx, ctx: ctx}, nil
+}
+
+// TracedTx is a transaction started by TracedDB, its queries are traced.
+type TracedTx struct {
+	*sqlx.Tx
+	ctx context.Context
+}
+
+// Exec executes a query without returning rows.
+func (t *TracedTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(t.ctx, query)
+	res, err := t.Tx.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return res, err
+}
+
+// Query executes a query returning rows.
+func (t *TracedTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(t.ctx, query)
+	rows, err := t.Tx.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// Queryx executes a query returning sqlx rows.
+func (t *TracedTx) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := startQuerySpan(t.ctx, query)
+	rows, err := t.Tx.QueryxContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// QueryRowx executes a query returning at most one row.
+func (t *TracedTx) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startQuerySpan(t.ctx, query)
+	row := t.Tx.QueryRowxContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+// Get scans a single row into dest.
+func (t *TracedTx) Get(dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Get(t, dest, query, args...)
+}
+
+// Select scans all rows into dest.
+func (t *TracedTx) Select(dest interface{}, query string, args ...interface{}) error {
+	return sqlx.Select(t, dest, query, args...)
+}
+
+// startQuerySpan starts the span of a query, named after its operation,
+// e.g. SELECT.
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "QUERY"
+	if fields := strings.Fields(query); len(fields) != 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationKey.String(operation),
+			semconv.DBStatementKey.String(query),
+		),
+	)
+}
+
+// endSpan ends the span, recording the error if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ZoneCategoryExists returns true when the given zone category is used by
+// a zone. Zone categories are only known through the zones of ChirpStack.
+func ZoneCategoryExists(db sqlx.Queryer, zoneCategory int64) (bool, error) {
+	var exists bool
+	err := sqlx.Get(db, &exists, "select exists(select 1 from zone where zone_category = $1)", zoneCategory)
+	if err != nil {
+		return false, HandlePSQLError(Select, err, "select error")
+	}
+	return exists, nil
+}
+
+// GetZoneDevEuis returns the lower case dev_euis of the devices of the given
+// zone.
+func GetZoneDevEuis(db sqlx.Queryer, zoneID int64) ([]string, error) {
+	devEuis := []string{}
+	err := sqlx.Select(db, &devEuis, `select lower(replace(d::text, '\x', '')) from zone as z
+		cross join unnest(z.devices) as d where z.zone_id = $1`, zoneID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	if len(devEuis) != 0 {
+		return devEuis, nil
+	}
+
+	var exists bool
+	if err := sqlx.Get(db, &exists, "select exists(select 1 from zone where zone_id = $1)", zoneID); err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	if !exists {
+		return nil, ErrZoneNotFound.With("zone_id", strconv.FormatInt(zoneID, 10))
+	}
+	return devEuis, nil
+}
+
+// GetUserZoneDevEuis returns the lower case dev_euis of the devices of the
+// organization that are in the zones assigned to the user.
+func GetUserZoneDevEuis(db sqlx.Queryer, userID, organizationID int64) ([]string, error) {
+	devEuis := []string{}
+	err := sqlx.Select(db, &devEuis, `select encode(d.dev_eui, 'hex') from device as d
+		where d.organization_id = $1 and `+UserZoneSQL("encode(d.dev_eui, 'hex')", "$2"), organizationID, userID)
+	if err != nil {
+		return nil, HandlePSQLError(Select, err, "select error")
+	}
+	return devEuis, nil
+}
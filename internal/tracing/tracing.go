@@ -0,0 +1,68 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are exported over
+// OTLP/HTTP to the configured collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+
+	"github.com/yurttasutkan/alarmservice/internal/config"
+)
+
+// serviceName is the service.name resource attribute of the spans.
+const serviceName = "alarmservice"
+
+// Setup installs the global tracer provider and propagator. When no endpoint
+// is configured, tracing is disabled and the returned shutdown is a no-op.
+// Shutdown flushes the buffered spans.
+func Setup(conf *config.Config, version string) (func(context.Context) error, error) {
+	tracingConf := conf.Tracing
+
+	// Trace context is propagated even when tracing is disabled, so that
+	// the traces of the callers are not broken.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if tracingConf.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	log.WithFields(log.Fields{
+		"endpoint":       tracingConf.Endpoint,
+		"sampling_ratio": tracingConf.SamplingRatio,
+	}).Info("tracing: exporting spans over otlp")
+
+	exporter, err := newOTLPExporter(tracingConf.Endpoint, tracingConf.Headers, tracingConf.ExportTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create tracing resource error: %w", err)
+	}
+
+	// Callers that sampled a trace keep it sampled, new traces are sampled
+	// at the configured ratio.
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingConf.SamplingRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,329 @@
+// Package changefeed follows the changes of the alarm configuration, the
+// alarm_refactor2 and alarm_date_time tables, as published by alarmservice
+// with Postgres NOTIFY. A Subscriber reconnects on connection loss and
+// replays the changes missed meanwhile from the audit log.
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// Channel is the Postgres NOTIFY channel of the changes. The payload is an
+// Event as JSON.
+const Channel = "alarm_events"
+
+// auditTable is the table_name of the alarm entries of the audit log.
+const auditTable = "alarm_refactor2"
+
+// Types of the raised and cleared alarm events. The configuration changes
+// use the change types of the audit log: INSERT, UPDATE, DELETE, RESTORE
+// and REVERT.
+const (
+	EventRaised  = "RAISED"
+	EventCleared = "CLEARED"
+)
+
+const (
+	// replayPageSize is the number of changes replayed per query.
+	replayPageSize = 500
+	// pingInterval is the interval at which the idle listener connection
+	// is checked.
+	pingInterval = 90 * time.Second
+	// replayWindow is the number of ids before the cursor replayed again,
+	// for the changes committed after changes with greater ids.
+	replayWindow = 1000
+	// minRetryInterval and maxRetryInterval bound the delay before a
+	// failed subscriber starts over.
+	minRetryInterval = time.Second
+	maxRetryInterval = time.Minute
+)
+
+// Event is a change of an alarm, including its date windows, or an alarm
+// raised or cleared.
+type Event struct {
+	// ID is the audit log id of the configuration changes, the cursor to
+	// resume from. It is 0 for raised and cleared alarms, they are not
+	// replayed.
+	ID             int64     `db:"id" json:"id"`
+	Type           string    `db:"type" json:"type"`
+	AlarmID        int64     `db:"alarm_id" json:"alarm_id"`
+	DevEui         string    `db:"dev_eui" json:"dev_eui"`
+	OrganizationID int64     `db:"organization_id" json:"organization_id"`
+	Time           time.Time `db:"time" json:"time"`
+}
+
+// Filter selects the events of an organization or of the given devices.
+type Filter struct {
+	// OrganizationID is the organization, 0 means any.
+	OrganizationID int64
+	// DevEuis are lower case, nil means any device.
+	DevEuis []string
+}
+
+// Match returns true when the event is selected by the filter.
+func (f Filter) Match(e Event) bool {
+	if f.OrganizationID != 0 && e.OrganizationID != f.OrganizationID {
+		return false
+	}
+	if f.DevEuis == nil {
+		return true
+	}
+	devEui := strings.ToLower(e.DevEui)
+	for _, d := range f.DevEuis {
+		if d == devEui {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay returns at most limit configuration changes logged after the given
+// cursor and matching the filter, oldest first.
+func Replay(db sqlx.Queryer, cursor int64, f Filter, limit int) ([]Event, error) {
+	var devEuis interface{}
+	if f.DevEuis != nil {
+		devEuis = pq.Array(f.DevEuis)
+	}
+	var events []Event
+	err := sqlx.Select(db, &events, `
+		select id, change_type as type, coalesce(alarm_id, 0) as alarm_id, dev_eui, organization_id, changed_at as time
+		from alarm_audit_log
+		where id > $1 and table_name = $2
+			and ($3 = 0 or organization_id = $3)
+			and ($4::text[] is null or lower(dev_eui) = any($4::text[]))
+		order by id
+		limit $5`, cursor, auditTable, f.OrganizationID, devEuis, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select changes error: %w", err)
+	}
+	return events, nil
+}
+
+// LastID returns the id of the last configuration change, the cursor to
+// follow the new changes only.
+func LastID(db sqlx.Queryer) (int64, error) {
+	var id int64
+	if err := sqlx.Get(db, &id, "select coalesce(max(id), 0) from alarm_audit_log"); err != nil {
+		return 0, fmt.Errorf("select last change error: %w", err)
+	}
+	return id, nil
+}
+
+// Subscriber follows the changes matching a filter.
+type Subscriber struct {
+	dsn    string
+	db     sqlx.Queryer
+	filter Filter
+	cursor int64
+	// floor is the cursor given to NewSubscriber, the changes up to it are
+	// never handled.
+	floor int64
+
+	// seen are the ids handled within replayWindow of the cursor, a change
+	// is handled once whether it is notified, replayed or both.
+	seen map[int64]bool
+}
+
+// NewSubscriber creates a Subscriber listening on the database of dsn, the
+// changes are replayed from db. The changes after cursor are replayed
+// first, with a cursor of 0 only the new changes are handled.
+func NewSubscriber(dsn string, db sqlx.Queryer, filter Filter, cursor int64) *Subscriber {
+	return &Subscriber{dsn: dsn, db: db, filter: filter, cursor: cursor, floor: cursor, seen: make(map[int64]bool)}
+}
+
+// Cursor returns the id of the last configuration change handled, to resume
+// from.
+func (s *Subscriber) Cursor() int64 {
+	return s.cursor
+}
+
+// handlerError is an error of the handle function given to Run, it ends
+// Run.
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string {
+	return e.err.Error()
+}
+
+// Run calls handle for the changes until ctx is done or handle fails, the
+// error of handle is returned. The changes are handled in the order of
+// their commit, per organization. When the connection is lost or the
+// changes can not be replayed, Run retries with a growing delay and
+// replays the changes missed meanwhile. Run blocks until the database can
+// be reached.
+func (s *Subscriber) Run(ctx context.Context, handle func(Event) error) error {
+	delay := minRetryInterval
+	for {
+		start := time.Now()
+		err := s.run(ctx, handle)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+		var herr handlerError
+		if errors.As(err, &herr) {
+			return herr.err
+		}
+
+		// A subscriber that ran for a while starts over with the shortest
+		// delay.
+		if time.Since(start) > maxRetryInterval {
+			delay = minRetryInterval
+		}
+		log.WithError(err).WithField("retry_in", delay.String()).Warning("changefeed: subscriber error")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryInterval {
+			delay = maxRetryInterval
+		}
+	}
+}
+
+// run follows the changes on one listener until ctx is done or an error
+// occurs.
+func (s *Subscriber) run(ctx context.Context, handle func(Event) error) error {
+	l := pq.NewListener(s.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.WithError(err).Warning("changefeed: listener error")
+		}
+	})
+	// Closing the listener also ends a Listen waiting for the connection.
+	defer l.Close()
+
+	listening := make(chan error, 1)
+	go func() {
+		listening <- l.Listen(Channel)
+	}()
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-listening:
+		if err != nil {
+			return fmt.Errorf("listen %s error: %w", Channel, err)
+		}
+	}
+
+	// The changes committed from now on are notified.
+	if s.cursor == 0 {
+		id, err := LastID(s.db)
+		if err != nil {
+			return err
+		}
+		s.cursor, s.floor = id, id
+	} else if err := s.replay(handle); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-l.Notify:
+			// nil is sent once the connection was re-established.
+			if n == nil {
+				log.Info("changefeed: listener reconnected, replaying missed changes")
+				if err := s.replay(handle); err != nil {
+					return err
+				}
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.WithError(err).Error("changefeed: decode event error")
+				continue
+			}
+			if !s.filter.Match(e) {
+				continue
+			}
+			if err := s.handle(e, handle); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			go l.Ping()
+		}
+	}
+}
+
+// replay handles the changes missed after the cursor. The ids are taken
+// when the changes are written, a change can commit after one with a
+// greater id. The changes within replayWindow ids before the cursor are
+// replayed again and those already handled skipped.
+func (s *Subscriber) replay(handle func(Event) error) error {
+	cursor := s.cursor - replayWindow
+	if cursor < s.floor {
+		cursor = s.floor
+	}
+	for {
+		events, err := Replay(s.db, cursor, s.filter, replayPageSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := s.handle(e, handle); err != nil {
+				return err
+			}
+			cursor = e.ID
+		}
+		if len(events) < replayPageSize {
+			return nil
+		}
+	}
+}
+
+// handle calls handle for the change unless it was handled already, and
+// moves the cursor.
+func (s *Subscriber) handle(e Event, handle func(Event) error) error {
+	// Raised and cleared alarms are not logged, they have no id.
+	if e.ID == 0 {
+		if err := handle(e); err != nil {
+			return handlerError{err}
+		}
+		return nil
+	}
+	if e.ID <= s.floor || s.seen[e.ID] {
+		return nil
+	}
+	if err := handle(e); err != nil {
+		return handlerError{err}
+	}
+	s.seen[e.ID] = true
+	if e.ID > s.cursor {
+		s.cursor = e.ID
+	}
+	if len(s.seen) > 2*replayWindow {
+		for id := range s.seen {
+			if id <= s.cursor-replayWindow {
+				delete(s.seen, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Notify sends the event on Channel. Within a transaction the event is only
+// delivered on commit.
+func Notify(db sqlx.Execer, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal event error: %w", err)
+	}
+	if _, err := db.Exec("select pg_notify($1, $2)", Channel, string(payload)); err != nil {
+		return fmt.Errorf("notify error: %w", err)
+	}
+	return nil
+}